@@ -0,0 +1,88 @@
+package taskengine
+
+import "errors"
+
+// ErrNotParking is the error returned by the AddTasks method
+// when the engine has no execution in progress with parked idle instances.
+var ErrNotParking = errors.New("no execution in progress with parked idle instances")
+
+// addRequest is a request to add tasks to a run.
+type addRequest struct {
+	wts  WorkerTasks
+	end  bool // no more tasks will be added
+	errc chan error
+}
+
+// runControl receives the requests of a run with parked idle instances.
+type runControl struct {
+	addc chan *addRequest // tasks to add to the run
+	done chan struct{}    // closed when the run no longer accepts requests
+}
+
+// startControl sets the control of a new run of the engine.
+func (eng *Engine) startControl() *runControl {
+	ctl := &runControl{
+		addc: make(chan *addRequest),
+		done: make(chan struct{}),
+	}
+	eng.ctlMu.Lock()
+	eng.ctl = ctl
+	eng.ctlMu.Unlock()
+	return ctl
+}
+
+// stopControl signals the run no longer accepts requests.
+// It can be called more than once.
+func (eng *Engine) stopControl(ctl *runControl) {
+	eng.ctlMu.Lock()
+	defer eng.ctlMu.Unlock()
+	if eng.ctl == ctl {
+		eng.ctl = nil
+	}
+	select {
+	case <-ctl.done:
+	default:
+		close(ctl.done)
+	}
+}
+
+// AddTasks adds the tasks to the execution in progress of the engine,
+// that must have parked idle instances (see WithParkIdleInstances):
+// the parked instances of the workers are resumed to execute the new tasks.
+// If more executions are in progress, the tasks are added to the last one started.
+//
+// It returns a *ConfigError if a task is assigned to an undefined worker,
+// ErrNotParking if no execution with parked idle instances is in progress,
+// or an error if a task is already in the execution.
+func (eng *Engine) AddTasks(wts WorkerTasks) error {
+	for wid, ts := range wts {
+		if _, ok := eng.workers[wid]; !ok && len(ts) > 0 {
+			return &ConfigError{Kind: UndefinedWorker, WorkerID: wid}
+		}
+	}
+
+	return eng.sendControl(&addRequest{wts: wts, errc: make(chan error, 1)})
+}
+
+// endTasks signals the execution in progress with parked idle instances
+// that no more tasks will be added: the execution ends once the tasks are completed.
+func (eng *Engine) endTasks() error {
+	return eng.sendControl(&addRequest{end: true, errc: make(chan error, 1)})
+}
+
+// sendControl sends the request to the last execution started with parked idle instances.
+func (eng *Engine) sendControl(req *addRequest) error {
+	eng.ctlMu.Lock()
+	ctl := eng.ctl
+	eng.ctlMu.Unlock()
+	if ctl == nil {
+		return ErrNotParking
+	}
+
+	select {
+	case ctl.addc <- req:
+		return <-req.errc
+	case <-ctl.done:
+		return ErrNotParking
+	}
+}
@@ -0,0 +1,110 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestEngine_AddTasks(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithParkIdleInstances(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out, err := eng.ExecuteEvents(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// waitSuccess waits for the success events of the tasks
+	waitSuccess := func(tids ...TaskID) {
+		want := map[TaskID]bool{}
+		for _, tid := range tids {
+			want[tid] = true
+		}
+		timeout := time.After(time.Second)
+		for len(want) > 0 {
+			select {
+			case e, ok := <-out:
+				if !ok {
+					t.Fatalf("%v: run ended before the success", want)
+				}
+				if e.Type() == EventSuccess {
+					delete(want, e.Task.TaskID())
+				}
+			case <-timeout:
+				t.Fatalf("%v: no success within the timeout", want)
+			}
+		}
+	}
+
+	// the workers went idle: the tasks are added after their completion
+	waitSuccess("t1")
+	time.Sleep(20 * time.Millisecond)
+
+	add := testingWorkerTasks(map[string]testingTasks{
+		"w1": {{"t2", 10, true}},
+		"w2": {{"t3", 10, true}},
+	})
+	if err := eng.AddTasks(add); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitSuccess("t2", "t3")
+
+	// task already in the run
+	dup := testingWorkerTasks(map[string]testingTasks{"w2": {{"t1", 10, true}}})
+	if err := eng.AddTasks(dup); err == nil {
+		t.Errorf("want error adding a task already in the run")
+	}
+
+	// undefined worker
+	undef := testingWorkerTasks(map[string]testingTasks{"w9": {{"t9", 10, true}}})
+	var cerr *ConfigError
+	if err := eng.AddTasks(undef); !errors.As(err, &cerr) || cerr.Kind != UndefinedWorker {
+		t.Errorf("want UndefinedWorker error, got %v", err)
+	}
+
+	// the run ends when the context is canceled
+	cancel()
+	for range out {
+	}
+	if err := eng.AddTasks(add); err != ErrNotParking {
+		t.Errorf("want %v after the run, got %v", ErrNotParking, err)
+	}
+}
+
+func TestEngine_AddTasks_NotParking(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 50, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	add := testingWorkerTasks(map[string]testingTasks{"w1": {{"t2", 10, true}}})
+	if err := eng.AddTasks(add); err != ErrNotParking {
+		t.Errorf("want %v, got %v", ErrNotParking, err)
+	}
+	for range out {
+	}
+}
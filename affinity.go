@@ -0,0 +1,48 @@
+package taskengine
+
+import "sync"
+
+// Affinity records, for each task, the worker that previously executed it with success.
+// It is used to prefer the same (worker, task) pairs in the next executions,
+// i.e. to take advantage of warm caches of the worker.
+// It is safe for concurrent use.
+type Affinity struct {
+	mu sync.Mutex
+	m  map[TaskID]WorkerID
+}
+
+// NewAffinity returns a new Affinity object initialized with the given pairs.
+// The map m is copied.
+func NewAffinity(m map[TaskID]WorkerID) *Affinity {
+	a := &Affinity{m: map[TaskID]WorkerID{}}
+	for tid, wid := range m {
+		a.m[tid] = wid
+	}
+	return a
+}
+
+// Get returns the worker with affinity for the task, if any.
+func (a *Affinity) Get(tid TaskID) (WorkerID, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	wid, ok := a.m[tid]
+	return wid, ok
+}
+
+// Set records the worker with affinity for the task.
+func (a *Affinity) Set(tid TaskID, wid WorkerID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.m[tid] = wid
+}
+
+// WithAffinity sets the Affinity object used to choose the next task of a worker.
+// When two or more tasks have the same stat, the worker prefers a task
+// for which it has affinity, before considering the TaskID.
+// The engine updates the affinity with the worker of each success result,
+// so that the object can be shared by multiple executions or engines.
+func WithAffinity(a *Affinity) Option {
+	return func(o *options) {
+		o.affinity = a
+	}
+}
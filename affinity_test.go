@@ -0,0 +1,110 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestAffinity(t *testing.T) {
+	m := map[TaskID]WorkerID{"t1": "w1"}
+	a := NewAffinity(m)
+	m["t2"] = "w2" // the map is copied
+
+	if wid, ok := a.Get("t1"); !ok || wid != "w1" {
+		t.Errorf("t1: want (w1, true), got (%v, %v)", wid, ok)
+	}
+	if wid, ok := a.Get("t2"); ok {
+		t.Errorf("t2: want no affinity, got %v", wid)
+	}
+	a.Set("t2", "w3")
+	if wid, ok := a.Get("t2"); !ok || wid != "w3" {
+		t.Errorf("t2: want (w3, true), got (%v, %v)", wid, ok)
+	}
+}
+
+func TestEngine_WithAffinity(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, true}},
+	}
+
+	tests := map[string]struct {
+		affinity map[TaskID]WorkerID
+		want     []testingEventsGroup
+	}{
+		"no affinity": {
+			affinity: nil,
+			want: []testingEventsGroup{
+				{{"w1", "t1", EventStart}},
+				{{"w1", "t1", EventSuccess}},
+				{{"w1", "t2", EventStart}},
+				{{"w1", "t2", EventSuccess}},
+				{{"w1", "t3", EventStart}},
+				{{"w1", "t3", EventSuccess}},
+			},
+		},
+		"affinity": {
+			affinity: map[TaskID]WorkerID{"t3": "w1", "t1": "w2"},
+			want: []testingEventsGroup{
+				{{"w1", "t3", EventStart}},
+				{{"w1", "t3", EventSuccess}},
+				{{"w1", "t1", EventStart}},
+				{{"w1", "t1", EventSuccess}},
+				{{"w1", "t2", EventStart}},
+				{{"w1", "t2", EventSuccess}},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			eng, err := NewEngine(workers, testingWorkerTasks(input), WithAffinity(NewAffinity(tt.affinity)))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events := []Event{}
+			for e := range out {
+				events = append(events, *e)
+			}
+			if diff := testingEventsDiff(tt.want, events); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEngine_WithAffinity_Learn(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, false}, {"t2", 10, true}},
+		"w2": {{"t1", 20, true}},
+	}
+
+	aff := NewAffinity(nil)
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithAffinity(aff))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.Execute(context.Background(), AllResults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range out {
+	}
+
+	want := map[TaskID]WorkerID{"t1": "w2", "t2": "w1"}
+	for tid, wwant := range want {
+		if wid, ok := aff.Get(tid); !ok || wid != wwant {
+			t.Errorf("%s: want (%v, true), got (%v, %v)", tid, wwant, wid, ok)
+		}
+	}
+}
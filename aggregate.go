@@ -0,0 +1,68 @@
+package taskengine
+
+// AggregateFunc combines the results of a task into a single result.
+type AggregateFunc func(tid TaskID, results []Result) Result
+
+// WithAggregator sets a function used to combine the results of each task.
+//
+// Instead of cancelling the task after the first success, the engine waits
+// for quorum not canceled results (success or error, see EventCanceled), then it calls fn to combine them
+// and cancels the remaining jobs of the task.
+// If the task is completed before reaching the quorum, fn is called
+// with the results received so far (possibly none).
+// If quorum is not positive, the results are combined when the task is completed.
+//
+// The combined result is emitted in an Aggregated event.
+// If fn returns nil or panics, no Aggregated event is emitted for the task.
+// When an aggregator is set, the Execute method returns only the combined results,
+// regardless of the mode parameter.
+func WithAggregator(quorum int, fn AggregateFunc) Option {
+	return func(o *options) {
+		o.aggregator = fn
+		o.aggregateQuorum = quorum
+	}
+}
+
+// aggregator buffers the results of each task
+// until they are combined by the aggregate function.
+type aggregator struct {
+	fn      AggregateFunc
+	quorum  int
+	results map[TaskID][]Result
+	done    map[TaskID]bool // tasks already aggregated
+	opts    *options        // used to safely call fn
+}
+
+func newAggregator(fn AggregateFunc, quorum int, opts *options) *aggregator {
+	return &aggregator{
+		fn:      fn,
+		quorum:  quorum,
+		opts:    opts,
+		results: map[TaskID][]Result{},
+		done:    map[TaskID]bool{},
+	}
+}
+
+// add saves the result of the task, unless it is canceled or
+// the task has already been aggregated.
+// It returns true if the quorum of results has been reached.
+func (a *aggregator) add(tid TaskID, res Result) bool {
+	if a.done[tid] || isCanceled(res.Error()) {
+		return false
+	}
+	a.results[tid] = append(a.results[tid], res)
+	return a.quorum > 0 && len(a.results[tid]) >= a.quorum
+}
+
+// aggregate returns the combined result of the task.
+// The second value is false if the task has already been aggregated.
+func (a *aggregator) aggregate(tid TaskID) (Result, bool) {
+	if a.done[tid] {
+		return nil, false
+	}
+	var res Result
+	a.opts.safeCall("Aggregate", func() { res = a.fn(tid, a.results[tid]) })
+	a.done[tid] = true
+	delete(a.results, tid)
+	return res, true
+}
@@ -0,0 +1,194 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// voteResult is the result of a worker in the majority-vote test cases.
+type voteResult struct {
+	Wid   string
+	Value string
+	Err   error
+}
+
+func (r *voteResult) String() string { return r.Value }
+func (r *voteResult) Error() error   { return r.Err }
+
+// voteWorkFn returns a work function that, after msec milliseconds,
+// returns the value assigned to the worker.
+func voteWorkFn(values map[WorkerID]string) WorkFunc {
+	return func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		t := task.(*testingTask)
+		r := &voteResult{Wid: string(worker.WorkerID)}
+		select {
+		case <-ctx.Done():
+			r.Err = ctx.Err()
+		case <-time.After(time.Duration(t.msec) * time.Millisecond):
+			r.Value = values[worker.WorkerID]
+			if !t.success {
+				r.Err = testingError
+			}
+		}
+		return r
+	}
+}
+
+// majorityVote returns the most frequent value among the success results.
+func majorityVote(tid TaskID, results []Result) Result {
+	count := map[string]int{}
+	best := &voteResult{Err: testingError}
+	for _, res := range results {
+		if res.Error() != nil {
+			continue
+		}
+		v := res.String()
+		count[v]++
+		if best.Err != nil || count[v] > count[best.Value] {
+			best = &voteResult{Value: v}
+		}
+	}
+	return best
+}
+
+func TestEngine_WithAggregator(t *testing.T) {
+	values := map[WorkerID]string{"w1": "a", "w2": "b", "w3": "a", "w4": "b"}
+	workFn := voteWorkFn(values)
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: workFn},
+		{WorkerID: "w2", Instances: 1, Work: workFn},
+		{WorkerID: "w3", Instances: 1, Work: workFn},
+		{WorkerID: "w4", Instances: 1, Work: workFn},
+	}
+
+	tests := map[string]struct {
+		quorum int
+		input  map[string]testingTasks
+		want   map[string]string // TaskID -> aggregated value
+		wantOk map[string]bool   // TaskID -> aggregated success
+		// number of canceled results expected
+		canceled int
+	}{
+		"all results": {
+			quorum: 0,
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, true}},
+				"w2": {{"t1", 20, true}},
+				"w3": {{"t1", 30, true}},
+			},
+			want:   map[string]string{"t1": "a"},
+			wantOk: map[string]bool{"t1": true},
+		},
+		"quorum reached": {
+			quorum: 2,
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, true}},
+				"w3": {{"t1", 20, true}},
+				"w2": {{"t1", 200, true}},
+			},
+			want:     map[string]string{"t1": "a"},
+			wantOk:   map[string]bool{"t1": true},
+			canceled: 1,
+		},
+		"quorum not reached": {
+			quorum: 3,
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, false}, {"t2", 10, true}},
+				"w2": {{"t1", 20, true}, {"t2", 10, true}},
+				"w4": {{"t2", 10, true}},
+			},
+			want:   map[string]string{"t1": "b", "t2": "b"},
+			wantOk: map[string]bool{"t1": true, "t2": true},
+		},
+		"all errors": {
+			quorum: 2,
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, false}},
+				"w2": {{"t1", 20, false}},
+			},
+			want:   map[string]string{"t1": ""},
+			wantOk: map[string]bool{"t1": false},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			wts := testingWorkerTasks(tt.input)
+			eng, err := NewEngine(workers, wts, WithAggregator(tt.quorum, majorityVote))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := map[string]string{}
+			gotOk := map[string]bool{}
+			canceled := 0
+			for e := range events {
+				switch e.Type() {
+				case EventCanceled:
+					canceled++
+				case EventAggregated:
+					tid := string(e.Task.TaskID())
+					if _, ok := got[tid]; ok {
+						t.Errorf("task %s: aggregated more than once", tid)
+					}
+					got[tid] = e.Result.String()
+					gotOk[tid] = e.Result.Error() == nil
+				}
+			}
+
+			for tid, want := range tt.want {
+				if got[tid] != want {
+					t.Errorf("task %s: want %q, got %q", tid, want, got[tid])
+				}
+				if gotOk[tid] != tt.wantOk[tid] {
+					t.Errorf("task %s: want success %v, got %v", tid, tt.wantOk[tid], gotOk[tid])
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Errorf("want %d aggregated results, got %d", len(tt.want), len(got))
+			}
+			if canceled != tt.canceled {
+				t.Errorf("want %d canceled results, got %d", tt.canceled, canceled)
+			}
+		})
+	}
+}
+
+func TestEngine_Execute_WithAggregator(t *testing.T) {
+	values := map[WorkerID]string{"w1": "a", "w2": "b", "w3": "b"}
+	workFn := voteWorkFn(values)
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: workFn},
+		{WorkerID: "w2", Instances: 1, Work: workFn},
+		{WorkerID: "w3", Instances: 1, Work: workFn},
+	}
+	wts := testingWorkerTasks(map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+		"w2": {{"t1", 20, true}},
+		"w3": {{"t1", 30, true}},
+	})
+
+	eng, err := NewEngine(workers, wts, WithAggregator(0, majorityVote))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.Execute(context.Background(), FirstSuccessOrLastResult)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results := []Result{}
+	for res := range out {
+		results = append(results, res)
+	}
+	if len(results) != 1 {
+		t.Fatalf("want 1 result, got %d", len(results))
+	}
+	if got := results[0].String(); got != "b" {
+		t.Errorf("want %q, got %q", "b", got)
+	}
+}
@@ -0,0 +1,120 @@
+package taskengine
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// testingInstantWorkFn is like testingWorkFn, but it returns the result immediately
+// without waiting for the task duration.
+func testingInstantWorkFn(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+	t := task.(*testingTask)
+	r := &testingResult{
+		Tid: t.taskid,
+		Wid: string(worker.WorkerID),
+	}
+	if !t.success {
+		r.Err = testingError
+	}
+	return r
+}
+
+// testingBenchmarkInput returns nw workers with the given work function
+// and nt tasks assigned to each worker.
+// Each task is assigned to all the workers and fails with the first worker.
+func testingBenchmarkInput(nw, nt int, workFn WorkFunc) ([]*Worker, WorkerTasks) {
+	workers := []*Worker{}
+	wts := WorkerTasks{}
+	for w := 0; w < nw; w++ {
+		wid := WorkerID(fmt.Sprintf("w%d", w))
+		workers = append(workers, &Worker{WorkerID: wid, Instances: 2, Work: workFn})
+		ts := Tasks{}
+		for t := 0; t < nt; t++ {
+			ts = append(ts, &testingTask{fmt.Sprintf("t%d", t), 0, w > 0})
+		}
+		wts[wid] = ts
+	}
+	return workers, wts
+}
+
+func benchmarkExecuteClone(b *testing.B, noClone bool) {
+	ctx := context.Background()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		workers, wts := testingBenchmarkInput(10, 1000, testingInstantWorkFn)
+		eng, err := NewEngine(workers, wts, WithNoClone(noClone))
+		if err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+		b.StartTimer()
+
+		out, err := eng.Execute(ctx, AllResults)
+		if err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+		for range out {
+		}
+	}
+}
+
+func BenchmarkExecute_Clone(b *testing.B)   { benchmarkExecuteClone(b, false) }
+func BenchmarkExecute_NoClone(b *testing.B) { benchmarkExecuteClone(b, true) }
+
+// benchmarkSizes are the (workers, tasks per worker) pairs used by the benchmarks.
+var benchmarkSizes = []struct{ workers, tasks int }{
+	{1, 1000},
+	{10, 100},
+	{10, 1000},
+	{100, 100},
+}
+
+func BenchmarkExecute(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range benchmarkSizes {
+		workers, wts := testingBenchmarkInput(size.workers, size.tasks, testingInstantWorkFn)
+		eng, err := NewEngine(workers, wts)
+		if err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("%dx%d", size.workers, size.tasks), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				out, err := eng.Execute(ctx, FirstSuccessOrLastResult)
+				if err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+				for range out {
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkExecuteEvents(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range benchmarkSizes {
+		workers, wts := testingBenchmarkInput(size.workers, size.tasks, testingInstantWorkFn)
+		eng, err := NewEngine(workers, wts)
+		if err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+
+		b.Run(fmt.Sprintf("%dx%d", size.workers, size.tasks), func(b *testing.B) {
+			b.ReportAllocs()
+			events := 0
+			for i := 0; i < b.N; i++ {
+				out, err := eng.ExecuteEvents(ctx)
+				if err != nil {
+					b.Fatalf("unexpected error: %v", err)
+				}
+				for range out {
+					events++
+				}
+			}
+			b.ReportMetric(float64(events)/float64(b.N), "events/op")
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package taskengine
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Clock is the source of the time of the engine.
+// The engine uses it to set the times of the events and to wait for the deadlines
+// of the jobs (i.e. the retry backoffs and the soft deadlines).
+// A virtual clock makes the times and the waits independent of the real time,
+// i.e. for tests without real sleeps: the work functions get the clock with ClockFromContext.
+// It doesn't serialize the execution: the order of the jobs ending at the same time
+// still depends on the scheduling of the goroutines, so the tests step the clock
+// (see FakeClock.BlockUntil and FakeClock.Advance) once the expected events are received.
+//
+// A Clock can also have a Timer method, as the FakeClock, so that the engine
+// releases the waits it no longer needs: otherwise they are left until they elapse.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a chan receiving the current time once the duration has elapsed.
+	After(time.Duration) <-chan time.Time
+}
+
+// realClock is the Clock of the real time.
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (realClock) Timer(d time.Duration) (<-chan time.Time, func() bool) {
+	timer := time.NewTimer(d)
+	return timer.C, timer.Stop
+}
+
+// timerClock is a Clock whose waits can be stopped before they elapse.
+type timerClock interface {
+	Timer(time.Duration) (<-chan time.Time, func() bool)
+}
+
+// FakeClock is a virtual Clock, i.e. for tests: its time changes only by the Advance method.
+// It is safe for concurrent use.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	changed chan struct{} // closed when a waiter is added
+}
+
+// fakeWaiter is a chan waiting for a time of a FakeClock.
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// NewFakeClock returns a new FakeClock set to the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, changed: make(chan struct{})}
+}
+
+// Now returns the current time of the clock.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a chan receiving the time of the clock once it is advanced by the duration.
+// If the duration is not positive, the chan receives the current time at once.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	ch, _ := c.Timer(d)
+	return ch
+}
+
+// Timer is like After, but it also returns the func to stop the wait,
+// that is no longer counted by Waiters and BlockUntil.
+// The func returns false if the wait has already elapsed or been stopped.
+func (c *FakeClock) Timer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch, func() bool { return false }
+	}
+	w := &fakeWaiter{at: c.now.Add(d), ch: ch}
+	c.waiters = append(c.waiters, w)
+	close(c.changed)
+	c.changed = make(chan struct{})
+	return ch, func() bool { return c.stop(w) }
+}
+
+// stop removes the waiter, returning false if it is not waiting anymore.
+func (c *FakeClock) stop(w *fakeWaiter) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, x := range c.waiters {
+		if x == w {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Advance advances the clock by the duration,
+// sending the new time to the chans of the elapsed waits.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	var waiting []*fakeWaiter
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiting = append(waiting, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = waiting
+}
+
+// Waiters returns the number of the waits not yet elapsed.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil waits until the number of the waits not yet elapsed is at least n,
+// i.e. until the work functions are waiting for the clock before advancing it.
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.mu.Lock()
+		waiters, changed := len(c.waiters), c.changed
+		c.mu.Unlock()
+		if waiters >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+// clockKey is the context key of the clock of the engine.
+type clockKey struct{}
+
+// ClockFromContext returns the clock of the engine executing the job of the context,
+// or the real clock if the context is not of a job.
+// The work functions use it to be driven by the clock of the engine (see NewEngineWithClock).
+func ClockFromContext(ctx context.Context) Clock {
+	if clock, ok := ctx.Value(clockKey{}).(Clock); ok {
+		return clock
+	}
+	return realClock{}
+}
+
+// NewEngineWithClock is like NewEngine, but the engine uses the given clock
+// instead of the real time.
+func NewEngineWithClock(clock Clock, ws []*Worker, wts WorkerTasks, opts ...Option) (*Engine, error) {
+	if clock == nil {
+		return nil, fmt.Errorf("nil clock")
+	}
+	eng, err := NewEngine(ws, wts, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := clock.(advancer); eng.opts.deterministic && !ok {
+		return nil, fmt.Errorf("deterministic engine with a clock without the Advance method")
+	}
+	eng.clock = clock
+	return eng, nil
+}
+
+// after returns a chan receiving the time once the duration has elapsed
+// by the clock of the engine, and the func to release it.
+// NOTE: with a clock having the Timer method, the wait is released as soon as possible.
+func (eng *Engine) after(d time.Duration) (<-chan time.Time, func()) {
+	if tc, ok := eng.clock.(timerClock); ok {
+		ch, stop := tc.Timer(d)
+		return ch, func() { stop() }
+	}
+	return eng.clock.After(d), func() {}
+}
@@ -0,0 +1,256 @@
+package taskengine
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testingClockWorkFn is like testingWorkFn, but it waits by the clock of the engine.
+func testingClockWorkFn(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+	t := task.(*testingTask)
+	r := &testingResult{
+		Tid: t.taskid,
+		Wid: string(worker.WorkerID),
+	}
+
+	select {
+	case <-ctx.Done():
+		r.Err = ctx.Err()
+	case <-ClockFromContext(ctx).After(time.Duration(t.msec) * time.Second):
+		if !t.success {
+			r.Err = testingError
+		}
+	}
+	return r
+}
+
+func TestNewEngineWithClock(t *testing.T) {
+	t0 := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingClockWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingClockWorkFn},
+	}
+	// the durations are in seconds of the clock
+	input := map[string]testingTasks{
+		"w1": {{"t1", 5, true}},
+		"w2": {{"t2", 3, false}, {"t3", 1, true}},
+	}
+	if _, err := NewEngineWithClock(nil, workers, testingWorkerTasks(input)); err == nil {
+		t.Errorf("want error with a nil clock")
+	}
+	eng, err := NewEngineWithClock(clock, workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type result struct {
+		Type      EventType
+		TaskID    TaskID
+		TimeStart int
+		TimeEnd   int
+	}
+	sec := func(tm time.Time) int { return int(tm.Sub(t0) / time.Second) }
+
+	// the clock is advanced to the end of each job, once the previous events are received
+	var got []result
+	starts, step := 0, 0
+	for e := range out {
+		if e.Type() == EventStart {
+			starts++
+		} else if IsResult(e) {
+			got = append(got, result{e.Type(), e.Task.TaskID(), sec(e.TimeStart), sec(e.TimeEnd)})
+		}
+		switch {
+		case step == 0 && starts == 2:
+			clock.BlockUntil(2)
+			clock.Advance(3 * time.Second) // t2 ends
+		case step == 1 && starts == 3 && len(got) == 1:
+			clock.BlockUntil(2)
+			clock.Advance(time.Second) // t3 ends
+		case step == 2 && len(got) == 2:
+			clock.BlockUntil(1)
+			clock.Advance(time.Second) // t1 ends
+		default:
+			continue
+		}
+		step++
+	}
+
+	want := []result{
+		{EventError, "t2", 0, 3},
+		{EventSuccess, "t3", 3, 4},
+		{EventSuccess, "t1", 0, 5},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestNewEngineWithClock_RetryBackoff(t *testing.T) {
+	// the clock is before the real time: the backoff must elapse by the clock
+	t0 := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+
+	var attempts int32
+	work := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		r := &testingResult{Tid: string(task.TaskID()), Wid: string(worker.WorkerID)}
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			r.Err = testingError
+		}
+		return r
+	}
+	backoff := func(int) time.Duration { return time.Hour }
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: work, Retry: &RetryPolicy{MaxAttempts: 2, Backoff: backoff}},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 0, true}},
+	}
+	eng, err := NewEngineWithClock(clock, workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []EventType
+	for e := range out {
+		got = append(got, e.Type())
+		if e.Type() != EventError {
+			continue
+		}
+		// the retry waits for the backoff by the clock
+		select {
+		case e := <-out:
+			t.Fatalf("want no event before the backoff, got %v", e)
+		case <-time.After(50 * time.Millisecond):
+		}
+		clock.BlockUntil(1)
+		clock.Advance(time.Hour)
+	}
+
+	want := []EventType{EventStart, EventError, EventStart, EventSuccess}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	t0 := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+
+	if got := <-clock.After(0); !got.Equal(t0) {
+		t.Errorf("want %v at once, got %v", t0, got)
+	}
+	c1 := clock.After(time.Second)
+	c2 := clock.After(2 * time.Second)
+	clock.BlockUntil(2)
+
+	clock.Advance(time.Second)
+	select {
+	case got := <-c1:
+		if want := t0.Add(time.Second); !got.Equal(want) {
+			t.Errorf("want %v, got %v", want, got)
+		}
+	default:
+		t.Errorf("want the first wait elapsed")
+	}
+	if n := clock.Waiters(); n != 1 {
+		t.Errorf("want 1 waiter, got %d", n)
+	}
+
+	clock.Advance(5 * time.Second)
+	if got := <-c2; !got.Equal(t0.Add(6 * time.Second)) {
+		t.Errorf("want the time of the clock, got %v", got)
+	}
+	if got := clock.Now(); !got.Equal(t0.Add(6 * time.Second)) {
+		t.Errorf("want %v, got %v", t0.Add(6*time.Second), got)
+	}
+}
+
+func TestFakeClock_Timer(t *testing.T) {
+	t0 := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+
+	c1, stop1 := clock.Timer(time.Second)
+	_, stop2 := clock.Timer(time.Second)
+	if n := clock.Waiters(); n != 2 {
+		t.Errorf("want 2 waiters, got %d", n)
+	}
+	if !stop2() {
+		t.Errorf("want the wait stopped")
+	}
+	if stop2() {
+		t.Errorf("want the wait already stopped")
+	}
+	if n := clock.Waiters(); n != 1 {
+		t.Errorf("want 1 waiter, got %d", n)
+	}
+
+	clock.Advance(time.Second)
+	if got := <-c1; !got.Equal(t0.Add(time.Second)) {
+		t.Errorf("want the time of the clock, got %v", got)
+	}
+	if stop1() {
+		t.Errorf("want the wait already elapsed")
+	}
+}
+
+func TestNewEngineWithClock_ReleasedWaits(t *testing.T) {
+	// the wait of the pending retry is set again at each result of w2:
+	// the previous ones must be released
+	t0 := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(t0)
+
+	backoff := func(int) time.Duration { return time.Hour }
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn, Retry: &RetryPolicy{MaxAttempts: 2, Backoff: backoff}},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 0, false}},
+		"w2": {{"t2", 20, true}, {"t3", 10, true}, {"t4", 10, true}},
+	}
+	eng, err := NewEngineWithClock(clock, workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	results := 0
+	for e := range out {
+		if !IsResult(e) {
+			continue
+		}
+		results++
+		if results == 4 {
+			// t1 failed and t2, t3 and t4 succeeded: only the retry is waiting
+			clock.BlockUntil(1)
+			if n := clock.Waiters(); n != 1 {
+				t.Errorf("want 1 waiter, got %d", n)
+			}
+			clock.Advance(time.Hour)
+		}
+	}
+}
+
+func TestClockFromContext(t *testing.T) {
+	if _, ok := ClockFromContext(context.Background()).(realClock); !ok {
+		t.Errorf("want the real clock without the clock of an engine")
+	}
+}
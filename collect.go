@@ -0,0 +1,348 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrConsumeTimeout is the error returned by ExecuteAll
+// when the results are not collected within the consume timeout.
+var ErrConsumeTimeout = errors.New("consume timeout")
+
+// ErrNoResults is the error returned by ExecuteAll with strict output
+// when no result is emitted, even though some tasks have been executed.
+var ErrNoResults = errors.New("no results emitted")
+
+// collectOptions contains the optional settings of the ExecuteAll method.
+type collectOptions struct {
+	timeout         time.Duration     // max time to collect the results
+	cancelOnTimeout bool              // cancel the run after the timeout
+	filter          func(*Event) bool // filters the results instead of the mode
+	strict          bool              // no results is an error
+	sortByTask      bool              // sort the results by TaskID
+	distinct        bool              // discard the duplicate results of each task
+}
+
+// CollectOption type is a function that sets an optional setting of the ExecuteAll method.
+type CollectOption func(*collectOptions)
+
+// WithConsumeTimeout sets the max time the ExecuteAll method waits for the results.
+// After the timeout, ExecuteAll returns the results collected so far with the ErrConsumeTimeout error.
+// If cancelRun is true, the execution is canceled;
+// otherwise it goes on in background and the remaining results are discarded.
+// A not positive timeout means no timeout (the default).
+func WithConsumeTimeout(timeout time.Duration, cancelRun bool) CollectOption {
+	return func(o *collectOptions) {
+		o.timeout = timeout
+		o.cancelOnTimeout = cancelRun
+	}
+}
+
+// WithResultFilter sets the function used by the ExecuteAll method
+// to filter the results, instead of the one based on the mode parameter.
+func WithResultFilter(fn func(*Event) bool) CollectOption {
+	return func(o *collectOptions) {
+		o.filter = fn
+	}
+}
+
+// WithStrictOutput sets whether the ExecuteAll method returns an ErrNoResults error
+// when no result passes the filter, even though some tasks have results.
+// It is useful to detect a filter that excludes every result.
+// The error is not returned in case of consume timeout.
+func WithStrictOutput(strict bool) CollectOption {
+	return func(o *collectOptions) {
+		o.strict = strict
+	}
+}
+
+// WithSortByTaskID sets whether the ExecuteAll method returns the results sorted by TaskID,
+// for a deterministic output, instead of in order of completion.
+// The results of the same task keep their order of completion.
+// In case of consume timeout, the results sorted are the ones collected so far.
+func WithSortByTaskID(sort bool) CollectOption {
+	return func(o *collectOptions) {
+		o.sortByTask = sort
+	}
+}
+
+// WithDistinctResults sets whether the ExecuteAll method discards the results
+// equal to a result of the same task already collected, as decided by the ResultEqual option
+// of the engine (see WithResultEqual).
+// If the function panics, the results are considered different.
+func WithDistinctResults(distinct bool) CollectOption {
+	return func(o *collectOptions) {
+		o.distinct = distinct
+	}
+}
+
+// ExecuteAll executes the tasks and returns all the results filtered based on the Mode parameter.
+// It is a blocking version of the Execute method:
+// the results are returned in order of completion (see WithSortByTaskID to sort them by TaskID).
+// If the context is canceled before the completion of the execution,
+// it returns the results collected so far with the error of the context.
+func (eng *Engine) ExecuteAll(ctx context.Context, mode Mode, opts ...CollectOption) ([]Result, error) {
+	co := collectOptions{}
+	for _, opt := range opts {
+		opt(&co)
+	}
+
+	if ctx == nil {
+		return nil, errors.New("nil context")
+	}
+	if err := checkMode(mode); err != nil {
+		return nil, err
+	}
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+
+	filter := co.filter
+	if filter == nil {
+		filter = eng.filterEventFunc(mode)
+	}
+	if co.distinct {
+		// results of each task exported so far
+		// NOTE: the filter is called by a single goroutine.
+		seen := map[TaskID][]Result{}
+		export := filter
+		filter = func(e *Event) bool {
+			if !export(e) || e.Task == nil {
+				return false
+			}
+			tid := e.Task.TaskID()
+			for _, res := range seen[tid] {
+				equal := false
+				eng.opts.safeCall("ResultEqual", func() { equal = eng.opts.equal(res, e.Result) })
+				if equal {
+					return false
+				}
+			}
+			seen[tid] = append(seen[tid], e.Result)
+			return true
+		}
+	}
+	// executed tasks, i.e. with at least a result event
+	executed := map[TaskID]bool{}
+	if co.strict {
+		export := filter
+		filter = func(e *Event) bool {
+			if IsResult(e) {
+				executed[e.Task.TaskID()] = true
+			}
+			return export(e)
+		}
+	}
+	// with sortByTask, each result is received with its task, to sort the results collected
+	var result func(*Event) Result
+	if co.sortByTask {
+		result = func(e *Event) Result {
+			tr := taskResult{res: e.Result}
+			if e.Task != nil {
+				tr.tid = e.Task.TaskID()
+			}
+			return tr
+		}
+	}
+	sorted := func(results []Result) []Result {
+		if !co.sortByTask {
+			return results
+		}
+		sort.SliceStable(results, func(i, j int) bool {
+			return results[i].(taskResult).tid < results[j].(taskResult).tid
+		})
+		for i, res := range results {
+			results[i] = res.(taskResult).res
+		}
+		return results
+	}
+
+	out, err := eng.executeFilter(ctx, filter, result)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var timeout <-chan time.Time
+	if co.timeout > 0 {
+		timer := time.NewTimer(co.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	results := []Result{}
+	for {
+		select {
+		case res, ok := <-out:
+			if !ok {
+				cancel()
+				results = sorted(results)
+				if err := parent.Err(); err != nil {
+					return results, err
+				}
+				if co.strict && len(results) == 0 && len(executed) > 0 {
+					return results, fmt.Errorf("%w for %d tasks", ErrNoResults, len(executed))
+				}
+				return results, nil
+			}
+			results = append(results, res)
+
+		case <-timeout:
+			if co.cancelOnTimeout {
+				cancel()
+			}
+			// discard the remaining results, so that the run can go on
+			go func() {
+				for range out {
+				}
+				cancel()
+			}()
+			return sorted(results), ErrConsumeTimeout
+		}
+	}
+}
+
+// taskResult is a result with the TaskID of its task.
+type taskResult struct {
+	tid TaskID
+	res Result
+}
+
+// Error returns the error of the result.
+func (tr taskResult) Error() error { return tr.res.Error() }
+
+// String returns the string representation of the result.
+func (tr taskResult) String() string { return tr.res.String() }
+
+// RunJoin executes the tasks and returns nil if each task succeeded,
+// otherwise a *RunError with the last error of each task that ended without success.
+//
+// The success of a task is decided by its results filtered based on the Mode parameter,
+// as the Execute method (i.e. by the aggregated result, with an aggregator).
+// A task without any result (i.e. not executed by any worker) fails with the ErrNoResults error.
+func (eng *Engine) RunJoin(ctx context.Context, mode Mode) error {
+	if err := checkMode(mode); err != nil {
+		return err
+	}
+	// tasks of the run, with their last error
+	// NOTE: the tasks are read before the execution, that can consume them (see WithNoClone).
+	lastErr := map[TaskID]error{}
+	for _, ts := range eng.widtasks {
+		for _, t := range ts {
+			lastErr[t.TaskID()] = ErrNoResults
+		}
+	}
+
+	events, err := eng.ExecuteEvents(ctx)
+	if err != nil {
+		return err
+	}
+	export := eng.filterEventFunc(mode)
+	succeeded := map[TaskID]bool{}
+	for e := range events {
+		if !IsResult(e) && !IsAggregated(e) {
+			continue
+		}
+		tid := e.Task.TaskID()
+		if err := e.Result.Error(); err != nil {
+			lastErr[tid] = err
+		} else if export(e) {
+			succeeded[tid] = true
+		}
+	}
+
+	runErr := &RunError{}
+	for tid, err := range lastErr {
+		if !succeeded[tid] {
+			runErr.Errors = append(runErr.Errors, &TaskError{TaskID: tid, Err: err})
+		}
+	}
+	if len(runErr.Errors) == 0 {
+		return nil
+	}
+	sort.Slice(runErr.Errors, func(i, j int) bool { return runErr.Errors[i].TaskID < runErr.Errors[j].TaskID })
+	return runErr
+}
+
+// CollectByTask executes the tasks and returns the results filtered based on the Mode parameter,
+// grouped by TaskID, as the ExecuteAll method.
+// The results of each task are in order of completion.
+// The tasks without results (i.e. with only canceled results in SuccessOrErrorResults mode) are not in the map.
+func (eng *Engine) CollectByTask(ctx context.Context, mode Mode) (map[TaskID][]Result, error) {
+	if err := checkMode(mode); err != nil {
+		return nil, err
+	}
+	export := eng.filterEventFunc(mode)
+
+	// NOTE: the filter is called for each event by the goroutine
+	// that closes the results chan, so the map is complete once ExecuteAll returns.
+	results := map[TaskID][]Result{}
+	group := func(e *Event) bool {
+		ok := export(e)
+		if ok {
+			tid := e.Task.TaskID()
+			results[tid] = append(results[tid], e.Result)
+		}
+		return ok
+	}
+	_, err := eng.ExecuteAll(ctx, mode, WithResultFilter(group))
+	return results, err
+}
+
+// TaskResult is a result with the task and the worker that produced it.
+type TaskResult struct {
+	TaskID   TaskID
+	WorkerID WorkerID
+	Result   Result
+}
+
+// ExecuteTaskResults is like the Execute method, but each result is sent
+// with the TaskID and the WorkerID of the job that produced it,
+// so that the consumer can correlate the results to the tasks
+// without a Result type exposing them.
+// The options of the engine related to the Execute output (i.e. WithEmitOnCompletion) are ignored.
+func (eng *Engine) ExecuteTaskResults(ctx context.Context, mode Mode) (chan TaskResult, error) {
+	if err := checkMode(mode); err != nil {
+		return nil, err
+	}
+	eventc, err := eng.ExecuteEvents(ctx)
+	if err != nil {
+		return nil, err
+	}
+	export := eng.filterEventFunc(mode)
+
+	resultc := make(chan TaskResult, eng.opts.resultBufferSize())
+	go func() {
+		for e := range eventc {
+			if export(e) {
+				resultc <- TaskResult{TaskID: e.Task.TaskID(), WorkerID: e.WorkerID, Result: e.Result}
+			}
+		}
+		close(resultc)
+	}()
+
+	return resultc, nil
+}
+
+// ExecuteAllWithEvents is like the ExecuteAll method, but it also returns
+// the complete log of the events generated by the execution, in order of emission.
+// Both the results and the events are complete when the method returns,
+// also in case of the error of a context canceled before the completion.
+func (eng *Engine) ExecuteAllWithEvents(ctx context.Context, mode Mode) ([]Result, []*Event, error) {
+	if err := checkMode(mode); err != nil {
+		return nil, nil, err
+	}
+	export := eng.filterEventFunc(mode)
+
+	// NOTE: the filter is called for each event by the goroutine
+	// that closes the results chan, so the log is complete once ExecuteAll returns.
+	events := []*Event{}
+	record := func(e *Event) bool {
+		events = append(events, e)
+		return export(e)
+	}
+	results, err := eng.ExecuteAll(ctx, mode, WithResultFilter(record))
+	return results, events, err
+}
@@ -0,0 +1,465 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEngine_ExecuteAll(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t1", 20, true}, {"t3", 10, true}},
+	}
+	want := []testingResultsGroup{
+		{{"w1", "t1", nil}, {"w1", "t2", testingError}, {"w2", "t3", nil}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results, err := eng.ExecuteAll(context.Background(), FirstSuccessOrLastResult)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := []testingResult{}
+	for _, res := range results {
+		got = append(got, *res.(*testingResult))
+	}
+	if diff := testingResultsDiff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_ExecuteAll_ConsumeTimeout(t *testing.T) {
+	for _, cancelRun := range []bool{false, true} {
+
+		// the work function sends the result of the slow task on the done chan
+		done := make(chan Result, 1)
+		workFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+			res := testingWorkFn(ctx, worker, workerInst, task)
+			if task.TaskID() == "t2" {
+				done <- res
+			}
+			return res
+		}
+
+		workers := []*Worker{
+			{WorkerID: "w1", Instances: 2, Work: workFn},
+		}
+		input := map[string]testingTasks{
+			"w1": {{"t1", 10, true}, {"t2", 200, true}},
+		}
+
+		eng, err := NewEngine(workers, testingWorkerTasks(input))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		results, err := eng.ExecuteAll(context.Background(), AllResults, WithConsumeTimeout(80*time.Millisecond, cancelRun))
+		if !errors.Is(err, ErrConsumeTimeout) {
+			t.Errorf("cancelRun=%v: want error %v, got %v", cancelRun, ErrConsumeTimeout, err)
+		}
+		if len(results) != 1 || results[0].(*testingResult).Tid != "t1" {
+			t.Errorf("cancelRun=%v: want the t1 result only, got %v", cancelRun, results)
+		}
+
+		// check the slow task is canceled or completed
+		select {
+		case res := <-done:
+			canceled := errors.Is(res.Error(), context.Canceled)
+			if canceled != cancelRun {
+				t.Errorf("cancelRun=%v: unexpected slow task result %v", cancelRun, res)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("cancelRun=%v: slow task not terminated", cancelRun)
+		}
+	}
+}
+
+func TestEngine_ExecuteAll_StrictOutput(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t3", 10, true}},
+	}
+	nothing := func(*Event) bool { return false }
+
+	tests := map[string]struct {
+		opts    []CollectOption
+		results int
+		wantErr bool
+	}{
+		"mode filter": {
+			opts:    []CollectOption{WithStrictOutput(true)},
+			results: 3,
+		},
+		"filter everything": {
+			opts:    []CollectOption{WithResultFilter(nothing)},
+			results: 0,
+		},
+		"filter everything strict": {
+			opts:    []CollectOption{WithResultFilter(nothing), WithStrictOutput(true)},
+			results: 0,
+			wantErr: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			eng, err := NewEngine(workers, testingWorkerTasks(input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			results, err := eng.ExecuteAll(context.Background(), FirstSuccessOrLastResult, tt.opts...)
+			if len(results) != tt.results {
+				t.Errorf("want %d results, got %d", tt.results, len(results))
+			}
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrNoResults) {
+				t.Fatalf("want ErrNoResults, got %v", err)
+			}
+			if want := "no results emitted for 3 tasks"; err.Error() != want {
+				t.Errorf("want error %q, got %q", want, err.Error())
+			}
+		})
+	}
+}
+
+func TestEngine_ExecuteAll_SortByTaskID(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 3, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 60, true}, {"t2", 10, false}, {"t3", 30, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results, err := eng.ExecuteAll(context.Background(), AllResults, WithSortByTaskID(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := []string{}
+	for _, res := range results {
+		got = append(got, res.(*testingResult).Tid)
+	}
+	if diff := cmp.Diff([]string{"t1", "t2", "t3"}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_ExecuteAll_SortByTaskID_ConsumeTimeout(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	// the t1 result of w1 is buffered until the completion of t1 by w2, after the timeout
+	input := map[string]testingTasks{
+		"w1": {{"t3", 10, true}, {"t1", 10, false}},
+		"w2": {{"t1", 300, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithEmitOnCompletion(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results, err := eng.ExecuteAll(context.Background(), AllResults,
+		WithSortByTaskID(true), WithConsumeTimeout(100*time.Millisecond, true))
+	if !errors.Is(err, ErrConsumeTimeout) {
+		t.Errorf("want error %v, got %v", ErrConsumeTimeout, err)
+	}
+	got := []string{}
+	for _, res := range results {
+		got = append(got, res.(*testingResult).Tid)
+	}
+	if diff := cmp.Diff([]string{"t3"}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_ExecuteAll_DistinctResults(t *testing.T) {
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, false}, {"t2", 10, true}},
+		"w2": {{"t1", 30, false}},
+	}
+	sameWorker := func(a, b Result) bool {
+		return a.(*testingResult).Wid == b.(*testingResult).Wid
+	}
+	tests := []struct {
+		name  string
+		opts  []Option
+		copts []CollectOption
+		want  []string
+	}{
+		{"not distinct", nil, nil, []string{"t1 w1", "t1 w2", "t2 w1"}},
+		{"distinct", nil, []CollectOption{WithDistinctResults(true)}, []string{"t1 w1", "t2 w1"}},
+		{"distinct by worker", []Option{WithResultEqual(sameWorker)},
+			[]CollectOption{WithDistinctResults(true)}, []string{"t1 w1", "t1 w2", "t2 w1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workers := []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+			}
+			eng, err := NewEngine(workers, testingWorkerTasks(input), tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			results, err := eng.ExecuteAll(context.Background(), AllResults, tt.copts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := []string{}
+			for _, res := range results {
+				r := res.(*testingResult)
+				got = append(got, r.Tid+" "+r.Wid)
+			}
+			sort.Strings(got)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEngine_ExecuteAll_Canceled(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 300, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 80*time.Millisecond)
+	defer cancel()
+
+	results, err := eng.ExecuteAll(ctx, SuccessOrErrorResults)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want error %v, got %v", context.DeadlineExceeded, err)
+	}
+	if len(results) != 1 || results[0].(*testingResult).Tid != "t1" {
+		t.Errorf("want the t1 result only, got %v", results)
+	}
+}
+
+func TestEngine_RunJoin(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+
+	tests := map[string]struct {
+		input   map[string]testingTasks
+		noClone bool
+		want    []TaskID
+	}{
+		"all succeeded": {
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, true}, {"t2", 10, false}},
+				"w2": {{"t2", 30, true}},
+			},
+		},
+		"mixed": {
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, true}, {"t2", 10, false}, {"t3", 10, false}},
+				"w2": {{"t3", 10, false}, {"t4", 10, true}},
+			},
+			want: []TaskID{"t2", "t3"},
+		},
+		"mixed, no clone": {
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, true}, {"t2", 10, false}, {"t3", 10, false}},
+				"w2": {{"t3", 10, false}, {"t4", 10, true}},
+			},
+			noClone: true,
+			want:    []TaskID{"t2", "t3"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			eng, err := NewEngine(workers, testingWorkerTasks(tt.input), WithNoClone(tt.noClone))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			err = eng.RunJoin(context.Background(), FirstSuccessOrLastResult)
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("want nil error, got %v", err)
+				}
+				return
+			}
+
+			var runErr *RunError
+			if !errors.As(err, &runErr) {
+				t.Fatalf("want *RunError, got %v", err)
+			}
+			got := []TaskID{}
+			for _, te := range runErr.Errors {
+				got = append(got, te.TaskID)
+				if te.Err != testingError {
+					t.Errorf("%s: want error %v, got %v", te.TaskID, testingError, te.Err)
+				}
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("failed tasks mismatch (-want +got):\n%s", diff)
+			}
+			if !errors.Is(err, testingError) {
+				t.Errorf("want the error to wrap %v", testingError)
+			}
+			if want := "t2: " + testingError.Error() + "\nt3: " + testingError.Error(); err.Error() != want {
+				t.Errorf("want message %q, got %q", want, err.Error())
+			}
+		})
+	}
+}
+
+func TestEngine_CollectByTask(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t1", 20, true}, {"t3", 10, true}, {"t2", 30, false}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := eng.CollectByTask(context.Background(), Mode(-1)); err == nil {
+		t.Errorf("want error with an invalid mode")
+	}
+
+	results, err := eng.CollectByTask(context.Background(), SuccessOrErrorResults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := map[TaskID][]testingResult{}
+	for tid, rs := range results {
+		for _, res := range rs {
+			got[tid] = append(got[tid], *res.(*testingResult))
+		}
+	}
+	want := map[TaskID][]testingResult{
+		"t1": {{"w1", "t1", nil}},
+		"t2": {{"w1", "t2", testingError}, {"w2", "t2", testingError}},
+		"t3": {{"w2", "t3", nil}},
+	}
+	if diff := cmp.Diff(want, got, cmp.Comparer(func(a, b error) bool { return a == b })); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_ExecuteTaskResults(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t3", 10, true}, {"t2", 30, false}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := eng.ExecuteTaskResults(context.Background(), Mode(-1)); err == nil {
+		t.Errorf("want error with an invalid mode")
+	}
+
+	out, err := eng.ExecuteTaskResults(context.Background(), SuccessOrErrorResults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := map[string]string{}
+	for tr := range out {
+		res := tr.Result.(*testingResult)
+		if string(tr.TaskID) != res.Tid || string(tr.WorkerID) != res.Wid {
+			t.Errorf("want %s/%s, got %s/%s", res.Wid, res.Tid, tr.WorkerID, tr.TaskID)
+		}
+		got[string(tr.WorkerID)+"/"+string(tr.TaskID)] = res.String()
+	}
+	want := map[string]string{
+		"w1/t1": "SUCCESS",
+		"w1/t2": "ERROR",
+		"w2/t3": "SUCCESS",
+		"w2/t2": "ERROR",
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_ExecuteAllWithEvents(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t1", 20, true}, {"t3", 10, true}},
+	}
+	want := []testingResultsGroup{
+		{{"w1", "t1", nil}, {"w1", "t2", testingError}, {"w2", "t3", nil}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results, events, err := eng.ExecuteAllWithEvents(context.Background(), FirstSuccessOrLastResult)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := []testingResult{}
+	for _, res := range results {
+		got = append(got, *res.(*testingResult))
+	}
+	if diff := testingResultsDiff(want, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+
+	// each job has a start and a final event
+	starts, ends := 0, 0
+	for _, e := range events {
+		switch {
+		case e.Type() == EventStart:
+			starts++
+		case IsResult(e):
+			ends++
+		}
+	}
+	if starts != 4 || ends != 4 {
+		t.Errorf("want 4 start and 4 result events, got %d and %d", starts, ends)
+	}
+	if len(events) != starts+ends {
+		t.Errorf("want %d events, got %d", starts+ends, len(events))
+	}
+
+	if _, _, err := eng.ExecuteAllWithEvents(context.Background(), Mode(-1)); err == nil {
+		t.Errorf("invalid mode: expected error, got nil")
+	}
+}
@@ -0,0 +1,35 @@
+package taskengine
+
+import "context"
+
+// The values of the context passed to the Execute methods are available
+// to the work functions, since the context of each job derives from it.
+// The helpers of this file give a type-safe way to read the run-scoped metadata
+// set by the application and the job metadata set by the engine.
+
+// runIDKey is the context key of the ID of the run.
+type runIDKey struct{}
+
+// WithRunID returns a copy of the context with the ID of the run,
+// i.e. a trace ID, to be passed to the Execute methods:
+// the work functions get it with RunIDFromContext.
+func WithRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey{}, id)
+}
+
+// RunIDFromContext returns the ID of the run set by WithRunID,
+// and whether it is set.
+func RunIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(runIDKey{}).(string)
+	return id, ok
+}
+
+// taskStatKey is the context key of the stat of the task of the job.
+type taskStatKey struct{}
+
+// TaskStatFromContext returns the stat of the task at the time the job was started,
+// as passed to the StatWorkFunc of the worker, and whether the context is of a job.
+func TaskStatFromContext(ctx context.Context) (TaskStat, bool) {
+	stat, ok := ctx.Value(taskStatKey{}).(TaskStat)
+	return stat, ok
+}
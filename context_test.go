@@ -0,0 +1,66 @@
+package taskengine
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunIDFromContext(t *testing.T) {
+	if _, ok := RunIDFromContext(context.Background()); ok {
+		t.Errorf("want no run ID")
+	}
+	ctx := WithRunID(context.Background(), "run-1")
+	if id, ok := RunIDFromContext(ctx); !ok || id != "run-1" {
+		t.Errorf("want run-1, got %q (%v)", id, ok)
+	}
+}
+
+func TestEngine_ContextMetadata(t *testing.T) {
+	type metadata struct {
+		RunID string
+		Stat  TaskStat
+	}
+	var mu sync.Mutex
+	got := map[TaskID]metadata{}
+	work := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		id, _ := RunIDFromContext(ctx)
+		stat, ok := TaskStatFromContext(ctx)
+		if !ok {
+			t.Errorf("%s: want the stat of the task", task.TaskID())
+		}
+		mu.Lock()
+		got[task.TaskID()] = metadata{id, stat}
+		mu.Unlock()
+		return testingWorkFn(ctx, worker, workerInst, task)
+	}
+
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: work},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := eng.ExecuteAll(WithRunID(context.Background(), "run-1"), AllResults); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := map[TaskID]metadata{
+		"t1": {"run-1", TaskStat{Todo: 0, Doing: 1}},
+		"t2": {"run-1", TaskStat{Todo: 0, Doing: 1}},
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("metadata mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := TaskStatFromContext(context.Background()); ok {
+		t.Errorf("want no stat out of a job")
+	}
+}
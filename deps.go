@@ -0,0 +1,103 @@
+package taskengine
+
+import (
+	"sort"
+	"strings"
+)
+
+// blocked returns true if the task has a dependency without a success result (see TaskWithDeps).
+// The dependencies not in the map, i.e. not tasks of the run, are considered satisfied.
+func (m taskStatMap) blocked(t Task) bool {
+	td, ok := t.(TaskWithDeps)
+	if !ok {
+		return false
+	}
+	for _, dep := range td.DependsOn() {
+		if stat, ok := m[dep]; ok && stat.Success == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// dependents returns, for each task, the tasks that depend on it.
+// Each dependent task is included once, even if assigned to many workers.
+func (wts WorkerTasks) dependents() map[TaskID]Tasks {
+	res := map[TaskID]Tasks{}
+	seen := map[TaskID]bool{}
+	for _, ts := range wts {
+		for _, t := range ts {
+			td, ok := t.(TaskWithDeps)
+			if !ok || seen[t.TaskID()] {
+				continue
+			}
+			seen[t.TaskID()] = true
+			for _, dep := range td.DependsOn() {
+				res[dep] = append(res[dep], t)
+			}
+		}
+	}
+	return res
+}
+
+// checkDependencies returns a *ConfigError of DependencyCycle kind
+// if the dependencies of the tasks contain a cycle.
+func (wts WorkerTasks) checkDependencies() error {
+	// dependencies of each task
+	deps := map[TaskID][]TaskID{}
+	for _, ts := range wts {
+		for _, t := range ts {
+			if td, ok := t.(TaskWithDeps); ok {
+				deps[t.TaskID()] = append(deps[t.TaskID()], td.DependsOn()...)
+			}
+		}
+	}
+
+	// depth first search, in order of TaskID for a deterministic error
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[TaskID]int{}
+	var path []TaskID
+	var visit func(tid TaskID) []TaskID
+	visit = func(tid TaskID) []TaskID {
+		switch state[tid] {
+		case visiting:
+			// the cycle is the path from the first occurrence of the task
+			for j, p := range path {
+				if p == tid {
+					return append(append([]TaskID(nil), path[j:]...), tid)
+				}
+			}
+		case visited:
+			return nil
+		}
+		state[tid] = visiting
+		path = append(path, tid)
+		for _, dep := range deps[tid] {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		state[tid] = visited
+		return nil
+	}
+
+	tids := make([]TaskID, 0, len(deps))
+	for tid := range deps {
+		tids = append(tids, tid)
+	}
+	sort.Slice(tids, func(i, j int) bool { return tids[i] < tids[j] })
+	for _, tid := range tids {
+		if cycle := visit(tid); cycle != nil {
+			names := make([]string, len(cycle))
+			for j, c := range cycle {
+				names[j] = string(c)
+			}
+			return &ConfigError{Kind: DependencyCycle, Detail: strings.Join(names, " -> ")}
+		}
+	}
+	return nil
+}
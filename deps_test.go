@@ -0,0 +1,140 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// testingDepsTask is a testingTask with dependencies.
+type testingDepsTask struct {
+	*testingTask
+	deps []TaskID
+}
+
+func (t *testingDepsTask) DependsOn() []TaskID { return t.deps }
+
+func testingDeps(tid string, msec int, success bool, deps ...TaskID) Task {
+	return &testingDepsTask{&testingTask{tid, msec, success}, deps}
+}
+
+func TestWorkerTasks_checkDependencies(t *testing.T) {
+	tests := map[string]struct {
+		wts   WorkerTasks
+		cycle string
+	}{
+		"no dependencies": {
+			wts: WorkerTasks{"w1": {&testingTask{"t1", 0, true}}},
+		},
+		"chain": {
+			wts: WorkerTasks{
+				"w1": {testingDeps("t1", 0, true), testingDeps("t2", 0, true, "t1")},
+				"w2": {testingDeps("t3", 0, true, "t1", "t2")},
+			},
+		},
+		"not a task of the run": {
+			wts: WorkerTasks{"w1": {testingDeps("t1", 0, true, "t9")}},
+		},
+		"self": {
+			wts:   WorkerTasks{"w1": {testingDeps("t1", 0, true, "t1")}},
+			cycle: "t1 -> t1",
+		},
+		"cycle": {
+			wts: WorkerTasks{
+				"w1": {testingDeps("t1", 0, true), testingDeps("t2", 0, true, "t3")},
+				"w2": {testingDeps("t3", 0, true, "t4"), testingDeps("t4", 0, true, "t1", "t2")},
+			},
+			cycle: "t2 -> t3 -> t4 -> t2",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := tt.wts.checkDependencies()
+			if tt.cycle == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var cerr *ConfigError
+			if !errors.As(err, &cerr) || cerr.Kind != DependencyCycle {
+				t.Fatalf("want DependencyCycle error, got %v", err)
+			}
+			if want := "dependency cycle: " + tt.cycle; err.Error() != want {
+				t.Errorf("want error %q, got %q", want, err.Error())
+			}
+		})
+	}
+}
+
+func TestNewEngine_DependencyCycle(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	wts := WorkerTasks{"w1": {testingDeps("t1", 0, true, "t2"), testingDeps("t2", 0, true, "t1")}}
+	_, err := NewEngine(workers, wts)
+	var cerr *ConfigError
+	if !errors.As(err, &cerr) || cerr.Kind != DependencyCycle {
+		t.Errorf("want DependencyCycle error, got %v", err)
+	}
+}
+
+func TestEngine_TaskWithDeps(t *testing.T) {
+	workFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		return testingWorkFn(ctx, worker, workerInst, task.(*testingDepsTask).testingTask)
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 3, Work: workFn},
+		{WorkerID: "w2", Instances: 1, Work: workFn},
+	}
+	wts := WorkerTasks{
+		"w1": {
+			testingDeps("t3", 10, true, "t1", "t2"),
+			testingDeps("t2", 10, true, "t1"),
+			testingDeps("t1", 30, true),
+			testingDeps("t5", 10, false),
+		},
+		"w2": {
+			testingDeps("t4", 10, true, "t5"),
+		},
+	}
+	eng, err := NewEngine(workers, wts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	success := map[TaskID]*Event{}
+	for e := range out {
+		tid := e.Task.TaskID()
+		switch e.Type() {
+		case EventStart:
+			for _, dep := range e.Task.(TaskWithDeps).DependsOn() {
+				s, ok := success[dep]
+				if !ok {
+					t.Errorf("%s started before the success of its dependency %s", tid, dep)
+					continue
+				}
+				if e.TimeEligible.Before(s.TimeEnd) {
+					t.Errorf("%s: eligible at %v, before the success of %s at %v", tid, e.TimeEligible, dep, s.TimeEnd)
+				}
+			}
+		case EventSuccess:
+			success[tid] = e
+		}
+	}
+
+	for _, tid := range []TaskID{"t1", "t2", "t3"} {
+		if success[tid] == nil {
+			t.Errorf("%s: want success, got none", tid)
+		}
+	}
+	// t4 is never started, since t5 fails
+	if success["t4"] != nil {
+		t.Errorf("t4: want no success, got %v", success["t4"])
+	}
+}
@@ -0,0 +1,134 @@
+package taskengine
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TaskWithDuration is a task with the duration of its execution
+// by the virtual clock of a deterministic run (see WithDeterministic).
+// The tasks without the Duration method take no time.
+type TaskWithDuration interface {
+	Task
+	Duration() time.Duration
+}
+
+// taskDuration returns the duration of the task in a deterministic run.
+func taskDuration(task Task) time.Duration {
+	if td, ok := task.(TaskWithDuration); ok {
+		return td.Duration()
+	}
+	return 0
+}
+
+// advancer is a Clock that can be advanced, as the FakeClock.
+type advancer interface {
+	Clock
+	Advance(time.Duration)
+}
+
+// WithDeterministic sets whether the engine executes the jobs one step at a time,
+// driven by a virtual clock, so that the order of the events is reproducible, i.e. for tests:
+//
+//   - the worker instances are offered their first task in order (see WithOrderedReadiness);
+//   - the engine waits for the Start event of each job before sending the next one;
+//   - the Work function of a single job at a time is called, in order of end time by the clock
+//     (i.e. the time of the start of the job plus the Duration of the task, see TaskWithDuration)
+//     and of dispatch of the jobs with the same end time;
+//   - the clock is advanced to the end time of the job before calling its Work function,
+//     and the next job is not called until the engine has handled the result.
+//
+// A job whose task is canceled meanwhile (i.e. after a success of another worker)
+// ends at the time of the cancellation, with the canceled context.
+// The clock of the engine must have an Advance method (see NewEngineWithClock):
+// with NewEngine, it is a FakeClock set to the current time.
+// The work functions must not wait for the clock, that is not advanced during a step;
+// the max number of concurrent Work calls is ignored (see WithMaxConcurrent).
+// The waits of the engine by the clock (i.e. the retry backoffs, the soft deadlines and the hard waits)
+// elapse as the clock is advanced, but their order with respect to the results is not deterministic.
+func WithDeterministic(enabled bool) Option {
+	return func(o *options) {
+		o.deterministic = enabled
+	}
+}
+
+// stepper executes the jobs of a deterministic run one at a time (see WithDeterministic).
+type stepper struct {
+	mu      sync.Mutex
+	clock   advancer
+	running int        // jobs sent to the worker instances and not yet released
+	waiting []*stepJob // jobs waiting for their step
+	seq     int        // order of registration of the next job
+	held    bool       // the result of the released job is not handled yet
+}
+
+// stepJob is a job waiting for its step.
+type stepJob struct {
+	ctx     context.Context
+	end     time.Time // end of the job by the clock
+	seq     int
+	release chan struct{}
+}
+
+// newStepper returns the stepper of a run, driving the clock.
+func newStepper(clock advancer) *stepper {
+	return &stepper{clock: clock}
+}
+
+// start counts the job sent to a worker instance.
+// It is called by the engine goroutine before sending the job.
+func (s *stepper) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.running++
+}
+
+// register saves the started job, lasting the duration by the clock,
+// and returns the chan closed when it is its step.
+func (s *stepper) register(ctx context.Context, d time.Duration) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := &stepJob{ctx: ctx, end: s.clock.Now().Add(d), seq: s.seq, release: make(chan struct{})}
+	s.seq++
+	s.waiting = append(s.waiting, j)
+	return j.release
+}
+
+// handled signals the result of the released job has been received by the engine.
+func (s *stepper) handled() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held = false
+}
+
+// step releases the next job, once the result of the previous one has been handled
+// and every job sent to the worker instances is waiting for its step.
+// It is called by the engine goroutine at the end of each iteration.
+func (s *stepper) step() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.held || len(s.waiting) == 0 || len(s.waiting) < s.running {
+		return
+	}
+	now := s.clock.Now()
+	next := -1
+	for i, j := range s.waiting {
+		if j.ctx.Err() != nil && j.end.After(now) {
+			// the job ends at the cancellation of its task
+			j.end = now
+		}
+		if next < 0 || j.end.Before(s.waiting[next].end) ||
+			(j.end.Equal(s.waiting[next].end) && j.seq < s.waiting[next].seq) {
+			next = i
+		}
+	}
+	j := s.waiting[next]
+	s.waiting = append(s.waiting[:next], s.waiting[next+1:]...)
+	s.running--
+	s.held = true
+	if d := j.end.Sub(now); d > 0 {
+		s.clock.Advance(d)
+	}
+	close(j.release)
+}
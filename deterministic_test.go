@@ -0,0 +1,101 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testingDurationTask is a testingTask lasting msec seconds of the clock of a deterministic run.
+type testingDurationTask struct {
+	testingTask
+}
+
+func (tt *testingDurationTask) Duration() time.Duration {
+	return time.Duration(tt.msec) * time.Second
+}
+
+// testingDurationWorkFn returns the result of the task at once.
+func testingDurationWorkFn(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+	t := task.(*testingDurationTask)
+	r := &testingResult{
+		Tid: t.taskid,
+		Wid: string(worker.WorkerID),
+	}
+	if err := ctx.Err(); err != nil {
+		r.Err = err
+	} else if !t.success {
+		r.Err = testingError
+	}
+	return r
+}
+
+func TestEngine_WithDeterministic(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingDurationWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingDurationWorkFn},
+	}
+	t1 := &testingDurationTask{testingTask{"t1", 4, true}}
+	t2 := &testingDurationTask{testingTask{"t2", 1, true}}
+	t3 := &testingDurationTask{testingTask{"t3", 2, false}}
+	wts := WorkerTasks{
+		"w1": {t1, t3},
+		"w2": {t2, t1},
+	}
+
+	type event struct {
+		Type      EventType
+		WorkerID  WorkerID
+		TaskID    TaskID
+		TimeStart int
+		TimeEnd   int
+	}
+	want := []event{
+		{EventStart, "w1", "t3", 0, 0},
+		{EventStart, "w2", "t2", 0, 0},
+		{EventSuccess, "w2", "t2", 0, 1},
+		{EventStart, "w2", "t1", 1, 1},
+		{EventError, "w1", "t3", 0, 2},
+		{EventStart, "w1", "t1", 2, 2},
+		{EventSuccess, "w2", "t1", 1, 5},
+		{EventCanceled, "w1", "t1", 2, 5}, // ends at the cancellation
+	}
+
+	// the events are the same in every run
+	for run := 0; run < 20; run++ {
+		eng, err := NewEngine(workers, wts, WithDeterministic(true))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		t0 := eng.clock.Now()
+		sec := func(tm time.Time) int { return int(tm.Sub(t0) / time.Second) }
+
+		out, err := eng.ExecuteEvents(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		var got []event
+		for e := range out {
+			if e.Type() == EventStart || IsResult(e) {
+				got = append(got, event{e.Type(), e.WorkerID, e.Task.TaskID(), sec(e.TimeStart), sec(e.TimeEnd)})
+			}
+		}
+		if diff := cmp.Diff(want, got); diff != "" {
+			t.Fatalf("run %d: events mismatch (-want +got):\n%s", run, diff)
+		}
+	}
+}
+
+func TestNewEngineWithClock_Deterministic(t *testing.T) {
+	workers := []*Worker{{WorkerID: "w1", Instances: 1, Work: testingDurationWorkFn}}
+	wts := WorkerTasks{"w1": {&testingDurationTask{testingTask{"t1", 1, true}}}}
+
+	if _, err := NewEngineWithClock(realClock{}, workers, wts, WithDeterministic(true)); err == nil {
+		t.Errorf("want error with a clock without the Advance method")
+	}
+	if _, err := NewEngineWithClock(NewFakeClock(time.Now()), workers, wts, WithDeterministic(true)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -11,7 +11,12 @@ package taskengine
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -37,50 +42,140 @@ const (
 	FirstSuccessOrLastResult
 )
 
+// checkMode returns an error if the mode is not one of the defined values.
+func checkMode(mode Mode) error {
+	if mode < AllResults || mode > FirstSuccessOrLastResult {
+		return fmt.Errorf("invalid mode: %d", mode)
+	}
+	return nil
+}
+
 // Engine type is the main struct used to execute the tasks.
 // It internally saves the inforations about the workers and the tasks of each worker.
+//
+// An engine can be executed many times, even concurrently: each run works on its own copy
+// of the tasks lists (see WithNoClone) with its own chans and stats,
+// while the state shared by the runs (i.e. the subscribers, the observed reliability
+// of the workers and the paused tasks) is safe for concurrent use.
+// The workers and the callbacks of the options are shared by the concurrent runs,
+// so they must be safe for concurrent use too.
 type Engine struct {
 	workers     map[WorkerID]*Worker
-	widtasks    WorkerTasks // map[WorkerID]*Tasks
-	workersList []*Worker   // original workers list
+	widtasks    WorkerTasks     // map[WorkerID]*Tasks
+	workersList []*Worker       // original workers list
+	opts        options         // optional settings
+	consumed    int32           // set to 1 when the tasks are consumed (see WithNoClone)
+	running     int32           // number of runs in progress
+	done        func()          // called at the end of each run, if not nil
+	subs        *subscribers    // subscribers of the events
+	reliab      *reliabilityMap // observed reliability of the workers
+	tracker     *runTracker     // executions and jobs in progress (see Shutdown)
+	paused      *pausedTasks    // tasks paused by PauseTask
+	slots       chan struct{}   // semaphore of the Work calls, if not nil (see WithMaxConcurrent)
+	clock       Clock           // source of the time (see NewEngineWithClock)
+
+	ctlMu sync.Mutex  // protects ctl
+	ctl   *runControl // control of the last run started, with parked idle instances
+
+	// startInstance, if not nil, replaces the goroutine of each worker instance,
+	// receiving the jobs from inputc and sending the outputs to outputc.
+	// NOTE: used by the tests to simulate an instance with more jobs in execution,
+	// whose results come back in any order.
+	startInstance func(wid WorkerID, inst int, inputc <-chan *jobInput, outputc chan<- *jobOutput)
 }
 
 // jobInput is the internal struct passed to a worker to execute a task.
 type jobInput struct {
+	id     uint64             // correlation ID of the job
 	ctx    context.Context    // task context
 	cancel context.CancelFunc // func to cancel task execution
 	task   Task               // task to be executed
 	outc   chan *jobOutput    // output channel
 	stat   TaskStat           // used for Start event
+	since  time.Time          // time the task became eligible
+	soft   time.Duration      // soft deadline of the job, if positive
+	jobID  JobID              // identifier of the job, used for the events
+
+	wid      WorkerID      // worker executing the job
+	instance int           // worker instance executing the job
+	abandon  time.Time     // time the job is abandoned, if not zero
+	graced   bool          // the cancel grace period of the job has been set
+	timeout  time.Duration // timeout of the job, if positive (see TaskWithTimeout)
+	sent     time.Time     // time the job is sent to the worker instance
+	retry    int           // number of the retry of the task by the worker
+
+	started chan struct{} // closed after the Start event, in a deterministic run
 }
 
 // jobOutput contains the result returned by the worker with the
-// WorkerID and instance in executing the given task.
+// WorkerID and instance in executing the job with the given correlation ID.
 // A nil result indicates that the worker instance is ready to perform a task.
 type jobOutput struct {
+	id        uint64 // correlation ID of the job, 0 if res is nil
 	res       Result // can be nil
 	wid       WorkerID
 	instance  int
-	task      Task // not used if res is nil
+	task      Task  // set by the engine from the job, not used if res is nil
+	jobID     JobID // set by the engine from the job, empty for a cached result
+	retry     int   // set by the engine from the job
 	timeStart time.Time
 	timeEnd   time.Time
+	since     time.Time // time the task became eligible
+
+	// cached is true if the result is taken from the cache
+	// instead of being returned by the worker.
+	cached bool
+
+	// unavailable is true if the worker instance could not acquire its resource
+	// and it will not execute any task.
+	unavailable bool
+
+	// stepped is true if the job has been released by the stepper of a deterministic run.
+	stepped bool
 }
 
 // NewEngine initialize a new engine object from the list of workers and the tasks of each worker.
-// It performs some sanity checks and returns error in case of incongruences.
-func NewEngine(ws []*Worker, wts WorkerTasks) (*Engine, error) {
+// It performs some sanity checks and returns a *ConfigError in case of incongruences.
+// The optional settings of the engine can be specified with the opts parameters.
+// No context is needed to build the engine: the context of each run is passed
+// to the Execute methods (i.e. Execute(ctx, mode) and ExecuteEvents(ctx)),
+// so that the same engine can be executed many times with different contexts.
+func NewEngine(ws []*Worker, wts WorkerTasks, opts ...Option) (*Engine, error) {
 
 	// check workers and build a map from workerid to Worker
 	workers := map[WorkerID]*Worker{}
-	for _, w := range ws {
+	for j, w := range ws {
+		if w == nil {
+			return nil, &ConfigError{Kind: NilWorker, Index: j}
+		}
 		if _, ok := workers[w.WorkerID]; ok {
-			return nil, fmt.Errorf("duplicate worker: WorkerID=%q", w.WorkerID)
+			return nil, &ConfigError{Kind: DuplicateWorker, WorkerID: w.WorkerID}
+		}
+		if w.Virtual {
+			if w.Lookup == nil {
+				return nil, &ConfigError{Kind: NilLookupFunc, WorkerID: w.WorkerID}
+			}
+			if w.Work != nil || w.WorkWithStat != nil {
+				return nil, &ConfigError{Kind: VirtualWorkFunc, WorkerID: w.WorkerID}
+			}
+			workers[w.WorkerID] = w
+			continue
 		}
 		if w.Instances <= 0 || w.Instances > maxInstances {
-			return nil, fmt.Errorf("instances must be in 1..%d range: WorkerID=%q", maxInstances, w.WorkerID)
+			return nil, &ConfigError{Kind: InvalidInstances, WorkerID: w.WorkerID}
 		}
-		if w.Work == nil {
-			return nil, fmt.Errorf("work function cannot be nil: WorkerID=%q", w.WorkerID)
+		if w.Work == nil && w.WorkWithStat == nil {
+			return nil, &ConfigError{Kind: NilWorkFunc, WorkerID: w.WorkerID}
+		}
+		if w.InstanceWeights != nil {
+			if len(w.InstanceWeights) != w.Instances {
+				return nil, &ConfigError{Kind: InvalidInstanceWeights, WorkerID: w.WorkerID}
+			}
+			for _, weight := range w.InstanceWeights {
+				if weight <= 0 {
+					return nil, &ConfigError{Kind: InvalidInstanceWeights, WorkerID: w.WorkerID}
+				}
+			}
 		}
 		workers[w.WorkerID] = w
 	}
@@ -95,17 +190,54 @@ func NewEngine(ws []*Worker, wts WorkerTasks) (*Engine, error) {
 		}
 		// check the worker exists
 		if _, ok := workers[wid]; !ok {
-			return nil, fmt.Errorf("tasks for undefined worker: WorkerID=%q", wid)
+			return nil, &ConfigError{Kind: UndefinedWorker, WorkerID: wid}
+		}
+		if err := ts.check(wid); err != nil {
+			return nil, err
 		}
 		// save the task list of the worker in the engine
 		widtasks[wid] = ts
 	}
+	if err := widtasks.checkDependencies(); err != nil {
+		return nil, err
+	}
 
-	return &Engine{
+	eng := &Engine{
 		workers:     workers,
 		widtasks:    widtasks,
 		workersList: ws,
-	}, nil
+		subs:        newSubscribers(),
+		reliab:      newReliabilityMap(),
+		tracker:     newRunTracker(),
+		paused:      newPausedTasks(),
+		clock:       realClock{},
+	}
+	for _, opt := range opts {
+		opt(&eng.opts)
+	}
+	if err := eng.opts.validate(); err != nil {
+		return nil, err
+	}
+	if n := eng.opts.maxConcurrent; n > 0 {
+		eng.slots = make(chan struct{}, n)
+	}
+	if eng.opts.deterministic {
+		// the deterministic runs are driven by a virtual clock (see WithDeterministic)
+		eng.clock = NewFakeClock(time.Now())
+	}
+
+	// check the group limits
+	groups := map[string]bool{}
+	for _, w := range workers {
+		groups[w.Group] = true
+	}
+	for group, limit := range eng.opts.groupLimits {
+		if group == "" || !groups[group] || limit <= 0 {
+			return nil, &ConfigError{Kind: InvalidGroupLimit, Group: group}
+		}
+	}
+
+	return eng, nil
 }
 
 // FilterEventFunc returns a function that, given an *Event,
@@ -127,29 +259,168 @@ func FilterEventFunc(mode Mode) func(*Event) bool {
 // It calls the ExecuteEvents method and filters the returned results based on
 // the Mode parameter.
 func (eng *Engine) Execute(ctx context.Context, mode Mode) (chan Result, error) {
+	if err := checkMode(mode); err != nil {
+		return nil, err
+	}
+	return eng.executeFilter(ctx, eng.filterEventFunc(mode), nil)
+}
+
+// filterEventFunc returns the function to filter the results to be exported
+// based on the Mode parameter and the options of the engine.
+func (eng *Engine) filterEventFunc(mode Mode) func(*Event) bool {
+	if eng != nil && eng.opts.aggregator != nil {
+		return IsAggregated
+	}
+	return FilterEventFunc(mode)
+}
+
+// executeFilter returns a chan that receives the results
+// of the events that satisfy the exportResult function.
+// The result sent for each event is the one returned by the result function, if not nil,
+// otherwise the Result of the event.
+func (eng *Engine) executeFilter(ctx context.Context, exportResult func(*Event) bool, result func(*Event) Result) (chan Result, error) {
+	// the run is canceled if no result is produced within the idle timeout
+	// NOTE: a nil context is reported by the ExecuteEvents method.
+	cancel := context.CancelFunc(func() {})
+	if ctx != nil {
+		ctx, cancel = context.WithCancel(ctx)
+	}
 
 	// init the event chan
-	eventchan, err := eng.ExecuteEvents(ctx)
+	// NOTE: the stats are reported once the results are sent too.
+	report := &statsReport{}
+	eventchan, _, err := eng.executeEvents(ctx, report)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
-	// func to filter the results to be exported
-	exportResult := FilterEventFunc(mode)
-
 	// create the result chan
-	resultchan := make(chan Result)
+	resultchan := make(chan Result, eng.opts.resultBufferSize())
 
 	// goroutine that read input from the event chan
 	// write output to the result chan.
-	go func(eventc chan *Event, resultc chan Result, export func(*Event) bool) {
-		for e := range eventc {
+	go func(eventc chan *Event, resultc chan Result, export func(*Event) bool, opts *options) {
+		defer cancel()
+		defer report.report(opts)
+
+		send := func(e *Event) {
+			res := e.Result
+			if result != nil {
+				res = result(e)
+			}
+			start := time.Now()
+			resultc <- res
+			report.add(start)
+		}
+
+		// with an idle timeout, the timer is reset each time a result is produced
+		var idle <-chan time.Time
+		var idleTimer *time.Timer
+		if opts.resultIdleTimeout > 0 {
+			idleTimer = time.NewTimer(opts.resultIdleTimeout)
+			defer idleTimer.Stop()
+			idle = idleTimer.C
+		}
+		produced := func() {
+			if idleTimer == nil {
+				return
+			}
+			if !idleTimer.Stop() {
+				<-idleTimer.C
+			}
+			idleTimer.Reset(opts.resultIdleTimeout)
+		}
+
+		// with a reorder window, the results are buffered for the window duration
+		// and then sorted by the less function
+		reorder := opts.reorderWindow > 0 && opts.reorderLess != nil
+		var window []*Event
+		var windowEnd <-chan time.Time
+		flushWindow := func() {
+			opts.safeCall("ReorderLess", func() {
+				sort.SliceStable(window, func(i, j int) bool {
+					return opts.reorderLess(window[i].Result, window[j].Result)
+				})
+			})
+			for _, e := range window {
+				send(e)
+			}
+			window = nil
+			windowEnd = nil
+		}
+		emit := func(e *Event) {
+			if !reorder {
+				send(e)
+				return
+			}
+			if window == nil {
+				windowEnd = time.After(opts.reorderWindow)
+			}
+			window = append(window, e)
+		}
+
+		// with onCompletion, the results are buffered until the task is completed
+		onCompletion := opts.emitOnCompletion
+		pending := map[TaskID][]*Event{}
+		tids := []TaskID{} // tasks with pending results, in order of first result
+		flush := func(tid TaskID) {
+			for _, e := range pending[tid] {
+				emit(e)
+			}
+			delete(pending, tid)
+		}
+
+		handle := func(e *Event) {
+			if !onCompletion {
+				if export(e) {
+					produced()
+					emit(e)
+				}
+				return
+			}
+			if e.Task == nil {
+				// i.e. the Summary event
+				return
+			}
+			tid := e.Task.TaskID()
 			if export(e) {
-				resultc <- e.Result
+				produced()
+				if _, ok := pending[tid]; !ok {
+					tids = append(tids, tid)
+				}
+				pending[tid] = append(pending[tid], e)
+			}
+			if e.TaskStat.Completed() {
+				flush(tid)
+			}
+		}
+
+	loop:
+		for {
+			select {
+			case e, ok := <-eventc:
+				if !ok {
+					break loop
+				}
+				handle(e)
+			case <-windowEnd:
+				flushWindow()
+			case <-idle:
+				// stalled run: the run is canceled and the pending results are discarded
+				cancel()
+				close(resultc)
+				for range eventc {
+				}
+				return
 			}
 		}
+		for _, tid := range tids {
+			flush(tid)
+		}
+		flushWindow()
 		close(resultc)
-	}(eventchan, resultchan, exportResult)
+	}(eventchan, resultchan, exportResult, &eng.opts)
 
 	return resultchan, nil
 }
@@ -164,24 +435,90 @@ func (eng *Engine) Execute(ctx context.Context, mode Mode) (chan Result, error)
 // of execution, the ExecuteEvents method returns also the Start event
 // at the beginning of execution (with a nil result).
 func (eng *Engine) ExecuteEvents(ctx context.Context) (chan *Event, error) {
+	eventc, _, err := eng.executeEvents(ctx, nil)
+	return eventc, err
+}
+
+// executeEvents starts an execution of the engine, as the ExecuteEvents method,
+// and returns the handle of the execution too.
+// The stats of the execution are set in report before the event chan is closed: if nil,
+// they are reported by the execution itself, with the time blocked sending the events
+// (see WithRunStats), otherwise by the caller.
+func (eng *Engine) executeEvents(ctx context.Context, report *statsReport) (chan *Event, *RunHandle, error) {
 
 	if eng == nil {
-		return nil, fmt.Errorf("nil engine")
+		return nil, nil, fmt.Errorf("nil engine")
 	}
 	if ctx == nil {
-		return nil, fmt.Errorf("nil context")
+		return nil, nil, fmt.Errorf("nil context")
 	}
+	if eng.opts.noClone && !atomic.CompareAndSwapInt32(&eng.consumed, 0, 1) {
+		return nil, nil, fmt.Errorf("tasks already consumed")
+	}
+	atomic.AddInt32(&eng.running, 1)
+
+	// the execution can be canceled by the Shutdown method
+	ctx, cancelRun := context.WithCancel(ctx)
+	refreshc := make(chan chan struct{})
+	runID := eng.tracker.addRun(cancelRun, eng.clock.Now(), refreshc)
+
+	// the work functions get the clock of the engine (see ClockFromContext)
+	ctx = context.WithValue(ctx, clockKey{}, eng.clock)
 
 	// creates the Event channel
-	eventc := make(chan *Event)
+	eventc := make(chan *Event, eng.opts.resultBufferSize())
+
+	// creates the handle of the run
+	handle := newRunHandle(eng.workers)
+	handle.addTasks(eng.widtasks)
+
+	// emit sends the event to the subscribers and to the Event channel.
+	// NOTE: an abandoned job (see WithCancelGrace) can emit events after the end of the run:
+	// they are discarded, since the Event channel is closed.
+	var emitMu sync.RWMutex
+	eventsClosed := false
+	reportStats := report == nil
+	if reportStats {
+		report = &statsReport{}
+	}
+	emit := func(e *Event) {
+		emitMu.RLock()
+		defer emitMu.RUnlock()
+		if eventsClosed {
+			return
+		}
+		eng.subs.publish(e)
+		if !reportStats {
+			eventc <- e
+			return
+		}
+		start := time.Now()
+		eventc <- e
+		report.add(start)
+	}
 
 	// creates the *jobOutput channel
 	outputc := make(chan *jobOutput)
 
-	// creates the *jobInput chan of each worker
-	inputc := map[WorkerID](chan *jobInput){}
-	for wid := range eng.workers {
-		inputc[wid] = make(chan *jobInput)
+	// a deterministic run executes the jobs one step at a time (see WithDeterministic)
+	var st *stepper
+	if eng.opts.deterministic {
+		st = newStepper(eng.clock.(advancer))
+	}
+
+	// creates the *jobInput chan of each worker instance,
+	// so that a job is executed by the instance it is sent to.
+	inputc := map[WorkerID][](chan *jobInput){}
+	for wid, w := range eng.workers {
+		for i := 0; i < w.instances(); i++ {
+			inputc[wid] = append(inputc[wid], make(chan *jobInput))
+		}
+	}
+
+	// with parked idle instances, the run receives the tasks added by AddTasks
+	var ctl *runControl
+	if eng.opts.parkIdleInstances {
+		ctl = eng.startControl()
 	}
 
 	// creates each task context
@@ -205,143 +542,1520 @@ func (eng *Engine) ExecuteEvents(ctx context.Context) (chan *Event, error) {
 	for _, worker := range eng.workersList {
 
 		// for each worker instances
-		for i := 0; i < worker.Instances; i++ {
+		for i := 0; i < worker.instances(); i++ {
+			if start := eng.startInstance; start != nil {
+				go start(worker.WorkerID, i, inputc[worker.WorkerID][i], outputc)
+				continue
+			}
 
 			go func(w *Worker, inst int, inputc <-chan *jobInput) {
+				// acquire the resource of the instance, if needed,
+				// before signaling the instance is ready to work.
+				// NOTE: a panic of the acquire function is handled as an error.
+				if acquire := eng.opts.acquire; acquire != nil {
+					var err error
+					if ok := eng.opts.safeCall("Acquire", func() { err = acquire(ctx, w.WorkerID) }); !ok || err != nil {
+						outputc <- &jobOutput{wid: w.WorkerID, instance: inst, unavailable: true}
+						return
+					}
+					if release := eng.opts.release; release != nil {
+						defer eng.opts.safeCall("Release", func() { release(w.WorkerID) })
+					}
+					outputc <- &jobOutput{wid: w.WorkerID, instance: inst}
+				}
+
 				for req := range inputc {
 
-					timeStart := time.Now()
+					// with a max concurrency, the job starts when a slot is free
+					// NOTE: a deterministic run executes a single job at a time.
+					var notStarted error
+					if st == nil {
+						notStarted = eng.acquireSlot(req.ctx)
+					}
+
+					// the job is tracked from its start event (see Shutdown and TaskElapsed)
+					timeStart := eng.clock.Now()
+					eng.tracker.startJob(req, timeStart)
 
 					// start event
 					event := &Event{
-						Task:       req.task,
-						WorkerID:   w.WorkerID,
-						WorkerInst: inst,
-						Result:     nil,
-						TaskStat:   req.stat,
-						TimeStart:  timeStart,
-						TimeEnd:    timeStart,
+						Task:         req.task,
+						WorkerID:     w.WorkerID,
+						WorkerInst:   inst,
+						Result:       nil,
+						TaskStat:     req.stat,
+						TimeStart:    timeStart,
+						TimeEnd:      timeStart,
+						TimeEligible: req.since,
+						JobID:        req.jobID,
+						Retry:        req.retry,
+					}
+					emit(event)
+					if logger := eng.opts.logger; logger != nil {
+						eng.opts.safeCall("Logger", func() { logger.OnStart(*event) })
+					}
+
+					// emit a Slow event if the job exceeds the soft deadline.
+					// NOTE: the result is sent only after the Slow event goroutine is terminated,
+					// so that the event chan is still open.
+					var stopSlow, slowDone chan struct{}
+					if req.soft > 0 {
+						stopSlow = make(chan struct{})
+						slowDone = make(chan struct{})
+						go func(event Event) {
+							defer close(slowDone)
+							timerc, stopTimer := eng.after(req.soft)
+							defer stopTimer()
+							select {
+							case <-timerc:
+								event.TimeEnd = eng.clock.Now()
+								event.kind = EventSlow
+								emit(&event)
+							case <-stopSlow:
+							}
+						}(*event)
 					}
-					eventc <- event
 
-					// get the worker result of the task
-					res := w.Work(req.ctx, w, inst, req.task)
+					// in a deterministic run, the job waits for its step
+					if st != nil {
+						step := st.register(req.ctx, taskDuration(req.task))
+						close(req.started)
+						<-step
+					}
+
+					// get the worker result of the task.
+					// NOTE: with a timeout, each attempt has its own context,
+					// released as soon as the work returns.
+					var res Result
+					if notStarted != nil {
+						res = &NotStartedResult{Err: notStarted}
+					} else {
+						jobctx, cancelJob := req.ctx, context.CancelFunc(func() {})
+						if req.timeout > 0 {
+							jobctx, cancelJob = context.WithTimeout(req.ctx, req.timeout)
+						}
+						res = eng.work(jobctx, w, inst, req.task, req.stat)
+						cancelJob()
+						if st == nil {
+							eng.releaseSlot()
+						}
+					}
+					eng.tracker.endJob(req)
+
+					if stopSlow != nil {
+						close(stopSlow)
+						<-slowDone
+					}
 
 					// send the result to the output chan
 					jout := jobOutput{
+						id:        req.id,
 						wid:       w.WorkerID,
 						instance:  inst,
 						res:       res,
-						task:      req.task,
 						timeStart: timeStart,
-						timeEnd:   time.Now(),
+						timeEnd:   eng.clock.Now(),
+						stepped:   st != nil,
 					}
 					req.outc <- &jout
 				}
-			}(worker, i, inputc[worker.WorkerID])
+			}(worker, i, inputc[worker.WorkerID][i])
 		}
 	}
 
 	// start a goroutine that, for each worker instance,
 	// send a void output to signal it is ready to work.
-	go func() {
-		for _, w := range eng.workersList {
-			wid := w.WorkerID
-			for i := 0; i < w.Instances; i++ {
-				jout := jobOutput{
-					wid:      wid,
-					instance: i,
-					res:      nil,
-				}
-				outputc <- &jout
+	// NOTE: with a resource to acquire, each instance signals by itself.
+	if eng.opts.acquire == nil {
+		// the workers are offered the tasks in order of priority and reliability, if needed
+		ws := eng.workersList
+		if eng.opts.reliabilityOrdering || hasPriorities(ws) {
+			ws = append([]*Worker(nil), ws...)
+			if eng.opts.reliabilityOrdering {
+				eng.reliab.sortWorkers(ws)
 			}
+			sortWorkersByPriority(ws)
 		}
-	}()
+		go func() {
+			for _, w := range ws {
+				wid := w.WorkerID
+				for i := 0; i < w.instances(); i++ {
+					jout := jobOutput{
+						wid:      wid,
+						instance: i,
+						res:      nil,
+					}
+					outputc <- &jout
+				}
+			}
+		}()
+	}
 
 	// main goroutine that handle the input and output from the workers
 	// and send the events to the event chan.
 	go func() {
-		// clone eng.widtasks
-		widtasks := eng.widtasks.Clone()
+		// clone eng.widtasks, unless the tasks can be consumed
+		widtasks := eng.widtasks
+		if !eng.opts.noClone {
+			widtasks = widtasks.Clone()
+		}
 
 		// init the status map from the WorkerTasks object
 		statMap := newTaskStatusMap(eng.widtasks)
+		runStats := RunStats{} // stats of the results, for the Summary event and WithRunStats
 
-		for !statMap.completed() {
+		// each task becomes eligible when it is added to the status map
+		eligible := map[TaskID]time.Time{}
+		now := eng.clock.Now()
+		for tid := range statMap {
+			eligible[tid] = now
+		}
+		// a task with dependencies becomes eligible again when they are satisfied
+		dependents := eng.widtasks.dependents()
 
-			// get the next output
-			o := <-outputc
+		// tasks already checked in the cache
+		cacheChecked := map[TaskID]bool{}
 
-			// handle result
-			if o.res != nil {
-				success := (o.res.Error() == nil)
-				tid := o.task.TaskID()
+		// position of the tasks in the list of each worker, in order of insertion (see WithOrderedPick)
+		position := map[WorkerID]map[TaskID]int{}
+		track := func(wid WorkerID, ts Tasks) {
+			if !eng.opts.orderedPick {
+				return
+			}
+			pos := position[wid]
+			if pos == nil {
+				pos = map[TaskID]int{}
+				position[wid] = pos
+			}
+			for _, t := range ts {
+				if _, ok := pos[t.TaskID()]; !ok {
+					pos[t.TaskID()] = len(pos)
+				}
+			}
+		}
+		for wid, ts := range widtasks {
+			track(wid, ts)
+		}
 
-				// updates task info map
-				statMap.done(tid, success)
+		// init the aggregator of the results, if needed
+		var aggr *aggregator
+		if eng.opts.aggregator != nil {
+			aggr = newAggregator(eng.opts.aggregator, eng.opts.aggregateQuorum, &eng.opts)
+		}
 
-				if success {
-					// call cancel func for the task context
-					taskcancel[tid]()
+		// number of worker instances that have to signal they are ready
+		// and number of available instances of each worker
+		notReady := 0
+		available := map[WorkerID]int{}
+		for _, w := range eng.workersList {
+			notReady += w.instances()
+			available[w.WorkerID] = w.instances()
+		}
+
+		// signalReady is called for each initial readiness signal
+		signalReady := func() {
+			notReady--
+			if notReady == 0 && eng.opts.onReady != nil && !eng.opts.orderedReadiness {
+				eng.opts.safeCall("OnReady", eng.opts.onReady)
+			}
+		}
+		if notReady == 0 && eng.opts.onReady != nil {
+			eng.opts.safeCall("OnReady", eng.opts.onReady)
+		}
+
+		// checkCompleted sends the TaskComplete event, if needed,
+		// the first time the task is completed.
+		completeSent := map[TaskID]bool{}
+		checkCompleted := func(task Task, wid WorkerID, inst int) {
+			tid := task.TaskID()
+			if !eng.opts.taskCompleteEvents || completeSent[tid] || !statMap[tid].Completed() {
+				return
+			}
+			completeSent[tid] = true
+			now := eng.clock.Now()
+			emit(&Event{
+				Task:         task,
+				WorkerID:     wid,
+				WorkerInst:   inst,
+				TaskStat:     *statMap[tid],
+				TimeStart:    now,
+				TimeEnd:      now,
+				TimeEligible: eligible[tid],
+				kind:         EventTaskComplete,
+			})
+		}
+
+		// jobs in execution
+		jobs := newJobRegistry()
+
+		// publishAttempts saves the jobs in execution of the task in the handle of the run
+		// (see RunHandle.ActiveAttempts)
+		publishAttempts := func(tid TaskID) {
+			var attempts []Attempt
+			for _, req := range jobs.ofTask(tid) {
+				attempts = append(attempts, Attempt{WorkerID: req.wid, Inst: req.instance})
+			}
+			handle.setAttempts(tid, attempts)
+		}
+
+		// cancelTask cancels the task context and, with a cancel grace period,
+		// sets the time each in-flight job of the task is abandoned.
+		cancelTask := func(tid TaskID) {
+			taskcancel[tid]()
+			grace := eng.opts.cancelGrace
+			if grace == nil {
+				return
+			}
+			now := eng.clock.Now()
+			for _, req := range jobs.ofTask(tid) {
+				if req.graced {
+					continue
 				}
+				req.graced = true
+				var d time.Duration
+				eng.opts.safeCall("CancelGrace", func() { d = grace(req.task) })
+				if at := now.Add(d); d > 0 && (req.abandon.IsZero() || at.Before(req.abandon)) {
+					req.abandon = at
+				}
+			}
+		}
 
-				// end event (success, error or canceled)
-				event := &Event{
-					Task:       o.task,
-					WorkerID:   o.wid,
-					WorkerInst: o.instance,
-					Result:     o.res,
-					TaskStat:   *statMap[tid],
-					TimeStart:  o.timeStart,
-					TimeEnd:    o.timeEnd,
+		// number of retries and of jobs of each task by each worker (see WithRetries)
+		type retryKey struct {
+			wid WorkerID
+			tid TaskID
+		}
+		retried := map[retryKey]int{}
+		dispatched := map[retryKey]int{}
+
+		// failed tasks waiting to be retried by the same worker instance (see RetryPolicy),
+		// by worker instance
+		type instanceKey struct {
+			wid      WorkerID
+			instance int
+		}
+		type retryJob struct {
+			o    *jobOutput // the waiting instance
+			task Task       // the task to retry
+			at   time.Time  // end of the backoff
+		}
+		retrying := map[instanceKey]*retryJob{}
+
+		// the run is drained: no task is started anymore (see RunHandle.Drain)
+		draining := false
+
+		// retryTask re-enqueues the failed task in the task list of the worker,
+		// if the task can be retried.
+		// With a retry policy, the task is reserved to the same instance, after the backoff.
+		// NOTE: the task is appended to the list, whose order doesn't matter
+		// since the tasks are picked by their stats (see Tasks.remove).
+		retryTask := func(o *jobOutput) {
+			tid := o.task.TaskID()
+			key := retryKey{o.wid, tid}
+			err := o.res.Error()
+			if err == nil || draining || o.cached || isCanceled(err) || errors.Is(err, ErrHardWait) {
+				return
+			}
+			w := eng.workers[o.wid]
+			if _, ok := inputc[o.wid]; !ok || retried[key] >= w.maxRetries(eng.opts.retries) {
+				return
+			}
+			if statMap[tid].Success > 0 || taskctx[tid].Err() != nil {
+				return
+			}
+			retried[key]++
+			statMap.todo(tid)
+			if w.Retry == nil {
+				widtasks[o.wid] = append(widtasks[o.wid], o.task)
+				return
+			}
+			var d time.Duration
+			if backoff := w.Retry.Backoff; backoff != nil {
+				eng.opts.safeCall("Backoff", func() { d = backoff(retried[key]) })
+			}
+			retrying[instanceKey{o.wid, o.instance}] = &retryJob{o: o, task: o.task, at: eng.clock.Now().Add(d)}
+		}
+
+		// handleResult updates the status of the task with the result of a job
+		// and sends the corresponding events.
+		handleResult := func(o *jobOutput) {
+			// validate the success result
+			if validate := eng.opts.validateResult; validate != nil && o.res.Error() == nil {
+				var err error
+				eng.opts.safeCall("ValidateResult", func() { err = validate(o.task, o.res) })
+				if err != nil {
+					o.res = &InvalidResult{Result: o.res, Err: err}
 				}
-				eventc <- event
 			}
 
-			// select the next task of the worker
+			success := (o.res.Error() == nil)
+			tid := o.task.TaskID()
+
+			// updates task info map
+			statMap.done(tid, success)
+			if success && statMap[tid].Success == 1 {
+				now := eng.clock.Now()
+				for _, t := range dependents[tid] {
+					if !statMap.blocked(t) {
+						eligible[t.TaskID()] = now
+					}
+				}
+			}
+
+			// observe the reliability of the worker
+			if !o.cached && !isCanceled(o.res.Error()) {
+				eng.reliab.add(o.wid, success)
+			}
+
+			// learn the affinity of the worker for the task
+			if success && !o.cached && eng.opts.affinity != nil {
+				eng.opts.affinity.Set(tid, o.wid)
+			}
+
+			// with an aggregator, the task is canceled when the quorum is reached
+			quorum := false
+			if aggr != nil {
+				quorum = aggr.add(tid, o.res)
+			}
+
+			if (aggr == nil && success) || quorum {
+				// call cancel func for the task context
+				cancelTask(tid)
+			}
+
+			// the first success of the task
+			if fn := eng.opts.onFirstSuccess; fn != nil && success && statMap[tid].Success == 1 {
+				eng.opts.safeCall("OnFirstSuccess", func() { fn(tid, o.res) })
+			}
+
+			// give up the task after too many attempts without success
+			if k := eng.opts.maxAttemptsPerTask; k > 0 {
+				if stat := statMap[tid]; stat.Done == k && stat.Success == 0 {
+					statMap.discard(tid, widtasks.removeTask(tid))
+					cancelTask(tid)
+				}
+			}
+
+			// retry the task with the same worker, after an error
+			retryTask(o)
+
+			// end event (success, error or canceled)
+			event := &Event{
+				Task:         o.task,
+				WorkerID:     o.wid,
+				WorkerInst:   o.instance,
+				Result:       o.res,
+				TaskStat:     *statMap[tid],
+				TimeStart:    o.timeStart,
+				TimeEnd:      o.timeEnd,
+				TimeEligible: o.since,
+				Cached:       o.cached,
+				JobID:        o.jobID,
+				Retry:        o.retry,
+			}
+			emit(event)
+			runStats.add(event)
+			if logger := eng.opts.logger; logger != nil {
+				eng.opts.safeCall("Logger", func() { logger.OnResult(*event) })
+			}
+
+			// aggregated event
+			if quorum || (aggr != nil && statMap[tid].Completed()) {
+				if res, ok := aggr.aggregate(tid); ok && res != nil {
+					emit(&Event{
+						Task:         o.task,
+						WorkerID:     o.wid,
+						WorkerInst:   o.instance,
+						Result:       res,
+						TaskStat:     *statMap[tid],
+						TimeStart:    o.timeEnd,
+						TimeEnd:      o.timeEnd,
+						TimeEligible: o.since,
+						kind:         EventAggregated,
+					})
+				}
+			}
+
+			checkCompleted(o.task, o.wid, o.instance)
+		}
+
+		// lookupTasks resolves the tasks of the virtual worker
+		lookupTasks := func(w *Worker, ts Tasks) {
+			for _, t := range ts {
+				tid := t.TaskID()
+				// NOTE: a panic of the lookup function is a miss: the task is executed by the other workers
+				var res Result
+				var ok bool
+				eng.opts.safeCall("Lookup", func() { res, ok = w.Lookup(t) })
+				if !ok {
+					statMap.discard(tid, 1)
+					checkCompleted(t, w.WorkerID, 0)
+					continue
+				}
+				// the task is not executed by any other worker
+				statMap.doing(tid)
+				statMap.discard(tid, widtasks.removeTask(tid))
+				now := eng.clock.Now()
+				handleResult(&jobOutput{
+					res:       res,
+					wid:       w.WorkerID,
+					task:      t,
+					timeStart: now,
+					timeEnd:   now,
+					since:     eligible[tid],
+					cached:    true,
+				})
+			}
+		}
+
+		// resolve the tasks of the virtual workers
+		for _, w := range eng.workersList {
+			if !w.Virtual {
+				continue
+			}
+			ts := widtasks[w.WorkerID]
+			delete(widtasks, w.WorkerID)
+			lookupTasks(w, ts)
+		}
+
+		// discardTasks discards the remaining tasks of the worker.
+		discardTasks := func(wid WorkerID, inst int) {
+			ts := widtasks[wid]
+			delete(widtasks, wid)
+			for _, t := range ts {
+				statMap.discard(t.TaskID(), 1)
+				checkCompleted(t, wid, inst)
+			}
+		}
+
+		// closeWorker closes the chans of the worker instances, if still open.
+		// NOTE: in case of a worker with two or more instances,
+		// the close of the channels must be called only once.
+		// Else get the error:
+		//	  panic: close of closed channel
+		closeWorker := func(wid WorkerID) {
+			chs, ok := inputc[wid]
+			if !ok {
+				return
+			}
+			for _, ch := range chs {
+				close(ch)
+			}
+			delete(inputc, wid)
+			handle.closeWorker(wid)
+			if logger := eng.opts.logger; logger != nil {
+				eng.opts.safeCall("Logger", func() { logger.OnWorkerClose(wid) })
+			}
+		}
+
+		// dropWorker discards the remaining tasks of the worker
+		// and closes the worker chans.
+		dropWorker := func(wid WorkerID, inst int) {
+			discardTasks(wid, inst)
+			closeWorker(wid)
+		}
+
+		// idle worker instances
+		var idle []*jobOutput
+
+		// with parked idle instances, the run goes on until the context is canceled
+		// and the instances of the workers without tasks wait for new tasks (see WithParkIdleInstances)
+		parking := ctl != nil
+		standby := map[WorkerID][]*jobOutput{}
+
+		// number of abandoned jobs whose result has not been received yet
+		abandoned := 0
+
+		// tasks being done by at least a worker (see WithMaxActiveTasks)
+		active := map[TaskID]bool{}
+
+		// state of the weighted round-robin of the instances (see Worker.InstanceWeights):
+		// number of jobs in execution, tasks executed in the current round
+		// and parked instances of each worker
+		busy := map[WorkerID]int{}
+
+		// number of jobs in execution of each group of workers (see WithGroupLimits)
+		groupBusy := map[string]int{}
+		used := map[WorkerID][]int{}
+		parked := map[WorkerID][]*jobOutput{}
+
+		// overrideNext calls the NextTaskOverride function
+		// and returns the index of the task to execute or -1 if none.
+		overrideNext := func(wid WorkerID, ts Tasks, n int) int {
+			var chosen Task
+			candidates := append(Tasks(nil), ts...)
+			if !eng.opts.safeCall("NextTaskOverride", func() {
+				chosen = eng.opts.nextTaskOverride(wid, ts[n], candidates)
+			}) {
+				return n
+			}
+			if chosen == nil {
+				return -1
+			}
+			for j, t := range ts {
+				if t.TaskID() == chosen.TaskID() {
+					return j
+				}
+			}
+			eng.opts.callbackError(fmt.Errorf("NextTaskOverride callback: task %q is not a candidate of worker %q", chosen.TaskID(), wid))
+			return n
+		}
+
+		// pickNext calls the Scheduler and returns the index
+		// of the task to execute or -1 if none.
+		// NOTE: the stats are copied only for a custom scheduler.
+		def := &defaultScheduler{statmap: statMap, affinity: eng.opts.affinity, position: position}
+		scheduler := eng.opts.scheduler
+		if isDefaultScheduler(scheduler) {
+			scheduler = def
+		}
+		pickNext := func(wid WorkerID, ts Tasks) int {
+			if scheduler == Scheduler(def) || len(ts) == 0 {
+				return def.Pick(wid, nil, ts)
+			}
+			stats := make(map[TaskID]TaskStat, len(ts))
+			for _, t := range ts {
+				stats[t.TaskID()] = *statMap[t.TaskID()]
+			}
+			n := -1
+			if !eng.opts.safeCall("Scheduler", func() { n = scheduler.Pick(wid, stats, ts) }) {
+				return def.Pick(wid, nil, ts)
+			}
+			if n >= len(ts) {
+				eng.opts.callbackError(fmt.Errorf("Scheduler callback: index %d out of range of the %d candidates of worker %q", n, len(ts), wid))
+				return def.Pick(wid, nil, ts)
+			}
+			if n < 0 {
+				return -1
+			}
+			return n
+		}
+
+		// waitingRetry returns true if a failed task of the worker will be retried,
+		// i.e. an instance is busy or waiting for a retry.
+		waitingRetry := func(wid WorkerID) bool {
+			if eng.workers[wid].maxRetries(eng.opts.retries) <= 0 {
+				return false
+			}
+			if busy[wid] > 0 {
+				return true
+			}
+			for key := range retrying {
+				if key.wid == wid {
+					return true
+				}
+			}
+			return false
+		}
+
+		// scheduling overhead of the run (see WithSchedulingStats)
+		var sched SchedulingStats
+
+		// dispatch sends the next task to the ready worker instance,
+		// or closes the worker chans if there are no more tasks.
+		dispatch := func(o *jobOutput) {
+			decisionStart := time.Now()
+
+			// the instance waits for the backoff of its retry,
+			// then the task to retry is given to the instance, if still needed
 			var nexttask Task
-			{
+			rkey := instanceKey{o.wid, o.instance}
+			if retry := retrying[rkey]; retry != nil {
+				if eng.clock.Now().Before(retry.at) {
+					return
+				}
+				delete(retrying, rkey)
+				if tid := retry.task.TaskID(); statMap[tid].Success > 0 || taskctx[tid].Err() != nil || draining {
+					statMap.discard(tid, 1)
+					checkCompleted(retry.task, o.wid, o.instance)
+				} else {
+					nexttask = retry.task
+				}
+			}
+			// requeue re-enqueues the task to retry in the task list of the worker,
+			// if it can't be given to the instance now
+			requeue := func() {
+				if nexttask != nil {
+					widtasks[o.wid] = append(widtasks[o.wid], nexttask)
+					nexttask = nil
+				}
+			}
+			if paused, _ := eng.paused.snapshot(); nexttask != nil && paused[nexttask.TaskID()] {
+				requeue()
+			}
+
+			// park the instance that has executed its share of tasks in the current round
+			weights := eng.workers[o.wid].InstanceWeights
+			if weights != nil && (len(widtasks[o.wid]) > 0 || nexttask != nil) {
+				if used[o.wid] == nil {
+					used[o.wid] = make([]int, len(weights))
+				}
+				if used[o.wid][o.instance] >= weights[o.instance] {
+					requeue()
+					parked[o.wid] = append(parked[o.wid], o)
+					return
+				}
+			}
+
+			// with the limit of the group reached, the worker instance is idle
+			// until a job of the group returns
+			group := eng.workers[o.wid].Group
+			if limit, ok := eng.opts.groupLimits[group]; ok && groupBusy[group] >= limit && (len(widtasks[o.wid]) > 0 || nexttask != nil) {
+				requeue()
+				idle = append(idle, o)
+				return
+			}
+
+			// select the next task of the worker
+			for nexttask == nil {
 				ts := widtasks[o.wid]
-				n := statMap.pick(ts)
-				if n >= 0 {
+
+				// with the max number of active tasks reached,
+				// only the active tasks can be picked (adding redundancy);
+				// the paused tasks and the ones with dependencies not satisfied are never picked
+				cands, idx := ts, []int(nil)
+				paused, _ := eng.paused.snapshot()
+				maxActive := eng.opts.maxActiveTasks > 0 && len(active) >= eng.opts.maxActiveTasks
+				excluded := func(t Task) bool {
+					tid := t.TaskID()
+					return (maxActive && !active[tid]) || paused[tid] || statMap.blocked(t)
+				}
+				filter := false
+				for _, t := range ts {
+					if excluded(t) {
+						filter = true
+						break
+					}
+				}
+				if filter {
+					cands = nil
+					for j, t := range ts {
+						if !excluded(t) {
+							cands = append(cands, t)
+							idx = append(idx, j)
+						}
+					}
+					if len(cands) == 0 && len(ts) > 0 {
+						// the worker instance is idle in this round
+						idle = append(idle, o)
+						return
+					}
+				}
+
+				n := pickNext(o.wid, cands)
+				if n < 0 && len(cands) > 0 {
+					// the worker instance is idle in this round
+					idle = append(idle, o)
+					return
+				}
+				if n >= 0 && eng.opts.nextTaskOverride != nil {
+					n = overrideNext(o.wid, cands, n)
+					if n < 0 {
+						// the worker instance is idle in this round
+						idle = append(idle, o)
+						return
+					}
+				}
+				if idx != nil && n >= 0 {
+					n = idx[n]
+				}
+				if n < 0 {
+					break
+				}
+				var logCands Tasks
+				if eng.opts.logger != nil {
+					// NOTE: the candidates can share the array of the tasks, changed by remove
+					logCands = append(Tasks(nil), cands...)
+				}
+				if eng.opts.orderedPick {
+					// the list keeps the order of insertion of the tasks
+					nexttask = ts.removeStable(n)
+				} else {
 					nexttask = ts.remove(n)
-					widtasks[o.wid] = ts
 				}
+				widtasks[o.wid] = ts
+				tid := nexttask.TaskID()
+				if logger := eng.opts.logger; logger != nil {
+					eng.opts.safeCall("Logger", func() { logger.OnPick(o.wid, tid, logCands) })
+				}
+
+				// drop the task never started that waited too long
+				if age := eng.opts.maxQueueAge; age > 0 {
+					if stat := statMap[tid]; stat.Doing == 0 && stat.Done == 0 && eng.clock.Now().Sub(eligible[tid]) > age {
+						statMap.discard(tid, 1+widtasks.removeTask(tid))
+						now := eng.clock.Now()
+						emit(&Event{
+							Task:         nexttask,
+							WorkerID:     o.wid,
+							WorkerInst:   o.instance,
+							TaskStat:     *statMap[tid],
+							TimeStart:    now,
+							TimeEnd:      now,
+							TimeEligible: eligible[tid],
+							kind:         EventExpired,
+						})
+						checkCompleted(nexttask, o.wid, o.instance)
+						nexttask = nil
+						continue
+					}
+				}
+
+				// check the cache the first time the task is picked
+				if eng.opts.cache == nil || cacheChecked[tid] {
+					break
+				}
+				cacheChecked[tid] = true
+				// NOTE: a panic of the cache function is a cache miss
+				var res Result
+				var ok bool
+				eng.opts.safeCall("Cache", func() { res, ok = eng.opts.cache(nexttask) })
+				if !ok {
+					break
+				}
+
+				// cache hit: the task is not executed by any worker
+				statMap.doing(tid)
+				statMap.discard(tid, widtasks.removeTask(tid))
+				now := eng.clock.Now()
+				handleResult(&jobOutput{
+					res:       res,
+					wid:       o.wid,
+					instance:  o.instance,
+					task:      nexttask,
+					timeStart: now,
+					timeEnd:   now,
+					since:     eligible[tid],
+					cached:    true,
+				})
+				nexttask = nil
 			}
 
 			if nexttask == nil {
-				// close the worker chan
-				// NOTE: in case of a worker with two or more instances,
-				// the close of the channel must be called only once.
-				// Else get the error:
-				//	  panic: close of closed channel
-				if ch, ok := inputc[o.wid]; ok {
-					close(ch)
-					delete(inputc, o.wid)
+				if waitingRetry(o.wid) {
+					// the instance waits for the failed tasks of the busy instances to be retried
+					idle = append(idle, o)
+					return
+				}
+				if parking {
+					// the instance waits for new tasks of the worker
+					standby[o.wid] = append(standby[o.wid], o)
+					return
 				}
 
+				// close the chans of the worker instances
+				closeWorker(o.wid)
+
 			} else {
 				tid := nexttask.TaskID()
 
 				// updates task info map
 				statMap.doing(tid)
+				active[tid] = true
 
 				// send the job to the worker
 				i := &jobInput{
-					ctx:    taskctx[tid],
-					cancel: taskcancel[tid],
-					task:   nexttask,
-					outc:   outputc,
-					stat:   *statMap[tid],
+					ctx:      taskctx[tid],
+					cancel:   taskcancel[tid],
+					task:     nexttask,
+					outc:     outputc,
+					stat:     *statMap[tid],
+					since:    eligible[tid],
+					wid:      o.wid,
+					instance: o.instance,
+				}
+				if soft := eng.opts.softDeadline; soft != nil {
+					eng.opts.safeCall("SoftDeadline", func() { i.soft = soft(nexttask) })
+				}
+				if tt, ok := nexttask.(TaskWithTimeout); ok {
+					i.timeout = tt.Timeout()
+				}
+				if hard := eng.opts.hardWait; hard != nil {
+					var d time.Duration
+					eng.opts.safeCall("HardWait", func() { d = hard(nexttask) })
+					if d > 0 {
+						i.abandon = eng.clock.Now().Add(d)
+					}
+				}
+				i.sent = eng.clock.Now()
+				i.retry = dispatched[retryKey{o.wid, tid}]
+				dispatched[retryKey{o.wid, tid}]++
+				id := jobs.add(i)
+				stat := statMap[tid]
+				i.jobID = newJobID(o.wid, tid, stat.Doing+stat.Done, id)
+				publishAttempts(tid)
+				if st != nil {
+					// the next job is sent after the Start event of this one
+					i.started = make(chan struct{})
+					st.start()
+				}
+				inputc[o.wid][o.instance] <- i
+				if st != nil {
+					<-i.started
 				}
-				inputc[o.wid] <- i
+				sched.add(time.Since(decisionStart))
+				busy[o.wid]++
+				groupBusy[group]++
+				if weights != nil {
+					used[o.wid][o.instance]++
+				}
+			}
+
+		}
 
+		// offer dispatches the tasks to the ready worker instances,
+		// in order of priority and reliability of their workers, if needed.
+		prioritized := hasPriorities(eng.workersList)
+		offer := func(ready []*jobOutput) {
+			if eng.opts.reliabilityOrdering {
+				eng.reliab.sortInstances(ready)
+			}
+			if prioritized {
+				sort.SliceStable(ready, func(i, j int) bool {
+					return eng.workers[ready[i].wid].Priority > eng.workers[ready[j].wid].Priority
+				})
+			}
+			for _, i := range ready {
+				dispatch(i)
 			}
 		}
 
-		close(outputc)
+		// addTasks adds the tasks to the run (see AddTasks)
+		// and offers them to the instances waiting for a task.
+		addTasks := func(wts WorkerTasks) error {
+			for _, ts := range wts {
+				for _, t := range ts {
+					if _, ok := statMap[t.TaskID()]; ok {
+						return fmt.Errorf("task %q already in the run", t.TaskID())
+					}
+				}
+			}
+			handle.addTasks(wts)
+			now := eng.clock.Now()
+			for _, ts := range wts {
+				for _, t := range ts {
+					tid := t.TaskID()
+					if _, ok := taskctx[tid]; !ok {
+						taskctx[tid], taskcancel[tid] = context.WithCancel(ctx)
+						eligible[tid] = now
+					}
+					statMap.todo(tid)
+				}
+			}
+			for wid, ts := range wts {
+				if _, ok := inputc[wid]; ok && !eng.workers[wid].Virtual {
+					widtasks[wid] = append(widtasks[wid], ts...)
+					track(wid, ts)
+				}
+			}
+			for wid, ts := range wts {
+				if w := eng.workers[wid]; w.Virtual {
+					lookupTasks(w, ts)
+				} else if _, ok := inputc[wid]; !ok {
+					// no instance of the worker can execute the tasks
+					for _, t := range ts {
+						statMap.discard(t.TaskID(), 1)
+						checkCompleted(t, wid, 0)
+					}
+				}
+			}
+
+			ready := idle
+			idle = nil
+			for wid := range wts {
+				ready = append(ready, standby[wid]...)
+				delete(standby, wid)
+			}
+			offer(ready)
+			return nil
+		}
+
+		// the progress snapshots are sent every interval and at the end of the run
+		var progressc <-chan time.Time
+		runStart := eng.clock.Now()
+		sendProgress := func() {
+			snap := newProgressSnapshot(statMap, runStart, eng.clock.Now())
+			eng.opts.safeCall("ProgressSnapshots", func() { eng.opts.progress(snap) })
+		}
+		if eng.opts.progressInterval > 0 && eng.opts.progress != nil {
+			ticker := time.NewTicker(eng.opts.progressInterval)
+			defer ticker.Stop()
+			progressc = ticker.C
+		}
+
+		// completed returns true if the run can end:
+		// every task is completed, or the completion predicate is satisfied
+		completed := func() bool {
+			if statMap.completed() {
+				return true
+			}
+			pred := eng.opts.completionPredicate
+			if pred == nil {
+				return false
+			}
+			stats := make(map[TaskID]TaskStat, len(statMap))
+			for tid, stat := range statMap {
+				stats[tid] = *stat
+			}
+			done := false
+			eng.opts.safeCall("CompletionPredicate", func() { done = pred(stats) })
+			return done
+		}
+
+		// stopc is closed when the run must end, with parked idle instances
+		var stopc <-chan struct{}
+		if parking {
+			stopc = ctx.Done()
+		}
+
+		// handleRequest executes the request of the handle of the run (see RunHandle)
+		handleRequest := func(req *runRequest) {
+			if req.drain {
+				// the remaining tasks are discarded and the instances are closed once idle;
+				// the instances waiting for a retry are released at the end of the iteration
+				draining = true
+				if parking {
+					parking = false
+					stopc = nil
+					eng.stopControl(ctl)
+				}
+				wids := make([]WorkerID, 0, len(widtasks))
+				for wid := range widtasks {
+					wids = append(wids, wid)
+				}
+				sort.Slice(wids, func(i, j int) bool { return wids[i] < wids[j] })
+				for _, wid := range wids {
+					discardTasks(wid, 0)
+				}
+				ready := idle
+				idle = nil
+				for wid, ps := range standby {
+					delete(standby, wid)
+					ready = append(ready, ps...)
+				}
+				offer(ready)
+				return
+			}
+			if req.add != nil {
+				if err := addTasks(req.add); err != nil {
+					eng.opts.callbackError(fmt.Errorf("AddTask: %w", err))
+				}
+				return
+			}
+			tid := req.cancel
+			stat, ok := statMap[tid]
+			if !ok || stat.Completed() {
+				return
+			}
+			// the task is not started by other workers:
+			// the jobs in execution return their canceled results as usual
+			var task Task
+			var wid WorkerID
+			for w, ts := range widtasks {
+				for _, t := range ts {
+					if t.TaskID() == tid {
+						task, wid = t, w
+					}
+				}
+			}
+			statMap.discard(tid, widtasks.removeTask(tid))
+			cancelTask(tid)
+			if task != nil {
+				checkCompleted(task, wid, 0)
+			}
+		}
+
+		// with ordered readiness, the instances ready in the initial round
+		// are buffered until every instance has signaled (see WithOrderedReadiness)
+		warming := (eng.opts.orderedReadiness || st != nil) && notReady > 0
+		var warmup []*jobOutput
+
+		// NOTE: the loop goes on until every initial readiness signal has been received,
+		// else the goroutine sending them could block on (or send to) a closed channel.
+		// NOTE: the handle of the run is closed only without pending requests.
+		for notReady > 0 || !completed() || parking || !handle.tryClose() {
+
+			// get the next output,
+			// or wait until the first canceled job has to be abandoned,
+			// or the first failed task has to be retried,
+			// or the tasks added to the run
+			var o *jobOutput
+			var add *addRequest
+			var stopTimer, stopRetryTimer func()
+			var abandonc <-chan time.Time
+			if next, ok := jobs.nextAbandon(); ok {
+				abandonc, stopTimer = eng.after(next.Sub(eng.clock.Now()))
+			}
+			var retryc <-chan time.Time
+			var nextRetry time.Time
+			for _, r := range retrying {
+				if nextRetry.IsZero() || r.at.Before(nextRetry) {
+					nextRetry = r.at
+				}
+			}
+			if !nextRetry.IsZero() {
+				retryc, stopRetryTimer = eng.after(nextRetry.Sub(eng.clock.Now()))
+			}
+			var addc chan *addRequest
+			if parking {
+				addc = ctl.addc
+			}
+			_, resumedc := eng.paused.snapshot()
+			abandon, stop, tick, resumed, retryDue, requested := false, false, false, false, false, false
+			var published chan struct{}
+			select {
+			case o = <-outputc:
+				if o.stepped {
+					st.handled()
+				}
+			case <-abandonc:
+				abandon = true
+			case <-retryc:
+				retryDue = true
+			case add = <-addc:
+			case <-handle.notify:
+				requested = true
+			case <-stopc:
+				stop = true
+			case <-progressc:
+				tick = true
+			case <-resumedc:
+				resumed = true
+			case published = <-refreshc:
+			}
+			if stopTimer != nil {
+				stopTimer()
+			}
+			if stopRetryTimer != nil {
+				stopRetryTimer()
+			}
+
+			if stop || (add != nil && add.end) {
+				// the run ends (the context is canceled or no more tasks will be added):
+				// the waiting instances are released once the remaining tasks are completed
+				if add != nil {
+					add.errc <- nil
+				}
+				parking = false
+				stopc = nil
+				eng.stopControl(ctl)
+				for wid, ps := range standby {
+					delete(standby, wid)
+					for _, p := range ps {
+						dispatch(p)
+					}
+				}
+
+			} else if add != nil {
+				add.errc <- addTasks(add.wts)
+
+			} else if requested {
+				// the requests of the handle of the run
+				for _, req := range handle.take() {
+					handleRequest(req)
+				}
+
+			} else if abandon {
+				// handle the canceled jobs not returned within the grace period
+				// as canceled results, and the jobs not returned within the hard wait
+				// as error results: the worker instance is busy until the real result.
+				now := eng.clock.Now()
+				for _, req := range jobs.takeAbandoned(now) {
+					publishAttempts(req.task.TaskID())
+					abandoned++
+					busy[req.wid]--
+					groupBusy[eng.workers[req.wid].Group]--
+					var res Result = AbandonedResult{}
+					if req.ctx.Err() == nil {
+						res = HardWaitResult{}
+					}
+					handleResult(&jobOutput{
+						id:        req.id,
+						res:       res,
+						wid:       req.wid,
+						instance:  req.instance,
+						task:      req.task,
+						jobID:     req.jobID,
+						retry:     req.retry,
+						timeStart: now,
+						timeEnd:   now,
+						since:     req.since,
+					})
+					if tid := req.task.TaskID(); statMap[tid].Doing == 0 {
+						delete(active, tid)
+					}
+				}
+				// re-offer the tasks to the idle instances after a status change
+				ready := idle
+				idle = nil
+				offer(ready)
+
+			} else if tick {
+				sendProgress()
+
+			} else if resumed {
+				// offer the resumed tasks to the idle instances
+				ready := idle
+				idle = nil
+				offer(ready)
+
+			} else if retryDue {
+				// the failed tasks are retried at the end of the backoff (see below)
+
+			} else if published != nil {
+				// the state of the run is published at the end of the iteration (see below)
+
+			} else if o.unavailable {
+				// handle unavailable instance
+				available[o.wid]--
+				if available[o.wid] == 0 {
+					// no instance can execute the tasks of the worker
+					dropWorker(o.wid, o.instance)
+				}
+				signalReady()
+
+			} else {
+				// handle result
+				// NOTE: the job of the result is found by its correlation ID,
+				// not assuming it is the last job sent to the worker instance.
+				if o.res != nil {
+					if req, ok := jobs.take(o.id); ok {
+						publishAttempts(req.task.TaskID())
+						o.task = req.task
+						o.since = req.since
+						o.jobID = req.jobID
+						o.retry = req.retry
+						busy[o.wid]--
+						groupBusy[eng.workers[o.wid].Group]--
+						handleResult(o)
+						if tid := o.task.TaskID(); statMap[tid].Doing == 0 {
+							delete(active, tid)
+						}
+					} else {
+						// late result of an abandoned job
+						abandoned--
+					}
+				}
+
+				if o.res == nil && warming {
+					// the instance is offered a task at the end of the initial readiness round
+					warmup = append(warmup, o)
+				} else {
+					dispatch(o)
+				}
+
+				if o.res == nil {
+					// check the end of the initial readiness round
+					signalReady()
+				} else if len(idle) > 0 {
+					// re-offer the tasks to the idle instances after a status change
+					ready := idle
+					idle = nil
+					offer(ready)
+				}
+			}
+
+			// at the end of the initial readiness round, the ready instances
+			// are offered the tasks in order of WorkerID and instance
+			if warming && notReady == 0 {
+				warming = false
+				sort.SliceStable(warmup, func(i, j int) bool {
+					if warmup[i].wid != warmup[j].wid {
+						return warmup[i].wid < warmup[j].wid
+					}
+					return warmup[i].instance < warmup[j].instance
+				})
+				offer(warmup)
+				warmup = nil
+				if eng.opts.onReady != nil {
+					eng.opts.safeCall("OnReady", eng.opts.onReady)
+				}
+			}
+
+			// a new round starts for the workers with parked instances and no busy instance
+			for wid, ps := range parked {
+				if busy[wid] > 0 {
+					continue
+				}
+				delete(parked, wid)
+				used[wid] = make([]int, len(used[wid]))
+				for _, p := range ps {
+					dispatch(p)
+				}
+			}
+
+			// the instances waiting for a retry are offered the task after the backoff,
+			// or as soon as the task doesn't need the retry anymore
+			var retries []*retryJob
+			now := eng.clock.Now()
+			for _, r := range retrying {
+				tid := r.task.TaskID()
+				if !now.Before(r.at) || statMap[tid].Success > 0 || taskctx[tid].Err() != nil || draining {
+					r.at = now
+					retries = append(retries, r)
+				}
+			}
+			sort.Slice(retries, func(i, j int) bool {
+				if retries[i].o.wid != retries[j].o.wid {
+					return retries[i].o.wid < retries[j].o.wid
+				}
+				return retries[i].o.instance < retries[j].o.instance
+			})
+			for _, r := range retries {
+				dispatch(r.o)
+			}
+
+			// if no job is in execution, the idle instances will never get a task:
+			// the remaining tasks of their workers are discarded.
+			// The instances with a paused task wait for the task to be resumed.
+			if jobs.len() == 0 && len(retrying) == 0 && notReady == 0 && len(idle) > 0 {
+				paused, _ := eng.paused.snapshot()
+				var waiting []*jobOutput
+				for _, i := range idle {
+					if hasPaused(widtasks[i.wid], paused) {
+						waiting = append(waiting, i)
+					} else if parking {
+						discardTasks(i.wid, i.instance)
+						standby[i.wid] = append(standby[i.wid], i)
+					} else {
+						dropWorker(i.wid, i.instance)
+					}
+				}
+				idle = waiting
+			}
+
+			// publish the state of the run, if requested (see WouldBenefitFromMoreWorkers, Preview and Snapshot)
+			if published != nil {
+				idleTasks := map[WorkerID]Tasks{}
+				for _, i := range idle {
+					idleTasks[i.wid] = append(Tasks(nil), widtasks[i.wid]...)
+				}
+				for wid := range parked {
+					idleTasks[wid] = append(Tasks(nil), widtasks[wid]...)
+				}
+				eng.tracker.setState(runID, statMap, idleTasks, jobs.snapshot())
+				close(published)
+			}
+
+			// the next job of a deterministic run is executed
+			// once the initial readiness round is over
+			if st != nil && notReady == 0 {
+				st.step()
+			}
+		}
+
+		// NOTE: the run ends before closing the event chan,
+		// so that the engine is not busy once the consumer has received every event.
+		if ctl != nil {
+			eng.stopControl(ctl)
+		}
+		eng.tracker.removeRun(runID)
+		cancelRun()
+		if progressc != nil {
+			sendProgress()
+		}
+		if fn := eng.opts.schedulingStats; fn != nil {
+			eng.opts.safeCall("SchedulingStats", func() { fn(sched) })
+		}
+		atomic.AddInt32(&eng.running, -1)
+		if eng.done != nil {
+			eng.done()
+		}
+
+		if eng.opts.summaryEvent {
+			now := eng.clock.Now()
+			emit(&Event{
+				TimeStart: runStart,
+				TimeEnd:   now,
+				Summary:   newRunSummary(len(statMap), runStats, now.Sub(runStart)),
+				kind:      EventSummary,
+			})
+		}
+
+		// close the chans of the worker instances still open,
+		// i.e. the ones of the workers with an abandoned job or a job still in execution
+		for wid := range inputc {
+			closeWorker(wid)
+		}
+
+		emitMu.Lock()
+		eventsClosed = true
+		emitMu.Unlock()
+		report.stats = runStats
 		close(eventc)
+		if reportStats {
+			report.report(&eng.opts)
+		}
+
+		// NOTE: the output chan is closed after receiving the result of each abandoned job
+		// and of each job still in execution (see WithCompletionPredicate),
+		// else the worker instance would send to a closed channel.
+		if pending := abandoned + jobs.len(); pending == 0 {
+			close(outputc)
+		} else {
+			go func(n int) {
+				for ; n > 0; n-- {
+					<-outputc
+				}
+				close(outputc)
+			}(pending)
+		}
 	}()
 
-	return eventc, nil
+	return eventc, handle, nil
+}
+
+// ExecuteEvents is a convenience function that creates an engine
+// with the given workers, tasks and options, and executes it once.
+// It returns a chan that receives all the Events, as the Engine.ExecuteEvents method.
+// The workers and tasks are validated as by the NewEngine function.
+func ExecuteEvents(ctx context.Context, ws []*Worker, wts WorkerTasks, opts ...Option) (chan *Event, error) {
+	eng, err := NewEngine(ws, wts, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return eng.ExecuteEvents(ctx)
+}
+
+// RetryFailed executes again, with the same workers and options,
+// only the tasks that had no success in a previous run described by the report.
+// It returns a chan that receives the results, as the Execute method.
+// The engine is considered busy until the end of the retry (see TryExecute).
+// With WithNoClone, it returns an error once the tasks are consumed.
+func (eng *Engine) RetryFailed(ctx context.Context, report *RunReport, mode Mode) (chan Result, error) {
+	if eng == nil {
+		return nil, fmt.Errorf("nil engine")
+	}
+	if report == nil {
+		return nil, fmt.Errorf("nil report")
+	}
+
+	// NOTE: the tasks consumed by a previous run can't be retried (see WithNoClone).
+	if eng.opts.noClone && atomic.LoadInt32(&eng.consumed) != 0 {
+		return nil, fmt.Errorf("tasks already consumed")
+	}
+
+	failed := map[TaskID]bool{}
+	for _, tid := range report.Failed() {
+		failed[tid] = true
+	}
+	retry, err := eng.newRun(eng.widtasks.filter(func(tid TaskID) bool { return failed[tid] }))
+	if err != nil {
+		return nil, err
+	}
+
+	// the engine is busy until the end of the retry (see TryExecute)
+	atomic.AddInt32(&eng.running, 1)
+	retry.done = func() { atomic.AddInt32(&eng.running, -1) }
+	out, err := retry.Execute(ctx, mode)
+	if err != nil {
+		atomic.AddInt32(&eng.running, -1)
+		return nil, err
+	}
+	return out, nil
+}
+
+// TryExecute executes the given tasks with the workers and options of the engine,
+// unless a run of the engine (started by any Execute method) is already in progress.
+// If a run is in progress, it returns immediately with a false value, without errors;
+// otherwise it returns true and a chan that receives the results, as the Execute method.
+// The engine is considered busy until the end of the run started by TryExecute.
+// If wts is nil, the tasks of the engine are executed:
+// with WithNoClone, they are consumed as by the Execute methods.
+func (eng *Engine) TryExecute(ctx context.Context, wts WorkerTasks, mode Mode) (chan Result, bool, error) {
+	if eng == nil {
+		return nil, false, fmt.Errorf("nil engine")
+	}
+	if !atomic.CompareAndSwapInt32(&eng.running, 0, 1) {
+		return nil, false, nil
+	}
+	if wts == nil {
+		// NOTE: the run consumes the tasks of the engine (see WithNoClone).
+		if eng.opts.noClone && !atomic.CompareAndSwapInt32(&eng.consumed, 0, 1) {
+			atomic.AddInt32(&eng.running, -1)
+			return nil, false, fmt.Errorf("tasks already consumed")
+		}
+		wts = eng.widtasks
+	}
+	run, err := eng.newRun(wts)
+	if err != nil {
+		atomic.AddInt32(&eng.running, -1)
+		return nil, false, err
+	}
+	run.done = func() { atomic.AddInt32(&eng.running, -1) }
+
+	out, err := run.Execute(ctx, mode)
+	if err != nil {
+		atomic.AddInt32(&eng.running, -1)
+		return nil, false, err
+	}
+	return out, true, nil
+}
+
+// work returns the result of the work function of the worker for the task,
+// with the given stat of the task.
+// A panic of the work function is recovered as a PanicResult, unless disabled,
+// and a nil result is returned as a NilResult.
+func (eng *Engine) work(ctx context.Context, w *Worker, inst int, task Task, stat TaskStat) (res Result) {
+	if !eng.opts.noRecoverWorkPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				res = &PanicResult{Value: r, Stack: debug.Stack()}
+			}
+		}()
+	}
+	// the work functions get the stat of the task (see TaskStatFromContext)
+	ctx = context.WithValue(ctx, taskStatKey{}, stat)
+	if w.WorkWithStat != nil {
+		res = w.WorkWithStat(ctx, w, inst, task, stat)
+	} else {
+		res = w.Work(ctx, w, inst, task)
+	}
+	if res == nil {
+		// NOTE: a nil result would be handled as the readiness signal of the instance
+		return NilResult{}
+	}
+	return res
+}
+
+// acquireSlot waits for a free slot of the Work calls, if limited (see WithMaxConcurrent).
+// It returns the error of the context, if it is done before.
+func (eng *Engine) acquireSlot(ctx context.Context) error {
+	if eng.slots == nil {
+		return nil
+	}
+	select {
+	case eng.slots <- struct{}{}:
+		// NOTE: the slot could be acquired even if the context is done meanwhile.
+		if err := ctx.Err(); err != nil {
+			<-eng.slots
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// releaseSlot frees the slot acquired by acquireSlot.
+func (eng *Engine) releaseSlot() {
+	if eng.slots != nil {
+		<-eng.slots
+	}
+}
+
+// newRun returns a new engine to execute the given tasks
+// with the workers, options and subscribers of the engine.
+func (eng *Engine) newRun(wts WorkerTasks) (*Engine, error) {
+	run, err := NewEngine(eng.workersList, wts)
+	if err != nil {
+		return nil, err
+	}
+	run.opts = eng.opts
+	run.subs = eng.subs
+	run.reliab = eng.reliab
+	run.tracker = eng.tracker
+	run.paused = eng.paused
+	run.slots = eng.slots
+	run.clock = eng.clock
+	return run, nil
 }
@@ -3,7 +3,10 @@ package taskengine
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -24,45 +27,70 @@ func TestNewEngine(t *testing.T) {
 	}{
 		"duplicate worker": {
 			workers: []*Worker{
-				{"w1", 1, testingWorkFn},
-				{"w2", 2, testingWorkFn},
-				{"w1", 3, testingWorkFn},
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+				{WorkerID: "w1", Instances: 3, Work: testingWorkFn},
 			},
 			input: map[string]testingTasks{},
 			err:   errors.New("duplicate worker: WorkerID=\"w1\""),
 		},
 		"instances < 1": {
 			workers: []*Worker{
-				{"w1", 1, testingWorkFn},
-				{"w2", 2, testingWorkFn},
-				{"w3", 0, testingWorkFn},
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+				{WorkerID: "w3", Instances: 0, Work: testingWorkFn},
 			},
 			input: map[string]testingTasks{},
 			err:   errors.New("instances must be in 1..100 range: WorkerID=\"w3\""),
 		},
 		"instances > 100": {
 			workers: []*Worker{
-				{"w1", 1, testingWorkFn},
-				{"w2", 2, testingWorkFn},
-				{"w3", 101, testingWorkFn},
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+				{WorkerID: "w3", Instances: 101, Work: testingWorkFn},
 			},
 			input: map[string]testingTasks{},
 			err:   errors.New("instances must be in 1..100 range: WorkerID=\"w3\""),
 		},
 		"ko work function": {
 			workers: []*Worker{
-				{"w1", 1, testingWorkFn},
-				{"w2", 2, nil},
-				{"w3", 3, testingWorkFn},
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 2, Work: nil},
+				{WorkerID: "w3", Instances: 3, Work: testingWorkFn},
 			},
 			input: map[string]testingTasks{},
 			err:   errors.New("work function cannot be nil: WorkerID=\"w2\""),
 		},
+		"virtual worker without lookup": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "v1", Virtual: true},
+			},
+			input: map[string]testingTasks{},
+			err:   errors.New("lookup function cannot be nil for virtual worker: WorkerID=\"v1\""),
+		},
+		"virtual worker with work function": {
+			workers: []*Worker{
+				{WorkerID: "v1", Virtual: true, Lookup: testingLookup, Work: testingWorkFn},
+			},
+			input: map[string]testingTasks{},
+			err:   errors.New("work function must be nil for virtual worker: WorkerID=\"v1\""),
+		},
+		"virtual worker": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "v1", Virtual: true, Lookup: testingLookup},
+			},
+			input: map[string]testingTasks{
+				"v1": {{"t1", 0, true}},
+				"w1": {{"t1", 10, true}},
+			},
+		},
 		"undefined worker": {
 			workers: []*Worker{
-				{"w1", 1, testingWorkFn},
-				{"w2", 2, testingWorkFn},
-				{"w3", 3, testingWorkFn},
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+				{WorkerID: "w3", Instances: 3, Work: testingWorkFn},
 			},
 			input: map[string]testingTasks{
 				"w1":   {{"t3", 30, true}, {"t2", 20, true}, {"t1", 10, true}},
@@ -117,7 +145,7 @@ func TestEngine_ExecuteEvent_NilContext(t *testing.T) {
 	}
 }
 
-func TestEngine_ExecuteEvent(t *testing.T) {
+func TestEngine_ExecuteEvents(t *testing.T) {
 
 	tests := []struct {
 		name    string
@@ -128,7 +156,7 @@ func TestEngine_ExecuteEvent(t *testing.T) {
 		{
 			name: "one worker",
 			workers: []*Worker{
-				{"w1", 1, testingWorkFn},
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
 			},
 			input: map[string]testingTasks{
 				"w1": {{"t3", 30, true}, {"t2", 20, true}, {"t1", 10, false}},
@@ -145,7 +173,7 @@ func TestEngine_ExecuteEvent(t *testing.T) {
 		{
 			name: "one worker two instances",
 			workers: []*Worker{
-				{"w1", 2, testingWorkFn},
+				{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
 			},
 			input: map[string]testingTasks{
 				"w1": {{"t3", 30, true}, {"t2", 20, false}, {"t1", 10, false}},
@@ -159,9 +187,9 @@ func TestEngine_ExecuteEvent(t *testing.T) {
 		{
 			name: "three workers same task",
 			workers: []*Worker{
-				{"w1", 1, testingWorkFn},
-				{"w2", 2, testingWorkFn},
-				{"w3", 3, testingWorkFn},
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+				{WorkerID: "w3", Instances: 3, Work: testingWorkFn},
 			},
 			input: map[string]testingTasks{
 				"w1": {{"t1", 10, false}},
@@ -179,8 +207,8 @@ func TestEngine_ExecuteEvent(t *testing.T) {
 		{
 			name: "two workers",
 			workers: []*Worker{
-				{"w1", 1, testingWorkFn},
-				{"w2", 1, testingWorkFn},
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
 			},
 			input: map[string]testingTasks{
 				"w1": {{"t3", 10, true}, {"t2", 10, true}, {"t1", 10, false}},
@@ -198,9 +226,9 @@ func TestEngine_ExecuteEvent(t *testing.T) {
 		{
 			name: "three workers",
 			workers: []*Worker{
-				{"w1", 1, testingWorkFn},
-				{"w2", 1, testingWorkFn},
-				{"w3", 1, testingWorkFn},
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
 			},
 			input: map[string]testingTasks{
 				"w1": {{"t3", 30, false}, {"t2", 20, true}, {"t1", 6, true}},
@@ -274,9 +302,9 @@ func TestEngine_Execute_NilContext(t *testing.T) {
 
 func TestEngine_Execute_FirstSuccessOrLastResult(t *testing.T) {
 	workers := []*Worker{
-		{"w1", 1, testingWorkFn},
-		{"w2", 1, testingWorkFn},
-		{"w3", 1, testingWorkFn},
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
 	}
 
 	tests := map[string]struct {
@@ -409,10 +437,10 @@ func TestEngine_Execute_FirstSuccessOrLastResult(t *testing.T) {
 
 func TestEngine_Execute_UntilFirstSuccess(t *testing.T) {
 	workers := []*Worker{
-		{"w1", 1, testingWorkFn},
-		{"w2", 1, testingWorkFn},
-		{"w3", 1, testingWorkFn},
-		{"w4", 1, testingWorkFn},
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w4", Instances: 1, Work: testingWorkFn},
 	}
 
 	tests := map[string]struct {
@@ -488,10 +516,10 @@ func TestEngine_Execute_UntilFirstSuccess(t *testing.T) {
 
 func TestEngine_Execute_IsSuccessOrError(t *testing.T) {
 	workers := []*Worker{
-		{"w1", 1, testingWorkFn},
-		{"w2", 1, testingWorkFn},
-		{"w3", 1, testingWorkFn},
-		{"w4", 1, testingWorkFn},
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w4", Instances: 1, Work: testingWorkFn},
 	}
 
 	tests := map[string]struct {
@@ -554,10 +582,10 @@ func TestEngine_Execute_IsSuccessOrError(t *testing.T) {
 
 func TestEngine_Execute_AllResults(t *testing.T) {
 	workers := []*Worker{
-		{"w1", 1, testingWorkFn},
-		{"w2", 1, testingWorkFn},
-		{"w3", 1, testingWorkFn},
-		{"w4", 1, testingWorkFn},
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w4", Instances: 1, Work: testingWorkFn},
 	}
 
 	tests := map[string]struct {
@@ -627,10 +655,10 @@ func TestEngine_Execute_Mode(t *testing.T) {
 		`SuccessOrErrorResults` can return more success if they are simultaneous.
 	*/
 	workers := []*Worker{
-		{"w1", 1, testingWorkFn},
-		{"w2", 1, testingWorkFn},
-		{"w3", 1, testingWorkFn},
-		{"w4", 1, testingWorkFn},
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w4", Instances: 1, Work: testingWorkFn},
 	}
 
 	input := map[string]testingTasks{
@@ -711,8 +739,8 @@ func TestEngine_Execute_Mode_ConcurrentSuccess(t *testing.T) {
 	)
 
 	workers := []*Worker{
-		{"w0", 1, testingWorkFn},
-		{"w1", 1, testingWorkFn},
+		{WorkerID: "w0", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
 	}
 
 	input := map[string]testingTasks{
@@ -786,3 +814,897 @@ func TestEngine_Execute_Mode_ConcurrentSuccess(t *testing.T) {
 	}
 
 }
+
+func TestEngine_WithOnReady(t *testing.T) {
+	tests := map[string]struct {
+		workers []*Worker
+		input   map[string]testingTasks
+	}{
+		"no workers": {
+			workers: nil,
+			input:   nil,
+		},
+		"no tasks": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+			},
+			input: map[string]testingTasks{},
+		},
+		"some tasks": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+				{WorkerID: "w3", Instances: 3, Work: testingWorkFn},
+			},
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, true}, {"t2", 10, false}},
+				"w2": {{"t1", 20, true}},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			calls := 0
+			onReady := func() { calls++ }
+
+			wts := testingWorkerTasks(tt.input)
+			eng, err := NewEngine(tt.workers, wts, WithOnReady(onReady))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for range out {
+			}
+			if calls != 1 {
+				t.Errorf("OnReady: want 1 call, got %d", calls)
+			}
+		})
+	}
+}
+
+func TestEngine_RetryFailed(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}, {"t3", 10, false}},
+		"w2": {{"t3", 20, true}, {"t4", 10, false}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx := context.Background()
+	events, err := eng.ExecuteEvents(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	report := NewRunReport()
+	for e := range events {
+		report.Add(e)
+	}
+
+	out, err := eng.RetryFailed(ctx, report, AllResults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok, _ := eng.TryExecute(ctx, nil, AllResults); ok {
+		t.Errorf("engine busy: want false, got true")
+	}
+	results := []testingResult{}
+	for res := range out {
+		results = append(results, *res.(*testingResult))
+	}
+
+	want := []testingResultsGroup{
+		{{"w1", "t2", testingError}, {"w2", "t4", testingError}},
+	}
+	if diff := testingResultsDiff(want, results); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := eng.RetryFailed(ctx, nil, AllResults); err == nil {
+		t.Errorf("nil report: expecting error, got no error")
+	}
+
+	// the tasks of a noClone engine are consumed by the first run
+	eng, err = NewEngine(workers, testingWorkerTasks(input), WithNoClone(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, err = eng.ExecuteEvents(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range events {
+	}
+	if _, err := eng.RetryFailed(ctx, report, AllResults); err == nil {
+		t.Errorf("consumed tasks: expecting error, got no error")
+	}
+}
+
+func TestEngine_WithMaxAttemptsPerTask(t *testing.T) {
+	tests := map[string]struct {
+		max     int
+		workers []*Worker
+		input   map[string]testingTasks
+		want    []testingEventsGroup
+	}{
+		"cancel in-flight": {
+			max: 2,
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w4", Instances: 1, Work: testingWorkFn},
+			},
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, false}},
+				"w2": {{"t1", 20, false}},
+				"w3": {{"t1", 100, false}},
+				"w4": {{"t1", 200, true}},
+			},
+			want: []testingEventsGroup{
+				{{"w1", "t1", EventStart}, {"w2", "t1", EventStart}, {"w3", "t1", EventStart}, {"w4", "t1", EventStart}},
+				{{"w1", "t1", EventError}},
+				{{"w2", "t1", EventError}},
+				{{"w3", "t1", EventCanceled}, {"w4", "t1", EventCanceled}},
+			},
+		},
+		"stop picking": {
+			max: 2,
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+			},
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, false}},
+				"w2": {{"t1", 20, false}},
+				"w3": {{"t1", 10, true}, {"t2", 50, true}},
+			},
+			want: []testingEventsGroup{
+				{{"w1", "t1", EventStart}, {"w2", "t1", EventStart}, {"w3", "t2", EventStart}},
+				{{"w1", "t1", EventError}},
+				{{"w2", "t1", EventError}},
+				{{"w3", "t2", EventSuccess}},
+			},
+		},
+		"success before limit": {
+			max: 2,
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+			},
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, true}},
+				"w2": {{"t1", 20, false}},
+				"w3": {{"t1", 100, false}},
+			},
+			want: []testingEventsGroup{
+				{{"w1", "t1", EventStart}, {"w2", "t1", EventStart}, {"w3", "t1", EventStart}},
+				{{"w1", "t1", EventSuccess}},
+				{{"w2", "t1", EventCanceled}, {"w3", "t1", EventCanceled}},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			eng, err := NewEngine(tt.workers, testingWorkerTasks(tt.input), WithMaxAttemptsPerTask(tt.max))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events := []Event{}
+			for e := range out {
+				events = append(events, *e)
+			}
+			if diff := testingEventsDiff(tt.want, events); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEngine_ExecuteEvents_QueueWait(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 20, true}, {"t2", 20, true}, {"t3", 20, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	waits := []time.Duration{}
+	for e := range out {
+		if e.TimeEligible.IsZero() {
+			t.Errorf("%v: eligible time not set", e)
+		}
+		if e.Type() == EventStart {
+			waits = append(waits, e.QueueWait())
+		}
+	}
+
+	if len(waits) != 3 {
+		t.Fatalf("want 3 start events, got %d", len(waits))
+	}
+	// the tasks are executed one at a time by the only worker instance
+	for j := 1; j < len(waits); j++ {
+		if least := time.Duration(j) * 20 * time.Millisecond; waits[j] < least {
+			t.Errorf("task #%d: want queue wait >= %v, got %v", j, least, waits[j])
+		}
+	}
+}
+
+// testingLookup is the lookup function of a virtual worker
+// that finds only the tasks with success.
+func testingLookup(task Task) (Result, bool) {
+	t := task.(*testingTask)
+	return &testingResult{Tid: t.taskid, Wid: "v"}, t.success
+}
+
+func TestEngine_VirtualWorker(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "v1", Virtual: true, Lookup: testingLookup},
+		{WorkerID: "v2", Virtual: true, Lookup: testingLookup},
+	}
+	input := map[string]testingTasks{
+		"v1": {{"t1", 0, true}, {"t2", 0, false}},
+		"v2": {{"t1", 0, true}, {"t4", 0, true}},
+		"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := []Event{}
+	for e := range out {
+		events = append(events, *e)
+	}
+
+	want := []testingEventsGroup{
+		{{"v1", "t1", EventSuccess}},
+		{{"v2", "t4", EventSuccess}},
+		{{"w1", "t2", EventStart}},
+		{{"w1", "t2", EventSuccess}},
+		{{"w1", "t3", EventStart}},
+		{{"w1", "t3", EventSuccess}},
+	}
+	if diff := testingEventsDiff(want, events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_VirtualWorker_LookupPanic(t *testing.T) {
+	lookup := func(task Task) (Result, bool) {
+		if task.TaskID() == "t1" {
+			panic("lookup")
+		}
+		return testingLookup(task)
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "v1", Virtual: true, Lookup: lookup},
+	}
+	input := map[string]testingTasks{
+		"v1": {{"t1", 0, true}, {"t2", 0, true}},
+		"w1": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+	var errs []error
+	onError := func(err error) { errs = append(errs, err) }
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithOnCallbackError(onError))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := []Event{}
+	for e := range out {
+		events = append(events, *e)
+	}
+
+	// the panic is a miss: the task is executed by the other worker
+	want := []testingEventsGroup{
+		{{"v1", "t2", EventSuccess}},
+		{{"w1", "t1", EventStart}},
+		{{"w1", "t1", EventSuccess}},
+	}
+	if diff := testingEventsDiff(want, events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if len(errs) != 1 {
+		t.Errorf("want 1 callback error, got %v", errs)
+	}
+}
+
+func TestEngine_WithTaskCompleteEvents(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+		{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, false}, {"t2", 10, true}},
+		"w2": {{"t1", 20, true}, {"t3", 10, false}},
+		"w3": {{"t1", 30, true}, {"t3", 20, false}},
+	}
+
+	for _, enabled := range []bool{false, true} {
+		eng, err := NewEngine(workers, testingWorkerTasks(input), WithTaskCompleteEvents(enabled))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out, err := eng.ExecuteEvents(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		complete := map[TaskID]int{}
+		for e := range out {
+			tid := e.Task.TaskID()
+			if complete[tid] > 0 {
+				t.Errorf("enabled=%v: event %v after task complete", enabled, e)
+			}
+			if e.Type() == EventTaskComplete {
+				complete[tid]++
+				if !e.TaskStat.Completed() {
+					t.Errorf("enabled=%v: event %v: task not completed", enabled, e)
+				}
+				if IsResult(e) {
+					t.Errorf("enabled=%v: event %v: unexpected result", enabled, e)
+				}
+			}
+		}
+
+		want := map[TaskID]int{}
+		if enabled {
+			want = map[TaskID]int{"t1": 1, "t2": 1, "t3": 1}
+		}
+		if diff := cmp.Diff(want, complete); diff != "" {
+			t.Errorf("enabled=%v: mismatch (-want +got):\n%s", enabled, diff)
+		}
+	}
+}
+
+func TestEngine_WithNoClone(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t1", 20, true}, {"t2", 10, true}},
+	}
+	want := []testingResultsGroup{
+		{{"w1", "t1", nil}, {"w2", "t2", nil}},
+	}
+
+	ctx := context.Background()
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithNoClone(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.Execute(ctx, FirstSuccessOrLastResult)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results := []testingResult{}
+	for res := range out {
+		results = append(results, *res.(*testingResult))
+	}
+	if diff := testingResultsDiff(want, results); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// the tasks are consumed: the engine cannot be executed again
+	errmsg := "tasks already consumed"
+	_, err = eng.Execute(ctx, FirstSuccessOrLastResult)
+	if err == nil {
+		t.Errorf("expecting error, got no error")
+	} else if err.Error() != errmsg {
+		t.Errorf("expecting error %q, got error %q", errmsg, err)
+	}
+}
+
+func TestEngine_ExecuteEvents_StartDoing(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 50, false}},
+		"w2": {{"t1", 50, false}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the start events can be received in any order
+	doing := map[int]int{}
+	for e := range out {
+		if e.Type() == EventStart {
+			doing[e.TaskStat.Doing]++
+		}
+	}
+
+	want := map[int]int{1: 1, 2: 1}
+	if diff := cmp.Diff(want, doing); diff != "" {
+		t.Errorf("Start events Doing mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_ExecuteEvents_InstanceWeights(t *testing.T) {
+	tests := map[string]struct {
+		weights []int
+		want    map[int]int // instance -> number of executed tasks
+	}{
+		"equal": {
+			weights: []int{1, 1},
+			want:    map[int]int{0: 4, 1: 4},
+		},
+		"skewed": {
+			weights: []int{3, 1},
+			want:    map[int]int{0: 6, 1: 2},
+		},
+	}
+
+	input := map[string]testingTasks{"w1": {}}
+	for j := 1; j <= 8; j++ {
+		input["w1"] = append(input["w1"], &testingTask{fmt.Sprintf("t%d", j), 20, true})
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			workers := []*Worker{
+				{WorkerID: "w1", Instances: 2, Work: testingWorkFn, InstanceWeights: tt.weights},
+			}
+			eng, err := NewEngine(workers, testingWorkerTasks(input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := map[int]int{}
+			for e := range out {
+				if e.Type() == EventSuccess {
+					got[e.WorkerInst]++
+				}
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("tasks per instance mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEngine_TryExecute(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 100, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	wts := testingWorkerTasks(map[string]testingTasks{
+		"w1": {{"t2", 10, true}, {"t3", 10, true}},
+	})
+
+	drain := func(out chan Result) int {
+		n := 0
+		for range out {
+			n++
+		}
+		return n
+	}
+
+	// busy while Execute is running
+	out, err := eng.Execute(context.Background(), FirstSuccessOrLastResult)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok, err := eng.TryExecute(context.Background(), wts, FirstSuccessOrLastResult); ok || err != nil {
+		t.Errorf("engine busy: want false and no error, got %v and %v", ok, err)
+	}
+	drain(out)
+
+	// not busy after the run
+	out, ok, err := eng.TryExecute(context.Background(), wts, FirstSuccessOrLastResult)
+	if !ok || err != nil {
+		t.Fatalf("engine not busy: want true and no error, got %v and %v", ok, err)
+	}
+
+	// busy while TryExecute is running
+	if _, ok, _ := eng.TryExecute(context.Background(), nil, FirstSuccessOrLastResult); ok {
+		t.Errorf("engine busy: want false, got true")
+	}
+	if n := drain(out); n != 2 {
+		t.Errorf("want 2 results, got %d", n)
+	}
+
+	// the tasks of the engine
+	out, ok, err = eng.TryExecute(context.Background(), nil, FirstSuccessOrLastResult)
+	if !ok || err != nil {
+		t.Fatalf("engine not busy: want true and no error, got %v and %v", ok, err)
+	}
+	if n := drain(out); n != 1 {
+		t.Errorf("want 1 result, got %d", n)
+	}
+
+	// undefined worker
+	bad := testingWorkerTasks(map[string]testingTasks{"w9": {{"t1", 10, true}}})
+	if _, ok, err := eng.TryExecute(context.Background(), bad, FirstSuccessOrLastResult); ok || err == nil {
+		t.Errorf("want false and an error, got %v and %v", ok, err)
+	}
+
+	// the tasks of a noClone engine are consumed once
+	eng, err = NewEngine(workers, testingWorkerTasks(input), WithNoClone(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err = eng.Execute(context.Background(), FirstSuccessOrLastResult)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	drain(out)
+	if _, ok, err := eng.TryExecute(context.Background(), nil, FirstSuccessOrLastResult); ok || err == nil {
+		t.Errorf("consumed tasks: want false and an error, got %v and %v", ok, err)
+	}
+	out, ok, err = eng.TryExecute(context.Background(), wts, FirstSuccessOrLastResult)
+	if !ok || err != nil {
+		t.Fatalf("given tasks: want true and no error, got %v and %v", ok, err)
+	}
+	if n := drain(out); n != 2 {
+		t.Errorf("want 2 results, got %d", n)
+	}
+}
+
+func TestEngine_Execute_InvalidMode(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, mode := range []Mode{-1, FirstSuccessOrLastResult + 1} {
+		if _, err := eng.Execute(context.Background(), mode); err == nil {
+			t.Errorf("mode %d: expected error, got nil", mode)
+		}
+		if _, err := eng.ExecuteAll(context.Background(), mode); err == nil {
+			t.Errorf("mode %d: ExecuteAll expected error, got nil", mode)
+		}
+	}
+}
+
+func TestExecuteEvents(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t3", 10, true}},
+	}
+
+	out, err := ExecuteEvents(context.Background(), workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	count := map[EventType]int{}
+	for e := range out {
+		count[e.Type()]++
+	}
+	want := map[EventType]int{EventStart: 3, EventSuccess: 2, EventError: 1}
+	if diff := cmp.Diff(want, count); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// invalid input
+	input["w3"] = testingTasks{{"t4", 10, true}}
+	_, err = ExecuteEvents(context.Background(), workers, testingWorkerTasks(input))
+	var cerr *ConfigError
+	if !errors.As(err, &cerr) || cerr.Kind != UndefinedWorker {
+		t.Errorf("want UndefinedWorker error, got %v", err)
+	}
+
+	// nil context
+	if _, err := ExecuteEvents(nil, workers, nil); err == nil {
+		t.Errorf("nil context: expected error, got nil")
+	}
+}
+
+// testingTimeoutTask is a testingTask with a timeout.
+type testingTimeoutTask struct {
+	*testingTask
+	timeout time.Duration
+}
+
+func (t *testingTimeoutTask) Timeout() time.Duration { return t.timeout }
+
+func TestEngine_ExecuteEvents_TaskWithTimeout(t *testing.T) {
+	workFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		if tt, ok := task.(*testingTimeoutTask); ok {
+			task = tt.testingTask
+		}
+		return testingWorkFn(ctx, worker, workerInst, task)
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 3, Work: workFn},
+	}
+	wts := WorkerTasks{
+		"w1": {
+			&testingTimeoutTask{&testingTask{"t1", 300, true}, 30 * time.Millisecond},
+			&testingTimeoutTask{&testingTask{"t2", 10, true}, time.Second},
+			&testingTimeoutTask{&testingTask{"t3", 10, true}, 0},
+		},
+	}
+	eng, err := NewEngine(workers, wts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start := time.Now()
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := map[TaskID]EventType{}
+	for e := range out {
+		if IsResult(e) {
+			got[e.Task.TaskID()] = e.Type()
+			if e.Task.TaskID() == "t1" && !errors.Is(e.Result.Error(), context.DeadlineExceeded) {
+				t.Errorf("t1: want DeadlineExceeded error, got %v", e.Result.Error())
+			}
+			if e.Task.TaskID() == "t1" && IsSuccessOrError(e) {
+				t.Errorf("t1: want the timed out result filtered as canceled")
+			}
+		}
+	}
+	elapsed := time.Since(start)
+
+	want := map[TaskID]EventType{"t1": EventCanceled, "t2": EventSuccess, "t3": EventSuccess}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if elapsed >= 200*time.Millisecond {
+		t.Errorf("want the run to end after the timeout, got %v", elapsed)
+	}
+}
+
+func TestEngine_TaskWithTimeout_Canceled(t *testing.T) {
+	// the timed out job is handled as canceled:
+	// it is not retried, it doesn't lower the reliability of the worker
+	// and it doesn't count toward the quorum of the aggregator
+	workFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		return testingWorkFn(ctx, worker, workerInst, task.(*testingTimeoutTask).testingTask)
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: workFn},
+	}
+	// run executes the timed out task and returns the engine and the number of attempts
+	run := func(opts ...Option) (*Engine, int) {
+		wts := WorkerTasks{
+			"w1": {&testingTimeoutTask{&testingTask{"t1", 300, true}, 20 * time.Millisecond}},
+		}
+		eng, err := NewEngine(workers, wts, opts...)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out, err := eng.ExecuteEvents(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		starts := 0
+		for e := range out {
+			if e.Type() == EventStart {
+				starts++
+			}
+		}
+		return eng, starts
+	}
+
+	eng, starts := run(WithRetries(2))
+	if starts != 1 {
+		t.Errorf("want 1 attempt, got %d", starts)
+	}
+	if r := eng.Reliability()["w1"]; r.Failures != 0 {
+		t.Errorf("want no failures, got %+v", r)
+	}
+
+	var aggregated []Result
+	aggregate := func(tid TaskID, results []Result) Result {
+		aggregated = results
+		return &testingResult{Tid: string(tid)}
+	}
+	run(WithAggregator(1, aggregate))
+	if len(aggregated) != 0 {
+		t.Errorf("want no aggregated results, got %v", aggregated)
+	}
+}
+
+func TestEngine_ExecuteEvents_WorkPanic(t *testing.T) {
+	panicWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		if task.TaskID() == "t1" {
+			panic("bad task")
+		}
+		return testingWorkFn(ctx, worker, workerInst, task)
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: panicWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := map[TaskID]EventType{}
+	for e := range out {
+		if !IsResult(e) {
+			continue
+		}
+		got[e.Task.TaskID()] = e.Type()
+		if e.Task.TaskID() != "t1" {
+			continue
+		}
+		err := e.Result.Error()
+		if !errors.Is(err, ErrWorkerPanic) {
+			t.Errorf("t1: want ErrWorkerPanic, got %v", err)
+		}
+		if msg := err.Error(); !strings.Contains(msg, "bad task") || !strings.Contains(msg, "TestEngine_ExecuteEvents_WorkPanic") {
+			t.Errorf("t1: want the panic value and the stack trace in the error, got %q", msg)
+		}
+	}
+
+	want := map[TaskID]EventType{"t1": EventError, "t2": EventSuccess}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_ExecuteEvents_NilResult(t *testing.T) {
+	nilWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		if task.TaskID() == "t1" {
+			return nil
+		}
+		return testingWorkFn(ctx, worker, workerInst, task)
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: nilWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := map[TaskID]EventType{}
+	for e := range out {
+		if !IsResult(e) {
+			continue
+		}
+		got[e.Task.TaskID()] = e.Type()
+		if e.Task.TaskID() == "t1" && !errors.Is(e.Result.Error(), ErrNilResult) {
+			t.Errorf("t1: want ErrNilResult, got %v", e.Result.Error())
+		}
+	}
+
+	want := map[TaskID]EventType{"t1": EventError, "t2": EventSuccess}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_Execute_Concurrent(t *testing.T) {
+	type runKey struct{}
+
+	// runWorkFn returns a result marked with the run of the context
+	runWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		res := testingWorkFn(ctx, worker, workerInst, task).(*testingResult)
+		res.Wid = fmt.Sprintf("%s@%d", res.Wid, ctx.Value(runKey{}))
+		return res
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: runWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: runWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 20, true}, {"t2", 10, false}, {"t3", 30, true}},
+		"w2": {{"t2", 20, true}, {"t3", 10, true}, {"t4", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	const runs = 3
+	results := make([][]Result, runs)
+	errs := make([]error, runs)
+	done := make(chan struct{})
+	for r := 0; r < runs; r++ {
+		go func(r int) {
+			defer func() { done <- struct{}{} }()
+			ctx := context.WithValue(context.Background(), runKey{}, r)
+			results[r], errs[r] = eng.ExecuteAll(ctx, FirstSuccessOrLastResult)
+		}(r)
+	}
+	for r := 0; r < runs; r++ {
+		<-done
+	}
+
+	for r := 0; r < runs; r++ {
+		if errs[r] != nil {
+			t.Fatalf("run %d: unexpected error: %v", r, errs[r])
+		}
+		got := map[string]bool{}
+		for _, res := range results[r] {
+			tres := res.(*testingResult)
+			if !strings.HasSuffix(tres.Wid, fmt.Sprintf("@%d", r)) {
+				t.Errorf("run %d: result of another run: %v", r, tres)
+			}
+			if got[tres.Tid] {
+				t.Errorf("run %d: duplicate result of task %s", r, tres.Tid)
+			}
+			got[tres.Tid] = true
+		}
+		if len(got) != 4 {
+			t.Errorf("run %d: want a result for each of the 4 tasks, got %v", r, results[r])
+		}
+	}
+}
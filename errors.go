@@ -0,0 +1,141 @@
+package taskengine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ConfigErrorKind is the kind of a configuration error.
+type ConfigErrorKind int
+
+// Values of the kinds of configuration error.
+const (
+	// Two or more workers with the same WorkerID.
+	DuplicateWorker ConfigErrorKind = iota + 1
+
+	// Number of instances of the worker out of range.
+	InvalidInstances
+
+	// Nil work function of a worker.
+	NilWorkFunc
+
+	// Nil lookup function of a virtual worker.
+	NilLookupFunc
+
+	// Not nil work function of a virtual worker.
+	VirtualWorkFunc
+
+	// Tasks assigned to a worker not defined.
+	UndefinedWorker
+
+	// Instance weights of the worker not matching the instances, or not positive.
+	InvalidInstanceWeights
+
+	// Nil worker in the workers list.
+	NilWorker
+
+	// Options not compatible with each other.
+	IncompatibleOptions
+
+	// Group limit not positive, or of a group without workers.
+	InvalidGroupLimit
+
+	// Nil task in the task list of a worker.
+	NilTask
+
+	// Cycle in the dependencies of the tasks (see TaskWithDeps).
+	DependencyCycle
+)
+
+// ConfigError is the error returned by NewEngine
+// in case of incongruences of the workers or tasks.
+type ConfigError struct {
+	Kind     ConfigErrorKind
+	WorkerID WorkerID // the offending worker
+	Index    int      // index of the offending worker in the workers list, for NilWorker, or of the task in the worker's tasks, for NilTask
+	Detail   string   // description of the incompatibility, for IncompatibleOptions, or the cycle, for DependencyCycle
+	Group    string   // the offending group, for InvalidGroupLimit
+}
+
+// Error returns the description of the configuration error.
+func (e *ConfigError) Error() string {
+	switch e.Kind {
+	case DuplicateWorker:
+		return fmt.Sprintf("duplicate worker: WorkerID=%q", e.WorkerID)
+	case InvalidInstances:
+		return fmt.Sprintf("instances must be in 1..%d range: WorkerID=%q", maxInstances, e.WorkerID)
+	case NilWorkFunc:
+		return fmt.Sprintf("work function cannot be nil: WorkerID=%q", e.WorkerID)
+	case NilLookupFunc:
+		return fmt.Sprintf("lookup function cannot be nil for virtual worker: WorkerID=%q", e.WorkerID)
+	case VirtualWorkFunc:
+		return fmt.Sprintf("work function must be nil for virtual worker: WorkerID=%q", e.WorkerID)
+	case UndefinedWorker:
+		return fmt.Sprintf("tasks for undefined worker: WorkerID=%q", e.WorkerID)
+	case NilWorker:
+		return fmt.Sprintf("nil worker at index %d", e.Index)
+	case InvalidInstanceWeights:
+		return fmt.Sprintf("instance weights must be positive, one for each instance: WorkerID=%q", e.WorkerID)
+	case IncompatibleOptions:
+		return fmt.Sprintf("incompatible options: %s", e.Detail)
+	case InvalidGroupLimit:
+		return fmt.Sprintf("group limit must be positive, for a group of some worker: Group=%q", e.Group)
+	case NilTask:
+		return fmt.Sprintf("nil task at index %d: WorkerID=%q", e.Index, e.WorkerID)
+	case DependencyCycle:
+		return fmt.Sprintf("dependency cycle: %s", e.Detail)
+	}
+	return fmt.Sprintf("invalid configuration: WorkerID=%q", e.WorkerID)
+}
+
+// TaskError is the error of a task that ended without success.
+type TaskError struct {
+	TaskID TaskID
+	Err    error // last error of the task
+}
+
+// Error returns the description of the task error.
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("%v: %v", e.TaskID, e.Err)
+}
+
+// Unwrap returns the last error of the task.
+func (e *TaskError) Unwrap() error { return e.Err }
+
+// RunError is the error returned by the RunJoin method,
+// combining the errors of the tasks that ended without success.
+type RunError struct {
+	Errors []*TaskError // errors of the failed tasks, ordered by TaskID
+}
+
+// Error returns the description of the error of each failed task, one per line.
+func (e *RunError) Error() string {
+	lines := make([]string, 0, len(e.Errors))
+	for _, te := range e.Errors {
+		lines = append(lines, te.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Is reports whether the error of any failed task matches the target,
+// so that errors.Is(err, target) checks each of them.
+func (e *RunError) Is(target error) bool {
+	for _, te := range e.Errors {
+		if errors.Is(te, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As finds the first error of the failed tasks that matches the target,
+// so that errors.As(err, target) checks each of them.
+func (e *RunError) As(target interface{}) bool {
+	for _, te := range e.Errors {
+		if errors.As(te, target) {
+			return true
+		}
+	}
+	return false
+}
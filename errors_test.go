@@ -0,0 +1,164 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewEngine_ConfigError(t *testing.T) {
+	tests := map[string]struct {
+		workers []*Worker
+		input   map[string]testingTasks
+		kind    ConfigErrorKind
+		wid     WorkerID
+	}{
+		"nil worker": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				nil,
+			},
+			kind: NilWorker,
+		},
+		"duplicate worker": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+			},
+			kind: DuplicateWorker,
+			wid:  "w1",
+		},
+		"invalid instances": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 0, Work: testingWorkFn},
+			},
+			kind: InvalidInstances,
+			wid:  "w2",
+		},
+		"nil work function": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1},
+			},
+			kind: NilWorkFunc,
+			wid:  "w1",
+		},
+		"nil lookup function": {
+			workers: []*Worker{
+				{WorkerID: "v1", Virtual: true},
+			},
+			kind: NilLookupFunc,
+			wid:  "v1",
+		},
+		"virtual work function": {
+			workers: []*Worker{
+				{WorkerID: "v1", Virtual: true, Lookup: testingLookup, Work: testingWorkFn},
+			},
+			kind: VirtualWorkFunc,
+			wid:  "v1",
+		},
+		"instance weights length": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 2, Work: testingWorkFn, InstanceWeights: []int{1}},
+			},
+			kind: InvalidInstanceWeights,
+			wid:  "w1",
+		},
+		"instance weights not positive": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 2, Work: testingWorkFn, InstanceWeights: []int{1, 0}},
+			},
+			kind: InvalidInstanceWeights,
+			wid:  "w1",
+		},
+		"undefined worker": {
+			workers: []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+			},
+			input: map[string]testingTasks{
+				"w2": {{"t1", 10, true}},
+			},
+			kind: UndefinedWorker,
+			wid:  "w2",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewEngine(tt.workers, testingWorkerTasks(tt.input))
+
+			var cerr *ConfigError
+			if !errors.As(err, &cerr) {
+				t.Fatalf("want *ConfigError, got %T: %v", err, err)
+			}
+			if cerr.Kind != tt.kind {
+				t.Errorf("want kind %d, got %d", tt.kind, cerr.Kind)
+			}
+			if cerr.WorkerID != tt.wid {
+				t.Errorf("want WorkerID %q, got %q", tt.wid, cerr.WorkerID)
+			}
+		})
+	}
+}
+
+func TestConfigError_Error(t *testing.T) {
+	err := &ConfigError{Kind: 0, WorkerID: "w1"}
+	want := "invalid configuration: WorkerID=\"w1\""
+	if got := err.Error(); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestRunError_IsAs(t *testing.T) {
+	errA := errors.New("error A")
+	errB := &ConfigError{Kind: DuplicateWorker, WorkerID: "w1"}
+	err := fmt.Errorf("run: %w", &RunError{Errors: []*TaskError{
+		{TaskID: "t1", Err: errA},
+		{TaskID: "t2", Err: errB},
+	}})
+
+	if !errors.Is(err, errA) || !errors.Is(err, errB) {
+		t.Errorf("want the error to match the error of each task")
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("want the error not to match %v", context.Canceled)
+	}
+	var te *TaskError
+	if !errors.As(err, &te) || te.TaskID != "t1" {
+		t.Errorf("want the error of the first task, got %v", te)
+	}
+	var ce *ConfigError
+	if !errors.As(err, &ce) || ce != errB {
+		t.Errorf("want %v, got %v", errB, ce)
+	}
+}
+
+func TestNewEngine_NilWorker(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+		nil,
+	}
+	_, err := NewEngine(workers, nil)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if want := "nil worker at index 2"; err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+}
+
+func TestNewEngine_NilTask(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	wts := WorkerTasks{"w1": {&testingTask{"t1", 10, true}, nil}}
+	_, err := NewEngine(workers, wts)
+	if err == nil {
+		t.Fatalf("expected error, got nil")
+	}
+	if want := "nil task at index 1: WorkerID=\"w1\""; err.Error() != want {
+		t.Errorf("want error %q, got %q", want, err.Error())
+	}
+}
@@ -16,21 +16,35 @@ const (
 	EventSuccess
 	EventError
 	EventCanceled
+	EventAggregated
+	EventTaskComplete
+	EventSlow
+	EventExpired
+	EventSummary
 )
 
+// eventTypeNames maps each EventType to its string representation.
+// NOTE: the names are indexed by constant, so that they don't depend on the constants order.
+var eventTypeNames = map[EventType]string{
+	EventNil:          "nil",
+	EventStart:        "start",
+	EventSuccess:      "success",
+	EventError:        "error",
+	EventCanceled:     "canceled",
+	EventAggregated:   "aggregated",
+	EventTaskComplete: "complete",
+	EventSlow:         "slow",
+	EventExpired:      "expired",
+	EventSummary:      "summary",
+}
+
 // String representation of an EventType.
+// It returns "invalid" for a value that is not an EventType constant.
 func (t EventType) String() string {
-	if t < EventNil || t > EventCanceled {
-		return "invalid"
-	}
-	strings := []string{
-		"nil",
-		"start",
-		"success",
-		"error",
-		"canceled",
+	if name, ok := eventTypeNames[t]; ok {
+		return name
 	}
-	return strings[t]
+	return "invalid"
 }
 
 // MarshalJSON returns the json representation of the EventType
@@ -38,6 +52,27 @@ func (t EventType) MarshalJSON() ([]byte, error) {
 	return json.Marshal(t.String())
 }
 
+// UnmarshalJSON sets the EventType from its json representation,
+// i.e. the string returned by the String method.
+// It returns an error for the names not matching any EventType constant.
+// As usual, a json null leaves the EventType unchanged.
+func (t *EventType) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for et, etname := range eventTypeNames {
+		if etname == name {
+			*t = et
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid event type %q", name)
+}
+
 // Event type contains the informations of the task execution.
 // Events objects are emitted by the engine.ExecuteEvents method.
 // For each (worker, task) pair, it is emitted a Start event
@@ -48,32 +83,179 @@ type Event struct {
 	WorkerID   WorkerID
 	WorkerInst int
 	Task       Task
-	TaskStat   TaskStat
+	TaskStat   TaskStat // for Start event, Doing includes the just-started job
 	TimeStart  time.Time
 	TimeEnd    time.Time // same as TimeStart for Start event
+
+	// TimeEligible is the time the task became eligible to be executed.
+	TimeEligible time.Time
+
+	// Cached is true if the Result is taken from the cache
+	// instead of being returned by the worker.
+	Cached bool
+
+	// JobID identifies the job of the Start, Slow and result events (see JobID type).
+	// It is empty for the events not related to a job executed by a worker
+	// (i.e. cached results, Aggregated, TaskComplete and Expired events).
+	JobID JobID
+
+	// Retry is the number of the retry of the task by the same worker of the job,
+	// for the Start, Slow and result events: it is 0 for the first attempt
+	// (see WithRetries and RetryPolicy).
+	Retry int
+
+	// Summary contains the aggregate counts of the run, for the Summary event only
+	// (see WithSummaryEvent). The Summary event has no task.
+	Summary *RunSummary
+
+	// kind is the type of the events generated by the engine itself,
+	// instead of by a worker (i.e. Aggregated, TaskComplete, Slow, Expired and Summary events).
+	// It is EventNil for the worker events, whose type depends on the Result.
+	kind EventType
+}
+
+// JobID is the identifier of a job, i.e. the execution of a task by a worker,
+// assigned by the engine when the job is dispatched.
+// It has the "WorkerID/TaskID/attempt/seq" format, where attempt is the number
+// of the jobs of the task dispatched so far in the run, this one included,
+// and seq is the number of the jobs dispatched so far in the run, this one included.
+// It is unique within a run and the same for all the events of the job.
+type JobID string
+
+// newJobID returns the JobID of the job.
+func newJobID(wid WorkerID, tid TaskID, attempt int, seq uint64) JobID {
+	return JobID(fmt.Sprintf("%s/%s/%d/%d", wid, tid, attempt, seq))
 }
 
-// String returns a representation of an event.
+// String returns a representation of an event,
+// i.e. "w1[0] t1[0 1 0(0)] start" or "w1[0] t1[0 0 1(1)] success <result>"
+// for the events with a result.
 func (e *Event) String() string {
-	return fmt.Sprintf("%s[%d] %s%v %s",
+	if e.Task == nil {
+		return fmt.Sprintf("%s %v", e.Type(), e.Summary)
+	}
+	s := fmt.Sprintf("%s[%d] %s%v %s",
 		e.WorkerID, e.WorkerInst,
 		e.Task.TaskID(), e.TaskStat,
 		e.Type())
+	if e.Result != nil {
+		s += " " + e.Result.String()
+	}
+	return s
+}
+
+// eventJSON is the json representation of an Event object.
+// NOTE: the keys are the names of the fields of the Event.
+type eventJSON struct {
+	Type         EventType
+	WorkerID     WorkerID
+	WorkerInst   int
+	TaskID       TaskID
+	TaskStat     TaskStat
+	TimeStart    time.Time
+	TimeEnd      time.Time
+	TimeEligible time.Time
+	Result       string      `json:",omitempty"` // string representation of the result
+	Error        string      `json:",omitempty"` // error of the result
+	Cached       bool        `json:",omitempty"`
+	JobID        JobID       `json:",omitempty"`
+	Retry        int         `json:",omitempty"`
+	Summary      *RunSummary `json:",omitempty"`
+}
+
+// MarshalJSON returns the json representation of the Event,
+// i.e. to log the events of an execution.
+// The task is represented by its TaskID,
+// and the result by its string representation and its error, if any.
+func (e Event) MarshalJSON() ([]byte, error) {
+	j := eventJSON{
+		Type:         e.Type(),
+		WorkerID:     e.WorkerID,
+		WorkerInst:   e.WorkerInst,
+		TaskStat:     e.TaskStat,
+		TimeStart:    e.TimeStart,
+		TimeEnd:      e.TimeEnd,
+		TimeEligible: e.TimeEligible,
+		Cached:       e.Cached,
+		JobID:        e.JobID,
+		Retry:        e.Retry,
+		Summary:      e.Summary,
+	}
+	if e.Task != nil {
+		j.TaskID = e.Task.TaskID()
+	}
+	if e.Result != nil {
+		j.Result = e.Result.String()
+		if err := e.Result.Error(); err != nil {
+			j.Error = err.Error()
+		}
+	}
+	return json.Marshal(j)
+}
+
+// NewEvent returns a new worker event, i.e. to test the consumers of the events.
+// The type of the event depends on the result: Start for a nil result,
+// else Success, Canceled or Error based on the error of the result.
+func NewEvent(wid WorkerID, inst int, task Task, res Result, stat TaskStat, start, end time.Time) *Event {
+	return &Event{
+		Result:     res,
+		WorkerID:   wid,
+		WorkerInst: inst,
+		Task:       task,
+		TaskStat:   stat,
+		TimeStart:  start,
+		TimeEnd:    end,
+	}
+}
+
+// NewStartEvent returns a new Start event of the first instance of the worker,
+// started now and with the task being done only by the worker.
+func NewStartEvent(wid WorkerID, task Task) *Event {
+	now := time.Now()
+	return NewEvent(wid, 0, task, nil, TaskStat{Doing: 1}, now, now)
+}
+
+// NewSuccessEvent returns a new Success event of the first instance of the worker,
+// terminated now and with the task done only by the worker.
+// The result must have a nil error.
+func NewSuccessEvent(wid WorkerID, task Task, res Result) *Event {
+	now := time.Now()
+	return NewEvent(wid, 0, task, res, TaskStat{Done: 1, Success: 1}, now, now)
+}
+
+// NewErrorEvent returns a new Error (or Canceled) event of the first instance of the worker,
+// terminated now and with the task done only by the worker.
+// The result must have a not nil error.
+func NewErrorEvent(wid WorkerID, task Task, res Result) *Event {
+	now := time.Now()
+	return NewEvent(wid, 0, task, res, TaskStat{Done: 1}, now, now)
+}
+
+// QueueWait returns how long the task waited between becoming eligible
+// and the start of the execution by the worker.
+// It returns 0 if the eligible time is unknown.
+func (e *Event) QueueWait() time.Duration {
+	if e.TimeEligible.IsZero() {
+		return 0
+	}
+	return e.TimeStart.Sub(e.TimeEligible)
 }
 
 // Type method returns the type of Event.
 func (e *Event) Type() EventType {
-	// TODO: maybe EventCanceled must consider context.DeadlineExceeded error also.
 	if e == nil {
 		return EventNil
 	}
+	if e.kind != EventNil {
+		return e.kind
+	}
 	if e.Result == nil {
 		return EventStart
 	}
 	if e.Result.Error() == nil {
 		return EventSuccess
 	}
-	if errors.Is(e.Result.Error(), context.Canceled) {
+	if isCanceled(e.Result.Error()) {
 		return EventCanceled
 	}
 	return EventError
@@ -113,17 +295,29 @@ func IsResultUntilFirstSuccess(e *Event) bool {
 
 // IsSuccessOrError returns true if it is a result and
 // it is a success or an error result.
-// Return false in case of canceled result.
+// Return false in case of canceled (or timed out) result.
 func IsSuccessOrError(e *Event) bool {
 	if !IsResult(e) {
 		return false
 	}
-	err := e.Result.Error()
-	return !errors.Is(err, context.Canceled)
+	return !isCanceled(e.Result.Error())
+}
+
+// isCanceled returns true if the error is a context.Canceled
+// or a context.DeadlineExceeded error, i.e. the job was canceled
+// or its context expired (see TaskWithTimeout).
+func isCanceled(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
 }
 
-// IsResult return true if the event has a not nil result
-// i.e. not a start event.
+// IsResult return true if the event has a not nil result of a worker
+// i.e. not a start event or an event generated by the engine.
 func IsResult(e *Event) bool {
-	return (e != nil) && (e.Result != nil)
+	return (e != nil) && (e.kind == EventNil) && (e.Result != nil)
+}
+
+// IsAggregated returns true if the event contains
+// the aggregated result of a task.
+func IsAggregated(e *Event) bool {
+	return e.Type() == EventAggregated
 }
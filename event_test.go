@@ -3,7 +3,12 @@ package taskengine
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestEventType_String(t *testing.T) {
@@ -37,6 +42,31 @@ func TestEventType_String(t *testing.T) {
 			etype: EventError,
 			want:  "error",
 		},
+		{
+			name:  "Aggregated",
+			etype: EventAggregated,
+			want:  "aggregated",
+		},
+		{
+			name:  "TaskComplete",
+			etype: EventTaskComplete,
+			want:  "complete",
+		},
+		{
+			name:  "Slow",
+			etype: EventSlow,
+			want:  "slow",
+		},
+		{
+			name:  "Expired",
+			etype: EventExpired,
+			want:  "expired",
+		},
+		{
+			name:  "Summary",
+			etype: EventSummary,
+			want:  "summary",
+		},
 		{
 			name:  "Invalid < 0",
 			etype: -1,
@@ -117,6 +147,80 @@ func TestEventType_MarshalJSON(t *testing.T) {
 	}
 }
 
+func TestEventType_UnmarshalJSON(t *testing.T) {
+	// round trip of each EventType
+	for et := EventNil; et <= EventSummary; et++ {
+		data, err := json.Marshal(et)
+		if err != nil {
+			t.Fatalf("%v: unexpected error %v", et, err)
+		}
+		var got EventType
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Errorf("%v: unexpected error %v", et, err)
+		}
+		if got != et {
+			t.Errorf("want %v, got %v", et, got)
+		}
+	}
+
+	for _, data := range []string{`"invalid"`, `"Success"`, `2`, `null`} {
+		got := EventStart
+		if err := json.Unmarshal([]byte(data), &got); (err == nil) != (data == `null`) {
+			t.Errorf("%s: unexpected error %v", data, err)
+		}
+		if got != EventStart {
+			t.Errorf("%s: want the EventType unchanged, got %v", data, got)
+		}
+	}
+}
+
+func TestEvent_MarshalJSON(t *testing.T) {
+	t0 := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	t1 := t0.Add(time.Second)
+	task := &testingTask{"t1", 0, true}
+
+	events := []*Event{
+		{WorkerID: "w1", WorkerInst: 1, Task: task, TaskStat: TaskStat{Doing: 1}, TimeStart: t0, TimeEnd: t0, TimeEligible: t0, JobID: "w1/t1/1/1"},
+		{WorkerID: "w1", WorkerInst: 1, Task: task, Result: testingResult{}, TaskStat: TaskStat{Done: 1, Success: 1}, TimeStart: t0, TimeEnd: t1, TimeEligible: t0, JobID: "w1/t1/1/1"},
+		{WorkerID: "w2", Task: task, Result: testingResult{Err: testingError}, TaskStat: TaskStat{Done: 2, Success: 1}, TimeStart: t1, TimeEnd: t1, Cached: true, Retry: 1},
+		{TimeStart: t0, TimeEnd: t1, Summary: &RunSummary{Tasks: 1, Succeeded: 1, Successes: 1, Errors: 1, Elapsed: time.Second}, kind: EventSummary},
+		nil,
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var got []*eventJSON
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []*eventJSON{
+		{Type: EventStart, WorkerID: "w1", WorkerInst: 1, TaskID: "t1", TaskStat: TaskStat{Doing: 1}, TimeStart: t0, TimeEnd: t0, TimeEligible: t0, JobID: "w1/t1/1/1"},
+		{Type: EventSuccess, WorkerID: "w1", WorkerInst: 1, TaskID: "t1", TaskStat: TaskStat{Done: 1, Success: 1}, TimeStart: t0, TimeEnd: t1, TimeEligible: t0, Result: "SUCCESS", JobID: "w1/t1/1/1"},
+		{Type: EventError, WorkerID: "w2", TaskID: "t1", TaskStat: TaskStat{Done: 2, Success: 1}, TimeStart: t1, TimeEnd: t1, Result: "ERROR", Error: testingError.Error(), Cached: true, Retry: 1},
+		{Type: EventSummary, TimeStart: t0, TimeEnd: t1, Summary: &RunSummary{Tasks: 1, Succeeded: 1, Successes: 1, Errors: 1, Elapsed: time.Second}},
+		nil,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+
+	// the events are logged one by one, too
+	data, err = json.Marshal(*events[1])
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, key := range []string{`"Type":"success"`, `"TaskID":"t1"`, `"TaskStat":{`, `"Result":"SUCCESS"`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("want %s in %s", key, data)
+		}
+	}
+	if strings.Contains(string(data), `"Error"`) {
+		t.Errorf("want no error of a success in %s", data)
+	}
+}
+
 func TestEvent_Type(t *testing.T) {
 	tests := []struct {
 		name  string
@@ -143,6 +247,11 @@ func TestEvent_Type(t *testing.T) {
 			event: &Event{Result: &testingResult{Err: context.Canceled}},
 			want:  EventCanceled,
 		},
+		{
+			name:  "deadline exceeded",
+			event: &Event{Result: &testingResult{Err: fmt.Errorf("attempt: %w", context.DeadlineExceeded)}},
+			want:  EventCanceled,
+		},
 		{
 			name:  "error",
 			event: &Event{Result: &testingResult{Err: testingError}},
@@ -235,3 +344,185 @@ func TestEvent_FirstSuccessOrLastError(t *testing.T) {
 		})
 	}
 }
+
+func TestEvent_QueueWait(t *testing.T) {
+	t0 := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		event *Event
+		want  time.Duration
+	}{
+		{
+			name:  "unknown eligible time",
+			event: &Event{TimeStart: t0},
+			want:  0,
+		},
+		{
+			name:  "no wait",
+			event: &Event{TimeStart: t0, TimeEligible: t0},
+			want:  0,
+		},
+		{
+			name:  "wait",
+			event: &Event{TimeStart: t0.Add(3 * time.Second), TimeEligible: t0},
+			want:  3 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.event.QueueWait()
+			if got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEvent_String(t *testing.T) {
+	task := &testingTask{"t1", 0, true}
+	tests := []struct {
+		name  string
+		event *Event
+		want  string
+	}{
+		{"start", &Event{WorkerID: "w1", Task: task, TaskStat: TaskStat{0, 1, 0, 0}}, "w1[0] t1[0 1 0(0)] start"},
+		{"success", &Event{WorkerID: "w1", Task: task, Result: testingResult{}, TaskStat: TaskStat{0, 0, 1, 1}}, "w1[0] t1[0 0 1(1)] success SUCCESS"},
+		{"error", &Event{WorkerID: "w2", WorkerInst: 1, Task: task, Result: testingResult{Err: testingError}, TaskStat: TaskStat{0, 0, 1, 0}}, "w2[1] t1[0 0 1(0)] error ERROR"},
+		{"complete", &Event{WorkerID: "w1", Task: task, TaskStat: TaskStat{0, 0, 1, 1}, kind: EventTaskComplete}, "w1[0] t1[0 0 1(1)] complete"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.String(); got != tt.want {
+				t.Errorf("want %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	task := &testingTask{"t1", 0, true}
+
+	e := NewEvent("w1", 2, task, testingResult{}, TaskStat{1, 0, 2, 1}, t0, t0.Add(time.Second))
+	want := &Event{
+		Result:     testingResult{},
+		WorkerID:   "w1",
+		WorkerInst: 2,
+		Task:       task,
+		TaskStat:   TaskStat{1, 0, 2, 1},
+		TimeStart:  t0,
+		TimeEnd:    t0.Add(time.Second),
+	}
+	if *e != *want {
+		t.Errorf("want %v, got %v", want, e)
+	}
+
+	tests := []struct {
+		name  string
+		event *Event
+		etype EventType
+		stat  TaskStat
+	}{
+		{
+			name:  "start",
+			event: NewStartEvent("w1", task),
+			etype: EventStart,
+			stat:  TaskStat{Doing: 1},
+		},
+		{
+			name:  "success",
+			event: NewSuccessEvent("w1", task, testingResult{}),
+			etype: EventSuccess,
+			stat:  TaskStat{Done: 1, Success: 1},
+		},
+		{
+			name:  "error",
+			event: NewErrorEvent("w1", task, testingResult{Err: testingError}),
+			etype: EventError,
+			stat:  TaskStat{Done: 1},
+		},
+		{
+			name:  "canceled",
+			event: NewErrorEvent("w1", task, testingResult{Err: context.Canceled}),
+			etype: EventCanceled,
+			stat:  TaskStat{Done: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.event.Type(); got != tt.etype {
+				t.Errorf("want type %v, got %v", tt.etype, got)
+			}
+			if tt.event.TaskStat != tt.stat {
+				t.Errorf("want stat %v, got %v", tt.stat, tt.event.TaskStat)
+			}
+			if tt.event.WorkerID != "w1" || tt.event.Task != task {
+				t.Errorf("unexpected worker or task: %v", tt.event)
+			}
+			if tt.event.TimeStart.IsZero() || !tt.event.TimeEnd.Equal(tt.event.TimeStart) {
+				t.Errorf("unexpected times: %v - %v", tt.event.TimeStart, tt.event.TimeEnd)
+			}
+		})
+	}
+}
+
+func TestEvent_JobID(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, false}, {"t2", 10, true}, {"t3", 10, true}},
+		"w2": {{"t1", 20, true}, {"t3", 20, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithTaskCompleteEvents(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	started := map[JobID]*Event{}
+	results := 0
+	for e := range out {
+		switch {
+		case e.Type() == EventStart:
+			if _, ok := started[e.JobID]; ok {
+				t.Errorf("duplicate JobID %q", e.JobID)
+			}
+			prefix := fmt.Sprintf("%s/%s/", e.WorkerID, e.Task.TaskID())
+			if !strings.HasPrefix(string(e.JobID), prefix) {
+				t.Errorf("want JobID with prefix %q, got %q", prefix, e.JobID)
+			}
+			started[e.JobID] = e
+		case IsResult(e):
+			results++
+			s, ok := started[e.JobID]
+			if !ok {
+				t.Errorf("%v: JobID %q without Start event", e, e.JobID)
+				continue
+			}
+			if s.WorkerID != e.WorkerID || s.WorkerInst != e.WorkerInst || s.Task.TaskID() != e.Task.TaskID() {
+				t.Errorf("JobID %q: result %v of another job %v", e.JobID, e, s)
+			}
+		case e.Type() == EventTaskComplete:
+			if e.JobID != "" {
+				t.Errorf("%v: want empty JobID, got %q", e, e.JobID)
+			}
+		}
+	}
+	if len(started) != 5 || results != 5 {
+		t.Errorf("want 5 jobs, got %d starts and %d results", len(started), results)
+	}
+}
+
+func TestNewJobID(t *testing.T) {
+	if got, want := newJobID("w1", "t1", 2, 7), JobID("w1/t1/2/7"); got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -4,4 +4,4 @@ go 1.18
 
 require github.com/google/go-cmp v0.5.7
 
-require golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
+require golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
@@ -0,0 +1,212 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrRunEnded is the error returned by the methods of a RunHandle
+// when the execution no longer accepts requests.
+var ErrRunEnded = errors.New("execution ended")
+
+// ErrWorkerClosed is the error returned by the AddTask method of a RunHandle
+// when the chans of the worker instances are already closed.
+var ErrWorkerClosed = errors.New("worker closed")
+
+// runRequest is a request of the handle of a run.
+type runRequest struct {
+	cancel TaskID      // the task to cancel
+	add    WorkerTasks // the tasks to add, if not nil
+	drain  bool        // no task is started anymore
+}
+
+// Attempt identifies a worker instance executing a task.
+type Attempt struct {
+	WorkerID WorkerID
+	Inst     int
+}
+
+// RunHandle controls an execution of the engine in progress,
+// started by the ExecuteEventsHandle method.
+// Its methods are safe for concurrent use and they never block:
+// the requests are queued and executed by the engine goroutine in order,
+// so they can be called by the consumer of the events (i.e. while handling an event).
+// After the end of the execution, they have no effect.
+type RunHandle struct {
+	mu      sync.Mutex
+	pending []*runRequest // requests not yet executed, in order
+	ended   bool          // the execution no longer accepts requests
+	drained bool          // the execution no longer accepts tasks
+	notify  chan struct{} // signals the pending requests to the engine goroutine
+
+	attempts map[TaskID][]Attempt // active attempts of each task, in order of start
+	open     map[WorkerID]bool    // workers of the run: false if the chans of the instances are closed
+	tasks    map[TaskID]bool      // tasks of the run, included the ones to add
+}
+
+// newRunHandle returns the handle of a new run of the workers.
+func newRunHandle(workers map[WorkerID]*Worker) *RunHandle {
+	h := &RunHandle{
+		notify:   make(chan struct{}, 1),
+		attempts: map[TaskID][]Attempt{},
+		open:     make(map[WorkerID]bool, len(workers)),
+		tasks:    map[TaskID]bool{},
+	}
+	for wid := range workers {
+		h.open[wid] = true
+	}
+	return h
+}
+
+// post queues the request and signals it to the run.
+// It returns ErrRunEnded if the run no longer accepts requests.
+func (h *RunHandle) post(req *runRequest) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ended {
+		return ErrRunEnded
+	}
+	h.queue(req)
+	return nil
+}
+
+// queue queues the request and signals it to the run.
+// It must be called with the lock held.
+func (h *RunHandle) queue(req *runRequest) {
+	h.pending = append(h.pending, req)
+	select {
+	case h.notify <- struct{}{}:
+	default:
+		// the run has already been signaled
+	}
+}
+
+// take returns the pending requests, in order.
+func (h *RunHandle) take() []*runRequest {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	reqs := h.pending
+	h.pending = nil
+	return reqs
+}
+
+// tryClose signals the run no longer accepts requests, if no request is pending.
+// It returns false if some request is pending: the run must execute it before ending.
+func (h *RunHandle) tryClose() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.pending) > 0 {
+		return false
+	}
+	h.ended = true
+	h.attempts = map[TaskID][]Attempt{}
+	return true
+}
+
+// addTasks saves the tasks of the run.
+func (h *RunHandle) addTasks(wts WorkerTasks) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ts := range wts {
+		for _, t := range ts {
+			h.tasks[t.TaskID()] = true
+		}
+	}
+}
+
+// closeWorker saves the chans of the worker instances are closed.
+func (h *RunHandle) closeWorker(wid WorkerID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.open[wid] = false
+}
+
+// setAttempts saves the active attempts of the task.
+func (h *RunHandle) setAttempts(tid TaskID, attempts []Attempt) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(attempts) == 0 {
+		delete(h.attempts, tid)
+		return
+	}
+	h.attempts[tid] = attempts
+}
+
+// ActiveAttempts returns the worker instances executing the task, in order of start.
+// The attempts are the live state of the run: a job is an active attempt
+// from before its Start event until before its result event.
+// It returns nil if the task is not in execution.
+func (h *RunHandle) ActiveAttempts(tid TaskID) []Attempt {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]Attempt(nil), h.attempts[tid]...)
+}
+
+// CancelTask cancels the task in the execution:
+// the context of its jobs in execution is canceled, so that their canceled results
+// are emitted as usual, and the task is not started by any other worker.
+// It does nothing if the task is already completed or it is not a task of the execution.
+func (h *RunHandle) CancelTask(tid TaskID) {
+	h.post(&runRequest{cancel: tid})
+}
+
+// AddTask adds the task of the worker to the execution:
+// it is picked by the worker at its next availability, as the other tasks of the worker.
+//
+// Without parked idle instances (see WithParkIdleInstances), the chans of the instances
+// of a worker are closed once the worker has no more tasks, and the execution ends
+// once every task is completed: to keep the workers available for the tasks to add,
+// the execution must park its idle instances.
+//
+// It returns a *ConfigError if the task is nil or the worker is undefined,
+// ErrRunEnded if the execution is ended or drained, ErrWorkerClosed if the chans of the worker
+// instances are closed, or an error if the task is already in the execution.
+func (h *RunHandle) AddTask(wid WorkerID, task Task) error {
+	if task == nil {
+		return &ConfigError{Kind: NilTask, WorkerID: wid}
+	}
+	tid := task.TaskID()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ended || h.drained {
+		return ErrRunEnded
+	}
+	open, ok := h.open[wid]
+	if !ok {
+		return &ConfigError{Kind: UndefinedWorker, WorkerID: wid}
+	}
+	if !open {
+		return ErrWorkerClosed
+	}
+	if h.tasks[tid] {
+		return fmt.Errorf("task %q already in the run", tid)
+	}
+	h.tasks[tid] = true
+	h.queue(&runRequest{add: WorkerTasks{wid: {task}}})
+	return nil
+}
+
+// Drain stops the execution gracefully: no task is started anymore,
+// while the jobs in execution go on and their results are emitted as usual.
+// The remaining tasks are discarded, the chans of the worker instances are closed
+// once the instances are idle, and the execution ends once the jobs in execution end.
+// Unlike canceling the context, no job is canceled.
+func (h *RunHandle) Drain() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.ended || h.drained {
+		return
+	}
+	h.drained = true
+	h.queue(&runRequest{drain: true})
+}
+
+// ExecuteEventsHandle is like the ExecuteEvents method,
+// but it also returns the handle to control the execution in progress
+// (i.e. to cancel a specific task).
+func (eng *Engine) ExecuteEventsHandle(ctx context.Context) (chan *Event, *RunHandle, error) {
+	return eng.executeEvents(ctx, nil)
+}
@@ -0,0 +1,269 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunHandle_CancelTask(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 300, true}, {"t2", 10, true}, {"t3", 10, true}, {"t4", 10, true}},
+		"w2": {{"t1", 300, true}, {"t2", 10, true}, {"t3", 10, true}, {"t4", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithTaskCompleteEvents(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start := time.Now()
+	out, handle, err := eng.ExecuteEventsHandle(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := map[TaskID]EventType{}
+	completed := map[TaskID]bool{}
+	started := map[TaskID]int{}
+	for e := range out {
+		tid := e.Task.TaskID()
+		switch e.Type() {
+		case EventStart:
+			if tid == "t4" {
+				t.Errorf("t4 started after being canceled")
+			}
+			started[tid]++
+			if len(started) == 1 {
+				// t4 is still to do
+				handle.CancelTask("t4")
+				handle.CancelTask("t9")
+			}
+			if started["t1"] == 2 {
+				// t1 is in execution by both workers
+				handle.CancelTask("t1")
+			}
+		case EventTaskComplete:
+			completed[tid] = true
+		default:
+			if IsResult(e) && got[tid] != EventSuccess {
+				got[tid] = e.Type()
+			}
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 300*time.Millisecond {
+		t.Errorf("want t1 canceled before its end, got elapsed %v", elapsed)
+	}
+	if got["t1"] != EventCanceled || got["t2"] != EventSuccess || got["t3"] != EventSuccess {
+		t.Errorf("unexpected results %v", got)
+	}
+	if _, ok := got["t4"]; ok || !completed["t4"] {
+		t.Errorf("t4: want completed without results, got %v", got["t4"])
+	}
+
+	// no effect after the end of the execution
+	handle.CancelTask("t1")
+}
+
+func TestRunHandle_ActiveAttempts(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 200, true}},
+		"w2": {{"t1", 200, true}, {"t2", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, handle, err := eng.ExecuteEventsHandle(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	started := map[Attempt]bool{}
+	checked := false
+	for e := range out {
+		if e.Task.TaskID() != "t1" {
+			continue
+		}
+		if e.Type() == EventStart {
+			started[Attempt{WorkerID: e.WorkerID, Inst: e.WorkerInst}] = true
+			if got := handle.ActiveAttempts("t1"); len(got) < len(started) {
+				t.Errorf("%v: want at least %d active attempts, got %v", e, len(started), got)
+			}
+		}
+		if len(started) == 2 && !checked {
+			// t1 is in execution by w1 and by an instance of w2
+			checked = true
+			got := handle.ActiveAttempts("t1")
+			if len(got) != 2 || !started[got[0]] || !started[got[1]] {
+				t.Errorf("want active attempts %v, got %v", started, got)
+			}
+		}
+	}
+	if !checked {
+		t.Errorf("t1 not started by both workers: %v", started)
+	}
+
+	if got := handle.ActiveAttempts("t1"); got != nil {
+		t.Errorf("after the end: want no active attempts, got %v", got)
+	}
+}
+
+func TestRunHandle_AddTask(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 50, true}},
+	}
+	logger := &closeLogger{closed: map[WorkerID]chan struct{}{"w2": make(chan struct{})}}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, handle, err := eng.ExecuteEventsHandle(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := map[TaskID]EventType{}
+	for e := range out {
+		tid := e.Task.TaskID()
+		if e.Type() == EventStart && tid == "t1" {
+			// w1 is executing t1: the run goes on until the added task is completed
+			if err := handle.AddTask("w1", &testingTask{"t2", 10, true}); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if err := handle.AddTask("w1", &testingTask{"t1", 10, true}); err == nil {
+				t.Errorf("want error adding a task already in the run")
+			}
+			var cerr *ConfigError
+			if err := handle.AddTask("w9", &testingTask{"t9", 10, true}); !errors.As(err, &cerr) || cerr.Kind != UndefinedWorker {
+				t.Errorf("want UndefinedWorker error, got %v", err)
+			}
+			if err := handle.AddTask("w1", nil); !errors.As(err, &cerr) || cerr.Kind != NilTask {
+				t.Errorf("want NilTask error, got %v", err)
+			}
+			// w2 has no tasks: its instance is closed
+			<-logger.closed["w2"]
+			if err := handle.AddTask("w2", &testingTask{"t3", 10, true}); err != ErrWorkerClosed {
+				t.Errorf("want ErrWorkerClosed, got %v", err)
+			}
+		}
+		if IsResult(e) {
+			got[tid] = e.Type()
+		}
+	}
+	if got["t1"] != EventSuccess || got["t2"] != EventSuccess || len(got) != 2 {
+		t.Errorf("unexpected results %v", got)
+	}
+
+	if err := handle.AddTask("w1", &testingTask{"t4", 10, true}); err != ErrRunEnded {
+		t.Errorf("after the end: want ErrRunEnded, got %v", err)
+	}
+}
+
+// closeLogger is a Logger closing the chan of a worker when the worker is closed.
+type closeLogger struct {
+	NopLogger
+	closed map[WorkerID]chan struct{}
+}
+
+func (l *closeLogger) OnWorkerClose(wid WorkerID) {
+	if ch, ok := l.closed[wid]; ok {
+		close(ch)
+	}
+}
+
+func TestRunHandle_Drain(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 100, true}, {"t3", 10, true}},
+		"w2": {{"t2", 100, true}, {"t4", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithTaskCompleteEvents(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, handle, err := eng.ExecuteEventsHandle(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := map[TaskID]EventType{}
+	completed := map[TaskID]bool{}
+	started := 0
+	for e := range out {
+		tid := e.Task.TaskID()
+		switch e.Type() {
+		case EventStart:
+			started++
+			if started == 2 {
+				// t1 and t2 are in execution
+				handle.Drain()
+				if err := handle.AddTask("w1", &testingTask{"t5", 10, true}); err != ErrRunEnded {
+					t.Errorf("after the drain: want ErrRunEnded, got %v", err)
+				}
+			} else if started > 2 {
+				t.Errorf("%s started after the drain", tid)
+			}
+		case EventTaskComplete:
+			completed[tid] = true
+		default:
+			if IsResult(e) {
+				got[tid] = e.Type()
+			}
+		}
+	}
+	if got["t1"] != EventSuccess || got["t2"] != EventSuccess || len(got) != 2 {
+		t.Errorf("want the jobs in execution succeeded, got %v", got)
+	}
+	if !completed["t3"] || !completed["t4"] {
+		t.Errorf("want the remaining tasks completed, got %v", completed)
+	}
+}
+
+func TestRunHandle_Drain_Parking(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithParkIdleInstances(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, handle, err := eng.ExecuteEventsHandle(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the run with parked idle instances ends after the drain,
+	// without canceling the context
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case e, ok := <-out:
+			if !ok {
+				return
+			}
+			if e.Type() == EventSuccess {
+				handle.Drain()
+			}
+		case <-timeout:
+			t.Fatalf("run not ended after the drain")
+		}
+	}
+}
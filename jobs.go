@@ -0,0 +1,100 @@
+package taskengine
+
+import (
+	"sort"
+	"time"
+)
+
+// jobRegistry tracks the jobs in execution by their correlation ID,
+// so that each result is matched to its job regardless of the arrival order.
+type jobRegistry struct {
+	next uint64               // ID of the next job
+	jobs map[uint64]*jobInput // jobs in execution
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{
+		next: 1,
+		jobs: map[uint64]*jobInput{},
+	}
+}
+
+// add assigns a new correlation ID to the job and saves it.
+func (r *jobRegistry) add(req *jobInput) uint64 {
+	req.id = r.next
+	r.next++
+	r.jobs[req.id] = req
+	return req.id
+}
+
+// take removes and returns the job with the given ID.
+// The second value is false if the job is unknown.
+func (r *jobRegistry) take(id uint64) (*jobInput, bool) {
+	req, ok := r.jobs[id]
+	if ok {
+		delete(r.jobs, id)
+	}
+	return req, ok
+}
+
+// len returns the number of jobs in execution.
+func (r *jobRegistry) len() int {
+	return len(r.jobs)
+}
+
+// snapshot returns the description of the jobs in execution, ordered by correlation ID.
+func (r *jobRegistry) snapshot() []JobSnapshot {
+	reqs := make([]*jobInput, 0, len(r.jobs))
+	for _, req := range r.jobs {
+		reqs = append(reqs, req)
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].id < reqs[j].id })
+	jobs := make([]JobSnapshot, len(reqs))
+	for j, req := range reqs {
+		jobs[j] = JobSnapshot{
+			JobID:     req.jobID,
+			WorkerID:  req.wid,
+			Instance:  req.instance,
+			TaskID:    req.task.TaskID(),
+			TimeStart: req.sent,
+		}
+	}
+	return jobs
+}
+
+// ofTask returns the jobs in execution of the task.
+func (r *jobRegistry) ofTask(tid TaskID) []*jobInput {
+	var reqs []*jobInput
+	for _, req := range r.jobs {
+		if req.task.TaskID() == tid {
+			reqs = append(reqs, req)
+		}
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].id < reqs[j].id })
+	return reqs
+}
+
+// nextAbandon returns the earliest time a canceled job is abandoned.
+// The second value is false if no job has to be abandoned.
+func (r *jobRegistry) nextAbandon() (time.Time, bool) {
+	var next time.Time
+	for _, req := range r.jobs {
+		if !req.abandon.IsZero() && (next.IsZero() || req.abandon.Before(next)) {
+			next = req.abandon
+		}
+	}
+	return next, !next.IsZero()
+}
+
+// takeAbandoned removes and returns the jobs to abandon at the given time.
+func (r *jobRegistry) takeAbandoned(now time.Time) []*jobInput {
+	var reqs []*jobInput
+	for id, req := range r.jobs {
+		if !req.abandon.IsZero() && !req.abandon.After(now) {
+			delete(r.jobs, id)
+			reqs = append(reqs, req)
+		}
+	}
+	sort.Slice(reqs, func(i, j int) bool { return reqs[i].id < reqs[j].id })
+	return reqs
+}
@@ -0,0 +1,147 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJobRegistry(t *testing.T) {
+	reg := newJobRegistry()
+
+	reqs := []*jobInput{
+		{task: &testingTask{"t1", 0, true}},
+		{task: &testingTask{"t2", 0, true}},
+		{task: &testingTask{"t3", 0, true}},
+	}
+	ids := map[uint64]bool{}
+	for _, req := range reqs {
+		id := reg.add(req)
+		if id == 0 || ids[id] {
+			t.Fatalf("invalid or duplicate ID %d", id)
+		}
+		if req.id != id {
+			t.Errorf("want job ID %d, got %d", id, req.id)
+		}
+		ids[id] = true
+	}
+	if reg.len() != 3 {
+		t.Errorf("want 3 jobs, got %d", reg.len())
+	}
+
+	// the results arrive out of dispatch order
+	for _, j := range []int{2, 0, 1} {
+		req, ok := reg.take(reqs[j].id)
+		if !ok {
+			t.Fatalf("job %d not found", reqs[j].id)
+		}
+		if req.task.TaskID() != reqs[j].task.TaskID() {
+			t.Errorf("want task %s, got %s", reqs[j].task.TaskID(), req.task.TaskID())
+		}
+	}
+	if reg.len() != 0 {
+		t.Errorf("want 0 jobs, got %d", reg.len())
+	}
+
+	if _, ok := reg.take(reqs[0].id); ok {
+		t.Errorf("job %d taken twice", reqs[0].id)
+	}
+}
+
+func TestJobRegistry_Abandon(t *testing.T) {
+	reg := newJobRegistry()
+	t0 := time.Now()
+
+	reqs := []*jobInput{
+		{task: &testingTask{"t1", 0, true}},
+		{task: &testingTask{"t1", 0, true}, abandon: t0.Add(20 * time.Millisecond)},
+		{task: &testingTask{"t2", 0, true}, abandon: t0.Add(10 * time.Millisecond)},
+	}
+	for _, req := range reqs {
+		reg.add(req)
+	}
+
+	if got := len(reg.ofTask("t1")); got != 2 {
+		t.Errorf("want 2 jobs of t1, got %d", got)
+	}
+	if next, ok := reg.nextAbandon(); !ok || !next.Equal(reqs[2].abandon) {
+		t.Errorf("want next abandon at %v, got %v (%v)", reqs[2].abandon, next, ok)
+	}
+	if got := reg.takeAbandoned(t0); len(got) != 0 {
+		t.Errorf("want no abandoned jobs, got %d", len(got))
+	}
+	got := reg.takeAbandoned(t0.Add(time.Second))
+	if len(got) != 2 || got[0] != reqs[1] || got[1] != reqs[2] {
+		t.Errorf("want abandoned jobs %d and %d, got %v", reqs[1].id, reqs[2].id, got)
+	}
+	if _, ok := reg.nextAbandon(); ok {
+		t.Errorf("want no job to abandon")
+	}
+	if reg.len() != 1 {
+		t.Errorf("want 1 job, got %d", reg.len())
+	}
+}
+
+func TestEngine_OutOfOrderResults(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}, {"t3", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the instance is ready again as soon as it receives a job,
+	// and the results of its jobs come back in reverse dispatch order
+	eng.startInstance = func(wid WorkerID, inst int, inputc <-chan *jobInput, outputc chan<- *jobOutput) {
+		var reqs []*jobInput
+		for req := range inputc {
+			reqs = append(reqs, req)
+			if len(reqs) < 3 {
+				outputc <- &jobOutput{wid: wid, instance: inst}
+				continue
+			}
+			for j := len(reqs) - 1; j >= 0; j-- {
+				task := reqs[j].task.(*testingTask)
+				res := &testingResult{Wid: string(wid), Tid: task.taskid}
+				if !task.success {
+					res.Err = testingError
+				}
+				reqs[j].outc <- &jobOutput{id: reqs[j].id, wid: wid, instance: inst, res: res}
+			}
+		}
+	}
+
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []TaskID
+	jobIDs := map[JobID]bool{}
+	for e := range out {
+		if !IsResult(e) {
+			continue
+		}
+		// each event pairs the result with the task of its own job
+		res := e.Result.(*testingResult)
+		if string(e.Task.TaskID()) != res.Tid {
+			t.Errorf("event of task %s with the result of task %s", e.Task.TaskID(), res.Tid)
+		}
+		if (e.Type() == EventSuccess) != (res.Err == nil) {
+			t.Errorf("event %s with result %v", e.Type(), res)
+		}
+		if jobIDs[e.JobID] {
+			t.Errorf("duplicate job ID %s", e.JobID)
+		}
+		jobIDs[e.JobID] = true
+		got = append(got, e.Task.TaskID())
+	}
+	if diff := cmp.Diff([]TaskID{"t3", "t2", "t1"}, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+}
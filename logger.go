@@ -0,0 +1,47 @@
+package taskengine
+
+// Logger receives the internal decisions of the engine, i.e. for structured logging.
+// Unlike the events, it also exposes the scheduling of the tasks:
+// which task was picked by a worker instance among its candidates.
+// The OnStart method is called by the goroutines of the worker instances,
+// so a Logger must be safe for concurrent use.
+// A method that panics is reported as a callback error (see WithOnCallbackError).
+type Logger interface {
+	// OnStart is called when a job starts, with its Start event.
+	OnStart(e Event)
+
+	// OnResult is called with each result event (success, error or canceled).
+	OnResult(e Event)
+
+	// OnPick is called when a worker instance picks the next task to execute
+	// among the candidate tasks, i.e. its tasks not paused nor blocked.
+	OnPick(wid WorkerID, chosen TaskID, candidates Tasks)
+
+	// OnWorkerClose is called when the chans of the instances of the worker are closed,
+	// i.e. the worker has no more tasks to do.
+	OnWorkerClose(wid WorkerID)
+}
+
+// NopLogger is a Logger that does nothing.
+// It can be embedded to implement only some methods of the Logger interface.
+type NopLogger struct{}
+
+// OnStart does nothing.
+func (NopLogger) OnStart(Event) {}
+
+// OnResult does nothing.
+func (NopLogger) OnResult(Event) {}
+
+// OnPick does nothing.
+func (NopLogger) OnPick(WorkerID, TaskID, Tasks) {}
+
+// OnWorkerClose does nothing.
+func (NopLogger) OnWorkerClose(WorkerID) {}
+
+// WithLogger sets the Logger that receives the internal decisions of the engine.
+// A nil logger means no logging (the default).
+func WithLogger(l Logger) Option {
+	return func(o *options) {
+		o.logger = l
+	}
+}
@@ -0,0 +1,138 @@
+package taskengine
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testingLogger records the calls of the Logger methods.
+type testingLogger struct {
+	mu      sync.Mutex
+	starts  []JobID
+	results []JobID
+	picks   map[WorkerID][]TaskID
+	closed  []WorkerID
+	errs    []string
+}
+
+func (l *testingLogger) OnStart(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.starts = append(l.starts, e.JobID)
+}
+
+func (l *testingLogger) OnResult(e Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.results = append(l.results, e.JobID)
+}
+
+func (l *testingLogger) OnPick(wid WorkerID, chosen TaskID, candidates Tasks) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	found := false
+	for _, t := range candidates {
+		found = found || t.TaskID() == chosen
+	}
+	if !found {
+		l.errs = append(l.errs, string(chosen)+" not a candidate of "+string(wid))
+	}
+	l.picks[wid] = append(l.picks[wid], chosen)
+}
+
+func (l *testingLogger) OnWorkerClose(wid WorkerID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = append(l.closed, wid)
+}
+
+func TestEngine_WithLogger(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}, {"t3", 10, true}},
+		"w2": {{"t4", 10, true}},
+	}
+	logger := &testingLogger{picks: map[WorkerID][]TaskID{}}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var starts, results []JobID
+	for e := range out {
+		switch {
+		case e.Type() == EventStart:
+			starts = append(starts, e.JobID)
+		case IsResult(e):
+			results = append(results, e.JobID)
+		}
+	}
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	sortJobIDs := cmp.Transformer("sort", func(in []JobID) []JobID {
+		out := append([]JobID(nil), in...)
+		sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+		return out
+	})
+	if diff := cmp.Diff(starts, logger.starts, sortJobIDs); diff != "" {
+		t.Errorf("OnStart mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(results, logger.results); diff != "" {
+		t.Errorf("OnResult mismatch (-want +got):\n%s", diff)
+	}
+	if len(logger.picks["w1"]) != 3 || len(logger.picks["w2"]) != 1 {
+		t.Errorf("want a pick for each task, got %v", logger.picks)
+	}
+	if len(logger.errs) > 0 {
+		t.Errorf("unexpected picks: %v", logger.errs)
+	}
+	sort.Slice(logger.closed, func(i, j int) bool { return logger.closed[i] < logger.closed[j] })
+	if diff := cmp.Diff([]WorkerID{"w1", "w2"}, logger.closed); diff != "" {
+		t.Errorf("OnWorkerClose mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_WithLogger_Panic(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+	}
+	var mu sync.Mutex
+	var errs []string
+	onErr := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err.Error())
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithLogger(panicLogger{}), WithOnCallbackError(onErr))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results, err := eng.ExecuteAll(context.Background(), AllResults)
+	if err != nil || len(results) != 1 {
+		t.Errorf("want 1 result, got %v (err %v)", results, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if diff := cmp.Diff([]string{"Logger callback panic: pick"}, errs); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// panicLogger is a Logger whose OnPick method panics.
+type panicLogger struct{ NopLogger }
+
+func (panicLogger) OnPick(WorkerID, TaskID, Tasks) { panic("pick") }
@@ -0,0 +1,94 @@
+package taskengine
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// WorkerMetrics contains the metrics of a worker, as seen by a Metrics.
+// They map to the Prometheus metrics:
+//
+//	taskengine_tasks_total{worker, status}           -> Results[status]
+//	taskengine_task_duration_seconds{worker, status} -> Duration[status] (sum), Results[status] (count)
+//	taskengine_worker_busy{worker}                   -> Busy
+type WorkerMetrics struct {
+	WorkerID WorkerID
+	Busy     int                         // jobs in execution
+	Results  map[EventType]int           // number of results, by type
+	Duration map[EventType]time.Duration // total duration of the results, by type
+}
+
+// Metrics collects the metrics of the workers from the events of the executions of the engine,
+// to be exported to a monitoring system (see the Collector of the prometheus subpackage:
+// the taskengine package doesn't depend on the Prometheus client).
+// It is driven by updating it with every event emitted by the ExecuteEvents method,
+// while another goroutine can take the snapshots of the metrics.
+// The metrics accumulate across the executions.
+type Metrics struct {
+	mu      sync.Mutex
+	workers map[WorkerID]*WorkerMetrics
+}
+
+// NewMetrics returns a new empty Metrics.
+func NewMetrics() *Metrics {
+	return &Metrics{workers: map[WorkerID]*WorkerMetrics{}}
+}
+
+// Update updates the metrics with the event.
+// Only the Start and result events are considered.
+func (m *Metrics) Update(e *Event) {
+	etype := e.Type()
+	if etype != EventStart && !IsResult(e) {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	wm := m.workers[e.WorkerID]
+	if wm == nil {
+		wm = &WorkerMetrics{
+			WorkerID: e.WorkerID,
+			Results:  map[EventType]int{},
+			Duration: map[EventType]time.Duration{},
+		}
+		m.workers[e.WorkerID] = wm
+	}
+
+	if etype == EventStart {
+		wm.Busy++
+		return
+	}
+	if wm.Busy > 0 {
+		// a cached result has no Start event
+		wm.Busy--
+	}
+	wm.Results[etype]++
+	wm.Duration[etype] += e.TimeEnd.Sub(e.TimeStart)
+}
+
+// Snapshot returns the metrics of the workers seen so far, sorted by WorkerID.
+func (m *Metrics) Snapshot() []WorkerMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	snap := make([]WorkerMetrics, 0, len(m.workers))
+	for _, wm := range m.workers {
+		s := WorkerMetrics{
+			WorkerID: wm.WorkerID,
+			Busy:     wm.Busy,
+			Results:  make(map[EventType]int, len(wm.Results)),
+			Duration: make(map[EventType]time.Duration, len(wm.Duration)),
+		}
+		for etype, n := range wm.Results {
+			s.Results[etype] = n
+		}
+		for etype, d := range wm.Duration {
+			s.Duration[etype] = d
+		}
+		snap = append(snap, s)
+	}
+	sort.Slice(snap, func(i, j int) bool { return snap[i].WorkerID < snap[j].WorkerID })
+	return snap
+}
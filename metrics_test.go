@@ -0,0 +1,65 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMetrics(t *testing.T) {
+	t0 := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return t0.Add(time.Duration(sec) * time.Second) }
+	task := func(tid string) Task { return &testingTask{tid, 0, true} }
+	start := func(wid WorkerID, tid string, sec int) *Event {
+		return &Event{WorkerID: wid, Task: task(tid), TimeStart: at(sec), TimeEnd: at(sec)}
+	}
+	result := func(s *Event, res Result, sec int) *Event {
+		e := *s
+		e.Result, e.TimeEnd = res, at(sec)
+		return &e
+	}
+
+	s1a := start("a", "t1", 0)
+	s1b := start("b", "t1", 1)
+	s2 := start("a", "t2", 0)
+	s3 := start("a", "t3", 1)
+
+	events := []*Event{
+		s1a, s1b, s2, s3,
+		result(s1a, testingResult{}, 3),
+		result(s1b, testingResult{Err: context.Canceled}, 4),
+		result(s2, testingResult{Err: testingError}, 2),
+		{Task: task("t1"), kind: EventTaskComplete, TimeStart: at(6), TimeEnd: at(6)},
+		nil,
+	}
+	m := NewMetrics()
+	for _, e := range events {
+		m.Update(e)
+	}
+
+	want := []WorkerMetrics{
+		{
+			WorkerID: "a",
+			Busy:     1,
+			Results:  map[EventType]int{EventSuccess: 1, EventError: 1},
+			Duration: map[EventType]time.Duration{EventSuccess: 3 * time.Second, EventError: 2 * time.Second},
+		},
+		{
+			WorkerID: "b",
+			Results:  map[EventType]int{EventCanceled: 1},
+			Duration: map[EventType]time.Duration{EventCanceled: 3 * time.Second},
+		},
+	}
+	got := m.Snapshot()
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Snapshot mismatch (-want +got):\n%s", diff)
+	}
+
+	// the snapshot is a copy
+	got[0].Results[EventSuccess] = 10
+	if n := m.Snapshot()[0].Results[EventSuccess]; n != 1 {
+		t.Errorf("want the metrics unchanged by the snapshot, got %d successes", n)
+	}
+}
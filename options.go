@@ -0,0 +1,541 @@
+package taskengine
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// options contains the optional settings of an Engine.
+type options struct {
+	onReady         func()      // called once after the initial readiness round
+	onCallbackError func(error) // called when a callback panics
+
+	onFirstSuccess func(TaskID, Result) // called at the first success of each task
+
+	aggregator      AggregateFunc // combines the results of each task
+	aggregateQuorum int           // number of results to combine
+
+	maxAttemptsPerTask int // max number of attempts of each task, across all workers
+	retries            int // max number of retries of a failed task by the same worker
+
+	noRecoverWorkPanics bool // a panic of a Work function is not recovered
+
+	cache func(Task) (Result, bool) // returns the cached result of a task
+
+	taskCompleteEvents bool // emits a TaskComplete event for each task
+	summaryEvent       bool // emits a Summary event at the end of the run
+
+	noClone bool // executes the tasks without cloning them
+
+	affinity *Affinity // preferred worker of each task
+
+	scheduler Scheduler // chooses the next task, instead of the default criteria
+
+	logger Logger // receives the internal decisions of the engine
+
+	nextTaskOverride func(WorkerID, Task, Tasks) Task // overrides the next task of a worker
+
+	validateResult func(Task, Result) error // validates the success results
+
+	acquire func(context.Context, WorkerID) error // acquires the resource of a worker instance
+	release func(WorkerID)                        // releases the resource of a worker instance
+
+	emitOnCompletion bool // Execute emits the results of a task when it is completed
+
+	resultBuffer int // buffer size of the results and events chans
+
+	reorderWindow time.Duration          // Execute sorts the results within windows of this duration
+	reorderLess   func(a, b Result) bool // order of the results within a window
+
+	softDeadline func(Task) time.Duration // max duration of a job before a Slow event
+
+	resultEqual ResultEqualFunc // decides if two results are the same
+
+	maxQueueAge time.Duration // max time a task can wait before being started
+
+	subscriberBuffer int // buffer size of the subscribers chans
+
+	maxActiveTasks int // max number of distinct tasks in execution
+
+	maxConcurrent int // max number of Work calls in execution
+
+	cancelGrace func(Task) time.Duration // max wait for the result of a canceled job
+	hardWait    func(Task) time.Duration // max wait for the result of a job
+
+	groupLimits map[string]int // max number of jobs in execution of each group of workers
+
+	parkIdleInstances bool // the instances without tasks wait for new tasks
+
+	reliabilityOrdering bool // offers the tasks to the most reliable workers first
+
+	orderedReadiness bool // offers the first tasks in order of WorkerID and instance
+
+	deterministic bool // executes the jobs one step at a time by the virtual clock
+
+	orderedPick bool // tiebreak of the pick by position in the task list instead of TaskID
+
+	schedulingStats func(SchedulingStats) // receives the scheduling stats of each run
+
+	runStats func(RunStats) // receives the stats of each run
+
+	resultIdleTimeout time.Duration // max time without results before closing the Execute chan
+
+	completionPredicate func(map[TaskID]TaskStat) bool // ends the run before every task is completed
+
+	progressInterval time.Duration          // interval between the progress snapshots
+	progress         func(ProgressSnapshot) // receives the progress snapshots
+}
+
+// Option type is a function that sets an optional setting of the Engine.
+// Options are passed to the NewEngine function.
+type Option func(*options)
+
+// WithRetries sets the max number of times a worker retries a task after an error result
+// (not canceled nor timed out, see EventCanceled), as long as the task has no success.
+// The failed task is re-enqueued in the task list of the worker,
+// so that it can be picked again by the instances of the worker,
+// as a new attempt of the task (see WithMaxAttemptsPerTask).
+// The task is not retried if the worker has no instance left to execute it,
+// or after the hard wait (see WithHardWait).
+// The retry policy of a worker, if any, overrides the retries of the engine (see Worker.Retry).
+// If n is not positive, the failed tasks are not retried (the default).
+func WithRetries(n int) Option {
+	return func(o *options) {
+		o.retries = n
+	}
+}
+
+// WithRecoverWorkPanics sets whether a panic of a Work function is recovered:
+// the job returns a PanicResult error, with the recovered value and the stack trace,
+// and the execution goes on.
+// Otherwise the panic terminates the program.
+// The default is true, so that a bad task never hangs the engine.
+func WithRecoverWorkPanics(enabled bool) Option {
+	return func(o *options) {
+		o.noRecoverWorkPanics = !enabled
+	}
+}
+
+// WithOnReady sets a function that is called once, after each worker instance
+// has been offered its first task (the engine is "warmed up").
+// The function is called even if there are no tasks to execute.
+func WithOnReady(fn func()) Option {
+	return func(o *options) {
+		o.onReady = fn
+	}
+}
+
+// WithOnFirstSuccess sets a function that is called with the first success result
+// of each task, as soon as it is received by the engine:
+// it is called at most once for each task of a run, before the success event is emitted
+// and just after the other jobs of the task have been canceled
+// (i.e. to cancel the external work related to the task).
+// The function is called by the engine goroutine, so it must return quickly.
+func WithOnFirstSuccess(fn func(TaskID, Result)) Option {
+	return func(o *options) {
+		o.onFirstSuccess = fn
+	}
+}
+
+// WithMaxAttemptsPerTask sets the max number of attempts of each task, across all workers.
+// Once a task has k results and none of them is a success,
+// the task is no longer picked and its in-flight jobs are canceled:
+// the canceled results are the final failures of the task.
+// The check is done after the aggregator quorum, if any.
+// If k is not positive, the number of attempts is unlimited (the default).
+func WithMaxAttemptsPerTask(k int) Option {
+	return func(o *options) {
+		o.maxAttemptsPerTask = k
+	}
+}
+
+// WithCache sets a function that returns the cached result of a task, if any.
+//
+// The cache is checked the first time a task is picked to be executed.
+// In case of cache hit, the task is not executed by any worker:
+// its jobs still to do are discarded and its in-flight jobs are canceled, as for a success.
+// The cached result is emitted in a success event of the worker that picked the task,
+// with the Cached field set to true and no preceding Start event.
+// The cached result must have a nil error.
+// If the function panics, it is a cache miss (see WithOnCallbackError).
+func WithCache(fn func(Task) (Result, bool)) Option {
+	return func(o *options) {
+		o.cache = fn
+	}
+}
+
+// WithTaskCompleteEvents sets whether the ExecuteEvents method emits
+// a TaskComplete event when a task is completed,
+// i.e. no worker has to do or is doing the task.
+// The event is emitted once for each task, after its last result (if any),
+// and it contains the final TaskStat of the task.
+// The default is false.
+func WithTaskCompleteEvents(enabled bool) Option {
+	return func(o *options) {
+		o.taskCompleteEvents = enabled
+	}
+}
+
+// WithSummaryEvent sets whether the ExecuteEvents method emits
+// a Summary event at the end of the run, as the last event.
+// The event has no task and its Summary field contains the aggregate counts of the run.
+// The default is false.
+func WithSummaryEvent(enabled bool) Option {
+	return func(o *options) {
+		o.summaryEvent = enabled
+	}
+}
+
+// WithNoClone sets whether the engine executes the tasks without cloning them.
+//
+// By default, each execution works on a copy of the tasks lists,
+// so that the engine can be executed multiple times.
+// With noClone set to true, the execution consumes the tasks lists
+// passed to NewEngine (that are modified in place), saving memory for large task sets:
+// the engine can be executed only once and the following executions return an error.
+func WithNoClone(noClone bool) Option {
+	return func(o *options) {
+		o.noClone = noClone
+	}
+}
+
+// WithNextTaskOverride sets a function that can override the next task
+// chosen by the engine for a ready worker instance.
+// The function receives the WorkerID, the chosen task and the candidate tasks of the worker
+// (i.e. not paused, with the dependencies satisfied and within the max number of active tasks),
+// and it returns the task to execute:
+//
+//   - the chosen task, to keep the engine choice;
+//   - another candidate task, to execute it instead;
+//   - nil, to leave the worker instance idle in this round.
+//
+// An idle instance is offered a task again after each result.
+// If no job is in execution, the idle instances can't get a task anymore,
+// so the remaining tasks of their workers are discarded.
+// Returning a task that is not a candidate is an error reported to the OnCallbackError function:
+// in this case the engine choice is kept.
+func WithNextTaskOverride(fn func(wid WorkerID, chosen Task, candidates Tasks) Task) Option {
+	return func(o *options) {
+		o.nextTaskOverride = fn
+	}
+}
+
+// WithValidateResult sets a function used to validate each success result before accepting it.
+// If the function returns an error, the result is replaced by an *InvalidResult
+// with the validation error, and it is handled as an error result:
+// the other jobs of the task are not canceled.
+func WithValidateResult(fn func(Task, Result) error) Option {
+	return func(o *options) {
+		o.validateResult = fn
+	}
+}
+
+// WithResource sets the functions used to acquire and release
+// a resource (i.e. a connection of a pool shared by the workers) for each worker instance.
+//
+// A worker instance is ready to work only after the acquire function returns.
+// If acquire returns an error, the instance will not execute any task;
+// if no instance of a worker can acquire the resource, the tasks of the worker are discarded.
+// The release function, if not nil, is called when the instance becomes idle
+// because there are no more tasks for the worker.
+//
+// The acquire function is called concurrently by the instances
+// with the context passed to the Execute method.
+// A panic of the acquire function is handled as an error (see WithOnCallbackError).
+func WithResource(acquire func(ctx context.Context, wid WorkerID) error, release func(wid WorkerID)) Option {
+	return func(o *options) {
+		o.acquire = acquire
+		o.release = release
+	}
+}
+
+// WithEmitOnCompletion sets whether the Execute method buffers the results of each task
+// and emits them together, in order of arrival, once the task is completed
+// (i.e. no worker has to do or is doing the task), regardless of the mode.
+// The results of the tasks completed without a final result, if any,
+// are emitted at the end of the execution.
+// It trades latency for grouping: the default is false,
+// and the results are emitted as soon as they arrive.
+func WithEmitOnCompletion(enabled bool) Option {
+	return func(o *options) {
+		o.emitOnCompletion = enabled
+	}
+}
+
+// WithResultBuffer sets the buffer size of the chans returned by the Execute methods
+// (i.e. Execute, ExecuteEvents and ExecuteWithRunningStats).
+// With unbuffered chans, a slow consumer back-pressures the engine: the results of the workers
+// wait to be received before the next tasks are assigned.
+// A buffer decouples the engine from the consumer, that can process up to n results (or events)
+// while the execution goes on, at the cost of the memory of the buffered items.
+// If n is not positive, the chans are unbuffered (the default).
+func WithResultBuffer(n int) Option {
+	return func(o *options) {
+		o.resultBuffer = n
+	}
+}
+
+// resultBufferSize returns the buffer size of the results and events chans.
+func (o *options) resultBufferSize() int {
+	if o.resultBuffer < 0 {
+		return 0
+	}
+	return o.resultBuffer
+}
+
+// WithReorderWindow sets the Execute method to emit the results roughly ordered:
+// the results are buffered for the d duration, starting from the first result of the window,
+// then they are sorted by the less function and emitted.
+// The final partial window is emitted when the execution ends.
+// It gives an approximate ordering without waiting for the completion of the execution.
+// If d is not positive or less is nil, the results are emitted as soon as they arrive (the default).
+func WithReorderWindow(d time.Duration, less func(a, b Result) bool) Option {
+	return func(o *options) {
+		o.reorderWindow = d
+		o.reorderLess = less
+	}
+}
+
+// WithSoftDeadline sets a function that returns the soft deadline of a task,
+// i.e. the max expected duration of the execution of the task by a worker.
+// If a job is still in execution after the soft deadline,
+// the ExecuteEvents method emits a Slow event for the job, as a warning:
+// the job is not canceled and it goes on normally until the result.
+// A not positive duration means no soft deadline for the task.
+func WithSoftDeadline(fn func(Task) time.Duration) Option {
+	return func(o *options) {
+		o.softDeadline = fn
+	}
+}
+
+// WithMaxQueueAge sets the max time a task can wait, since it became eligible,
+// before being started by a worker.
+// When a worker picks a task never started that waited longer than d,
+// the task is dropped: it is discarded for every worker
+// and the ExecuteEvents method emits an Expired event for it.
+// A not positive duration means no limit (the default).
+func WithMaxQueueAge(d time.Duration) Option {
+	return func(o *options) {
+		o.maxQueueAge = d
+	}
+}
+
+// WithMaxActiveTasks sets the max number of distinct tasks in execution at once, across all workers,
+// i.e. to limit the working set (the memory used by each task in execution).
+// Once k tasks are in execution, a ready worker instance can only execute one of them
+// (adding redundancy), even if the worker has other tasks to do:
+// if none, the instance is idle until a task is completed.
+// If k is not positive, the number of tasks is unlimited (the default).
+func WithMaxActiveTasks(k int) Option {
+	return func(o *options) {
+		o.maxActiveTasks = k
+	}
+}
+
+// WithMaxConcurrent sets the max number of Work calls in execution at once,
+// across all the workers and instances, i.e. to protect a downstream service.
+// The instance that receives a job when the limit is reached blocks
+// until another Work call returns: its Start event is emitted once the job can start.
+// The limit is shared by the concurrent runs of the engine.
+// If the task context is done while waiting, the job is not started
+// and its result is a NotStartedResult.
+// If n is not positive, the number of Work calls is unlimited (the default).
+func WithMaxConcurrent(n int) Option {
+	return func(o *options) {
+		o.maxConcurrent = n
+	}
+}
+
+// WithCancelGrace sets a function that returns the cancel grace period of a task,
+// i.e. the max time the engine waits for the result of a job
+// after canceling it (because the task succeeded elsewhere or it was given up).
+//
+// By default, the engine waits for the result of each canceled job,
+// so a worker that ignores the cancellation delays the end of the run.
+// After the grace period, the job is abandoned: the ExecuteEvents method emits
+// a Canceled event with an AbandonedResult, and the run goes on without it.
+// The worker instance executes no other task until the real result is returned,
+// that is then discarded.
+// A not positive duration means no grace period for the task.
+func WithCancelGrace(fn func(Task) time.Duration) Option {
+	return func(o *options) {
+		o.cancelGrace = fn
+	}
+}
+
+// WithHardWait sets a function that returns the hard wait of a task,
+// i.e. the max time the engine waits for the result of a job of the task,
+// regardless of the context, to protect the scheduler from a worker
+// that doesn't honor the cancellation.
+//
+// After the hard wait, the job is abandoned: the ExecuteEvents method emits
+// an Error event with a HardWaitResult and the run goes on without it,
+// as if the job returned the error (so the task can be done by other workers).
+// If the job was canceled in the meantime, a Canceled event with an AbandonedResult is emitted instead.
+// NOTE: the engine can't stop the job, whose goroutine keeps running in the background:
+// the worker instance executes no other task until the real result is returned,
+// that is then discarded, and a job that never returns leaks its goroutine.
+// A not positive duration means no hard wait for the task.
+func WithHardWait(fn func(Task) time.Duration) Option {
+	return func(o *options) {
+		o.hardWait = fn
+	}
+}
+
+// WithGroupLimits sets the max number of jobs in execution at the same time
+// by the instances of the workers of each group (see Worker.Group):
+// the limit is shared by the workers of the group, as a semaphore.
+// A worker instance that is ready when the limit of its group is reached
+// waits for a job of the group to return.
+// The groups without a limit are not limited.
+// NewEngine returns a *ConfigError of InvalidGroupLimit kind
+// if a limit is not positive or its group has no worker.
+func WithGroupLimits(limits map[string]int) Option {
+	return func(o *options) {
+		o.groupLimits = limits
+	}
+}
+
+// WithParkIdleInstances sets whether the instances of a worker without tasks
+// are parked, waiting for new tasks added by the AddTasks method,
+// instead of being terminated.
+// With parked idle instances, the run doesn't end when the tasks are completed:
+// it ends when the context passed to the Execute method is canceled
+// and the tasks in execution are completed.
+// The default is false.
+func WithParkIdleInstances(enabled bool) Option {
+	return func(o *options) {
+		o.parkIdleInstances = enabled
+	}
+}
+
+// WithOrderedReadiness sets whether the worker instances are offered their first task
+// in a defined order, regardless of the order their readiness signals arrive:
+// the engine waits for the whole initial readiness round,
+// then it offers the tasks by WorkerID and instance number
+// (after the priority and the reliability of the workers, see Worker.Priority and WithReliabilityOrdering).
+// It makes the first task assignment deterministic, i.e. for tests.
+// The OnReady function, if any, is called after the tasks have been offered.
+// The default is false, and each instance is offered a task as soon as it is ready.
+func WithOrderedReadiness(enabled bool) Option {
+	return func(o *options) {
+		o.orderedReadiness = enabled
+	}
+}
+
+// WithOrderedPick sets whether the default criteria to choose the next task of a worker
+// (see DefaultPicker) break the ties by the position of the tasks in the task list of the worker,
+// in order of insertion, instead of by TaskID:
+// among the tasks with the same stat, the one submitted first is chosen.
+// The tasks added during the execution (see AddTasks) follow the ones already in the list,
+// and a retried task keeps its original position.
+// The task list of the worker keeps the order of insertion as the tasks are picked
+// (i.e. the candidates passed to the Logger).
+// It is ignored with a custom Scheduler (or Picker); the Preview method doesn't consider it.
+// The default is false.
+func WithOrderedPick(enabled bool) Option {
+	return func(o *options) {
+		o.orderedPick = enabled
+	}
+}
+
+// WithResultIdleTimeout sets the max time the Execute method waits for the next result
+// (i.e. the next result exported by the mode) as a safety valve against a stalled run.
+// If no result is produced within d, the run is canceled and the result chan is closed:
+// the results not yet sent on the chan (see WithReorderWindow and WithEmitOnCompletion)
+// and the following ones are discarded.
+// A not positive duration means no timeout (the default).
+func WithResultIdleTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.resultIdleTimeout = d
+	}
+}
+
+// WithCompletionPredicate sets a function that decides if the run can end
+// before every task is completed, i.e. as soon as each task has a success or is doomed,
+// without waiting for the redundant attempts.
+// The function receives a copy of the stat of each task and it is called by the engine
+// after each status change: once it returns true, the run ends.
+// The jobs still in execution are canceled and their results are discarded,
+// as the tasks never started.
+// The run always ends when every task is completed, regardless of the predicate.
+func WithCompletionPredicate(fn func(map[TaskID]TaskStat) bool) Option {
+	return func(o *options) {
+		o.completionPredicate = fn
+	}
+}
+
+// WithResultEqual sets the function used by the engine to decide
+// if two results are the same, i.e. to discard the duplicate results of a task
+// collected by the ExecuteAll method (see WithDistinctResults).
+// If fn is nil, the ResultEqual function is used (the default).
+func WithResultEqual(fn ResultEqualFunc) Option {
+	return func(o *options) {
+		o.resultEqual = fn
+	}
+}
+
+// equal returns true if the results are the same,
+// based on the ResultEqual option.
+func (o *options) equal(a, b Result) bool {
+	if o.resultEqual == nil {
+		return ResultEqual(a, b)
+	}
+	return o.resultEqual(a, b)
+}
+
+// WithOnCallbackError sets a function that is called with an error
+// when a user callback (i.e. OnReady or the aggregate function) panics,
+// or when a batch of tasks received by the ServeTasks method is invalid
+// (or a stage of the Pipe function fails).
+// The panic is always recovered, so that the engine goes on with the execution;
+// if no function is set, the panic is silently ignored.
+// The function may be called concurrently by the goroutines of the engine (and of its runs),
+// so it must be safe for concurrent use; a panic of the function itself is recovered and ignored.
+func WithOnCallbackError(fn func(error)) Option {
+	return func(o *options) {
+		o.onCallbackError = fn
+	}
+}
+
+// validate checks the options are compatible with each other.
+// It returns a *ConfigError of IncompatibleOptions kind otherwise.
+func (o *options) validate() error {
+	incompatible := func(detail string) error {
+		return &ConfigError{Kind: IncompatibleOptions, Detail: detail}
+	}
+	if o.aggregator != nil && o.maxAttemptsPerTask > 0 && o.aggregateQuorum > o.maxAttemptsPerTask {
+		return incompatible("the aggregator quorum can't be reached within the max attempts per task")
+	}
+	if o.emitOnCompletion && o.reorderWindow > 0 && o.reorderLess != nil {
+		return incompatible("the results can't be both emitted on completion and reordered within a window")
+	}
+	if !isDefaultScheduler(o.scheduler) && o.affinity != nil {
+		return incompatible("the affinity is ignored by a custom scheduler")
+	}
+	return nil
+}
+
+// safeCall calls the fn callback recovering from panic.
+// In case of panic, it calls the OnCallbackError function, if any, and returns false.
+func (o *options) safeCall(name string, fn func()) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+			o.callbackError(fmt.Errorf("%s callback panic: %v", name, r))
+		}
+	}()
+	fn()
+	return true
+}
+
+// callbackError calls the OnCallbackError function, if any, with the error.
+// A panic of the function is recovered and ignored.
+func (o *options) callbackError(err error) {
+	if o.onCallbackError == nil {
+		return
+	}
+	defer func() { _ = recover() }()
+	o.onCallbackError(err)
+}
@@ -0,0 +1,1680 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEngine_WithOnCallbackError(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t1", 20, true}},
+	}
+
+	tests := map[string]struct {
+		opts    []Option
+		wantErr []string
+	}{
+		"OnReady": {
+			opts: []Option{
+				WithOnReady(func() { panic("ready") }),
+			},
+			wantErr: []string{"OnReady callback panic: ready"},
+		},
+		"Aggregate": {
+			opts: []Option{
+				WithAggregator(0, func(TaskID, []Result) Result { panic("aggr") }),
+			},
+			wantErr: []string{
+				"Aggregate callback panic: aggr",
+				"Aggregate callback panic: aggr",
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			gotErr := []string{}
+			onErr := func(err error) { gotErr = append(gotErr, err.Error()) }
+
+			opts := append(tt.opts, WithOnCallbackError(onErr))
+			eng, err := NewEngine(workers, testingWorkerTasks(input), opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			results := 0
+			for e := range events {
+				if IsResult(e) {
+					results++
+				}
+			}
+			if results != 3 {
+				t.Errorf("want 3 results, got %d", results)
+			}
+			if strings.Join(gotErr, "\n") != strings.Join(tt.wantErr, "\n") {
+				t.Errorf("want errors %q, got %q", tt.wantErr, gotErr)
+			}
+		})
+	}
+}
+
+func TestEngine_WithOnCallbackError_Unset(t *testing.T) {
+	eng, err := NewEngine(nil, nil, WithOnReady(func() { panic("ready") }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range events {
+	}
+}
+
+func TestEngine_WithOnCallbackError_Panic(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+	}
+
+	// the panics of the OnCallbackError function are recovered,
+	// both for the panics of the callbacks and for the other errors.
+	var mu sync.Mutex
+	calls := 0
+	onErr := func(err error) {
+		mu.Lock()
+		calls++
+		mu.Unlock()
+		panic(err)
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input),
+		WithOnReady(func() { panic("ready") }),
+		WithScheduler(outOfRangeScheduler{}),
+		WithOnCallbackError(onErr))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.Execute(context.Background(), FirstSuccessOrLastResult)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	got := 0
+	for range out {
+		got++
+	}
+	if got != 2 {
+		t.Errorf("want 2 results, got %d", got)
+	}
+	if calls < 2 {
+		t.Errorf("want at least 2 calls of OnCallbackError, got %d", calls)
+	}
+}
+
+func TestEngine_WithResource(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t1", 20, true}, {"t3", 10, true}},
+	}
+
+	gate := make(chan struct{})
+	var mu sync.Mutex
+	acquired, released := 0, 0
+
+	acquire := func(ctx context.Context, wid WorkerID) error {
+		<-gate
+		mu.Lock()
+		defer mu.Unlock()
+		acquired++
+		return nil
+	}
+	release := func(wid WorkerID) {
+		mu.Lock()
+		defer mu.Unlock()
+		released++
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithResource(acquire, release))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	timeGate := time.Now()
+	close(gate)
+
+	results := 0
+	for e := range out {
+		if e.TimeStart.Before(timeGate) {
+			t.Errorf("%v: started before the resource was acquired", e)
+		}
+		if IsResult(e) {
+			results++
+		}
+	}
+
+	if results != 4 {
+		t.Errorf("want 4 results, got %d", results)
+	}
+	// the release is called by the instance goroutine after the worker chan is closed
+	time.Sleep(10 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if acquired != 3 || released != 3 {
+		t.Errorf("want 3 acquired and released, got %d acquired and %d released", acquired, released)
+	}
+}
+
+func TestEngine_WithResource_Error(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+		"w2": {{"t1", 20, true}, {"t2", 10, true}},
+	}
+
+	acquire := func(ctx context.Context, wid WorkerID) error {
+		if wid == "w2" {
+			return errors.New("no connection available")
+		}
+		return nil
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithResource(acquire, nil))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := []Event{}
+	for e := range out {
+		events = append(events, *e)
+	}
+
+	want := []testingEventsGroup{
+		{{"w1", "t1", EventStart}},
+		{{"w1", "t1", EventSuccess}},
+	}
+	if diff := testingEventsDiff(want, events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_WithResource_Panic(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+		"w2": {{"t1", 20, true}, {"t2", 10, true}},
+	}
+
+	acquire := func(ctx context.Context, wid WorkerID) error {
+		if wid == "w2" {
+			panic("acquire")
+		}
+		return nil
+	}
+	release := func(wid WorkerID) { panic("release") }
+	// NOTE: the release function is called by the instance after its last job
+	errc := make(chan error, 3)
+	onError := func(err error) { errc <- err }
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithResource(acquire, release), WithOnCallbackError(onError))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := []Event{}
+	for e := range out {
+		events = append(events, *e)
+	}
+
+	// the instances of w2 are unavailable
+	want := []testingEventsGroup{
+		{{"w1", "t1", EventStart}},
+		{{"w1", "t1", EventSuccess}},
+	}
+	if diff := testingEventsDiff(want, events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	for j := 0; j < 3; j++ {
+		select {
+		case <-errc:
+		case <-time.After(time.Second):
+			t.Fatalf("want 3 callback errors, got %d", j)
+		}
+	}
+}
+
+func TestEngine_WithCache(t *testing.T) {
+	var mu sync.Mutex
+	executed := map[string]int{}
+	workFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		mu.Lock()
+		executed[string(task.TaskID())]++
+		mu.Unlock()
+		return testingWorkFn(ctx, worker, workerInst, task)
+	}
+
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: workFn},
+		{WorkerID: "w2", Instances: 2, Work: workFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, false}},
+		"w2": {{"t1", 20, true}, {"t2", 20, false}, {"t3", 20, true}},
+	}
+	cache := func(task Task) (Result, bool) {
+		if task.TaskID() == "t2" {
+			return &testingResult{Tid: "t2", Wid: "cache"}, true
+		}
+		return nil, false
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithCache(cache))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.Execute(context.Background(), FirstSuccessOrLastResult)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results := map[string]testingResult{}
+	for res := range out {
+		tr := *res.(*testingResult)
+		if _, ok := results[tr.Tid]; ok {
+			t.Errorf("task %s: more than one result", tr.Tid)
+		}
+		results[tr.Tid] = tr
+	}
+
+	if len(results) != 3 {
+		t.Errorf("want 3 results, got %d", len(results))
+	}
+	if got := results["t2"]; got.Wid != "cache" || got.Err != nil {
+		t.Errorf("t2: want cached success, got %v", got)
+	}
+	if n := executed["t2"]; n != 0 {
+		t.Errorf("t2: cached task executed %d times", n)
+	}
+	if n := executed["t1"]; n == 0 {
+		t.Errorf("t1: not cached task not executed")
+	}
+}
+
+func TestEngine_WithCache_Events(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+	cache := func(task Task) (Result, bool) {
+		return &testingResult{Tid: string(task.TaskID()), Wid: "cache"}, task.TaskID() == "t1"
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithCache(cache))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := []Event{}
+	for e := range out {
+		if e.Cached != (e.Task.TaskID() == "t1") {
+			t.Errorf("%v: unexpected Cached=%v", e, e.Cached)
+		}
+		events = append(events, *e)
+	}
+
+	want := []testingEventsGroup{
+		{{"w1", "t1", EventSuccess}},
+		{{"w1", "t2", EventStart}},
+		{{"w1", "t2", EventSuccess}},
+	}
+	if diff := testingEventsDiff(want, events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_WithCache_Panic(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+	cache := func(task Task) (Result, bool) {
+		if task.TaskID() == "t1" {
+			panic("cache")
+		}
+		return nil, false
+	}
+	var errs []error
+	onError := func(err error) { errs = append(errs, err) }
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithCache(cache), WithOnCallbackError(onError))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := []Event{}
+	for e := range out {
+		events = append(events, *e)
+	}
+
+	// the panic is a cache miss: the task is executed
+	want := []testingEventsGroup{
+		{{"w1", "t1", EventStart}},
+		{{"w1", "t1", EventSuccess}},
+		{{"w1", "t2", EventStart}},
+		{{"w1", "t2", EventSuccess}},
+	}
+	if diff := testingEventsDiff(want, events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if len(errs) != 1 {
+		t.Errorf("want 1 callback error, got %v", errs)
+	}
+}
+
+func TestEngine_WithNextTaskOverride(t *testing.T) {
+	// lastTask returns the candidate with the greatest TaskID
+	lastTask := func(wid WorkerID, chosen Task, candidates Tasks) Task {
+		last := chosen
+		for _, t := range candidates {
+			if t.TaskID() > last.TaskID() {
+				last = t
+			}
+		}
+		return last
+	}
+
+	// idleOnce leaves idle the w2 worker in the first round
+	idleOnce := func() func(WorkerID, Task, Tasks) Task {
+		calls := 0
+		return func(wid WorkerID, chosen Task, candidates Tasks) Task {
+			if wid != "w2" {
+				return chosen
+			}
+			calls++
+			if calls == 1 {
+				return nil
+			}
+			return chosen
+		}
+	}
+
+	alwaysNil := func(WorkerID, Task, Tasks) Task { return nil }
+
+	notCandidate := func(WorkerID, Task, Tasks) Task { return &testingTask{"t999", 0, true} }
+
+	tests := map[string]struct {
+		override func(WorkerID, Task, Tasks) Task
+		input    map[string]testingTasks
+		want     []testingEventsGroup
+		wantErr  int
+	}{
+		"last task": {
+			override: lastTask,
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, true}},
+			},
+			want: []testingEventsGroup{
+				{{"w1", "t3", EventStart}},
+				{{"w1", "t3", EventSuccess}},
+				{{"w1", "t2", EventStart}},
+				{{"w1", "t2", EventSuccess}},
+				{{"w1", "t1", EventStart}},
+				{{"w1", "t1", EventSuccess}},
+			},
+		},
+		"idle once": {
+			override: idleOnce(),
+			input: map[string]testingTasks{
+				"w1": {{"t1", 20, true}},
+				"w2": {{"t2", 10, true}},
+			},
+			want: []testingEventsGroup{
+				{{"w1", "t1", EventStart}},
+				{{"w1", "t1", EventSuccess}},
+				{{"w2", "t2", EventStart}},
+				{{"w2", "t2", EventSuccess}},
+			},
+		},
+		"always nil": {
+			override: alwaysNil,
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, true}},
+				"w2": {{"t1", 10, true}, {"t2", 10, true}},
+			},
+			want: nil,
+		},
+		"not a candidate": {
+			override: notCandidate,
+			input: map[string]testingTasks{
+				"w1": {{"t1", 10, true}},
+			},
+			want: []testingEventsGroup{
+				{{"w1", "t1", EventStart}},
+				{{"w1", "t1", EventSuccess}},
+			},
+			wantErr: 1,
+		},
+	}
+
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			errs := 0
+			eng, err := NewEngine(workers, testingWorkerTasks(tt.input),
+				WithNextTaskOverride(tt.override),
+				WithOnCallbackError(func(error) { errs++ }))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events := []Event{}
+			for e := range out {
+				events = append(events, *e)
+			}
+			if diff := testingEventsDiff(tt.want, events); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+			if errs != tt.wantErr {
+				t.Errorf("want %d callback errors, got %d", tt.wantErr, errs)
+			}
+		})
+	}
+}
+
+func TestEngine_WithNextTaskOverride_Candidates(t *testing.T) {
+	// the override always prefers t2, that depends on t1
+	var candidates []TaskID
+	override := func(wid WorkerID, chosen Task, cands Tasks) Task {
+		for _, t := range cands {
+			candidates = append(candidates, t.TaskID())
+			if t.TaskID() == "t2" {
+				return t
+			}
+		}
+		return chosen
+	}
+	workFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		return testingWorkFn(ctx, worker, workerInst, task.(*testingDepsTask).testingTask)
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: workFn},
+	}
+	wts := WorkerTasks{
+		"w1": {testingDeps("t2", 10, true, "t1"), testingDeps("t1", 10, true)},
+	}
+	eng, err := NewEngine(workers, wts, WithNextTaskOverride(override))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := []Event{}
+	for e := range out {
+		events = append(events, *e)
+	}
+	want := []testingEventsGroup{
+		{{"w1", "t1", EventStart}},
+		{{"w1", "t1", EventSuccess}},
+		{{"w1", "t2", EventStart}},
+		{{"w1", "t2", EventSuccess}},
+	}
+	if diff := testingEventsDiff(want, events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]TaskID{"t1", "t2"}, candidates); diff != "" {
+		t.Errorf("candidates mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_WithValidateResult(t *testing.T) {
+	errInvalid := errors.New("invalid result")
+
+	// the results of the w1 worker are rejected
+	validate := func(task Task, res Result) error {
+		if res.(*testingResult).Wid == "w1" {
+			return errInvalid
+		}
+		return nil
+	}
+
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+		"w2": {{"t1", 30, true}},
+		"w3": {{"t1", 100, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithValidateResult(validate))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := []Event{}
+	for e := range out {
+		if e.WorkerID == "w1" && e.Task.TaskID() == "t1" && IsResult(e) {
+			ires, ok := e.Result.(*InvalidResult)
+			if !ok || ires.Err != errInvalid || ires.Result.Error() != nil {
+				t.Errorf("%v: want invalid result, got %#v", e, e.Result)
+			}
+		}
+		events = append(events, *e)
+	}
+
+	want := []testingEventsGroup{
+		{{"w1", "t1", EventStart}, {"w2", "t1", EventStart}, {"w3", "t1", EventStart}},
+		{{"w1", "t1", EventError}},
+		{{"w2", "t1", EventSuccess}},
+		{{"w3", "t1", EventCanceled}},
+	}
+	if diff := testingEventsDiff(want, events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_WithEmitOnCompletion(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, false}},
+		"w2": {{"t1", 100, false}},
+		"w3": {{"t2", 50, true}},
+	}
+
+	tests := map[string]struct {
+		enabled bool
+		want    []string // Tid/Wid of the results, in order
+	}{
+		"streaming": {
+			enabled: false,
+			want:    []string{"t1/w1", "t2/w3", "t1/w2"},
+		},
+		"on completion": {
+			enabled: true,
+			want:    []string{"t2/w3", "t1/w1", "t1/w2"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			eng, err := NewEngine(workers, testingWorkerTasks(input), WithEmitOnCompletion(tt.enabled))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.Execute(context.Background(), SuccessOrErrorResults)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := []string{}
+			for res := range out {
+				r := res.(*testingResult)
+				got = append(got, r.Tid+"/"+r.Wid)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEngine_WithSoftDeadline(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 150, true}, {"t2", 10, true}},
+	}
+	soft := func(task Task) time.Duration { return 50 * time.Millisecond }
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithSoftDeadline(soft))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	slow := map[TaskID]int{}
+	success := map[TaskID]bool{}
+	for e := range out {
+		tid := e.Task.TaskID()
+		switch e.Type() {
+		case EventSlow:
+			if success[tid] {
+				t.Errorf("%v: Slow event after the result", e)
+			}
+			if d := e.TimeEnd.Sub(e.TimeStart); d < 50*time.Millisecond {
+				t.Errorf("%v: Slow event after %v", e, d)
+			}
+			slow[tid]++
+		case EventSuccess:
+			success[tid] = true
+		}
+	}
+
+	if slow["t1"] != 1 || slow["t2"] != 0 {
+		t.Errorf("want 1 Slow event for t1 only, got %v", slow)
+	}
+	if !success["t1"] || !success["t2"] {
+		t.Errorf("want success for each task, got %v", success)
+	}
+}
+
+func TestEngine_WithReorderWindow(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 5, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t3", 10, true}, {"t1", 20, true}, {"t2", 30, true}, {"t5", 200, true}, {"t4", 220, true}},
+	}
+	byTaskID := func(a, b Result) bool {
+		return a.(*testingResult).Tid < b.(*testingResult).Tid
+	}
+
+	tests := map[string]struct {
+		window time.Duration
+		want   string
+	}{
+		"no window": {
+			window: 0,
+			want:   "t3 t1 t2 t5 t4",
+		},
+		// the first window goes from t3 to t3+100ms,
+		// the second partial window is flushed at the end
+		"window": {
+			window: 100 * time.Millisecond,
+			want:   "t1 t2 t3 t4 t5",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			eng, err := NewEngine(workers, testingWorkerTasks(input), WithReorderWindow(tt.window, byTaskID))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.Execute(context.Background(), SuccessOrErrorResults)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := []string{}
+			for res := range out {
+				got = append(got, res.(*testingResult).Tid)
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("want %q, got %q", tt.want, strings.Join(got, " "))
+			}
+		})
+	}
+}
+
+func TestWithResultEqual(t *testing.T) {
+	a := testingResult{Wid: "w1"}
+	b := testingResult{Wid: "w2"}
+
+	o := &options{}
+	if !o.equal(a, b) {
+		t.Errorf("default: want equal results")
+	}
+
+	sameWorker := func(x, y Result) bool { return x.(testingResult).Wid == y.(testingResult).Wid }
+	WithResultEqual(sameWorker)(o)
+	if o.equal(a, b) {
+		t.Errorf("custom: want different results")
+	}
+	if !o.equal(a, a) {
+		t.Errorf("custom: want equal results")
+	}
+}
+
+func TestEngine_WithMaxQueueAge(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 100, true}, {"t2", 10, true}, {"t3", 10, true}},
+		"w2": {{"t4", 10, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithMaxQueueAge(50*time.Millisecond))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := []Event{}
+	for e := range out {
+		if e.Type() == EventExpired {
+			if !e.TaskStat.Completed() || e.TaskStat.Done != 0 {
+				t.Errorf("%v: unexpected stat of expired task", e)
+			}
+			if e.QueueWait() < 50*time.Millisecond {
+				t.Errorf("%v: want queue wait >= 50ms, got %v", e, e.QueueWait())
+			}
+		}
+		events = append(events, *e)
+	}
+
+	// t2 and t3 wait for t1 to be executed by the only instance of w1, and they expire
+	want := []testingEventsGroup{
+		{{"w1", "t1", EventStart}, {"w2", "t4", EventStart}},
+		{{"w2", "t4", EventSuccess}},
+		{{"w1", "t1", EventSuccess}},
+		{{"w1", "t2", EventExpired}},
+		{{"w1", "t3", EventExpired}},
+	}
+	if diff := testingEventsDiff(want, events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_WithMaxActiveTasks(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 4, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 30, true}, {"t2", 30, true}, {"t3", 30, true}, {"t4", 30, true}, {"t5", 30, true}, {"t6", 30, true}},
+		"w2": {{"t1", 60, true}, {"t2", 60, true}, {"t3", 60, true}, {"t4", 60, true}, {"t5", 60, true}, {"t6", 60, true}},
+	}
+	const k = 2
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithMaxActiveTasks(k))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	doing := map[TaskID]int{}
+	success := map[TaskID]bool{}
+	maxActive := 0
+	for e := range out {
+		tid := e.Task.TaskID()
+		switch {
+		case e.Type() == EventStart:
+			doing[tid]++
+			if len(doing) > maxActive {
+				maxActive = len(doing)
+			}
+		case IsResult(e):
+			doing[tid]--
+			if doing[tid] == 0 {
+				delete(doing, tid)
+			}
+			if e.Type() == EventSuccess {
+				success[tid] = true
+			}
+		}
+	}
+
+	if maxActive != k {
+		t.Errorf("want max %d active tasks, got %d", k, maxActive)
+	}
+	if len(success) != 6 {
+		t.Errorf("want a success for each of the 6 tasks, got %v", success)
+	}
+}
+
+func TestEngine_WithCancelGrace(t *testing.T) {
+	// stubbornWorkFn ignores the cancellation until the end of the job
+	stubbornWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		time.Sleep(300 * time.Millisecond)
+		return &testingResult{Tid: string(task.TaskID()), Wid: string(worker.WorkerID), Err: ctx.Err()}
+	}
+
+	tests := map[string]struct {
+		grace     time.Duration
+		abandoned bool
+	}{
+		"abandoned":    {grace: 30 * time.Millisecond, abandoned: true},
+		"not expired":  {grace: time.Second, abandoned: false},
+		"no grace":     {grace: 0, abandoned: false},
+		"not positive": {grace: -time.Second, abandoned: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			workers := []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 1, Work: stubbornWorkFn},
+			}
+			input := map[string]testingTasks{
+				"w1": {{"t1", 10, true}},
+				"w2": {{"t1", 0, true}},
+			}
+			grace := func(Task) time.Duration { return tt.grace }
+
+			eng, err := NewEngine(workers, testingWorkerTasks(input), WithCancelGrace(grace))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			start := time.Now()
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var canceled *Event
+			for e := range out {
+				if e.Type() == EventCanceled {
+					canceled = e
+				}
+			}
+			elapsed := time.Since(start)
+
+			if canceled == nil {
+				t.Fatalf("want a Canceled event")
+			}
+			if canceled.WorkerID != "w2" {
+				t.Errorf("want Canceled event of w2, got %v", canceled)
+			}
+			if got := errors.Is(canceled.Result.Error(), ErrAbandoned); got != tt.abandoned {
+				t.Errorf("want abandoned %v, got %v", tt.abandoned, got)
+			}
+			if tt.abandoned && elapsed >= 200*time.Millisecond {
+				t.Errorf("want the run to end after the grace period, got %v", elapsed)
+			}
+			if !tt.abandoned && elapsed < 300*time.Millisecond {
+				t.Errorf("want the run to wait for the canceled job, got %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestEngine_WithHardWait(t *testing.T) {
+	// stubbornWorkFn ignores the cancellation until the end of the job
+	stubbornWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		time.Sleep(300 * time.Millisecond)
+		return &testingResult{Tid: string(task.TaskID()), Wid: string(worker.WorkerID), Err: ctx.Err()}
+	}
+
+	tests := map[string]struct {
+		wait      time.Duration
+		abandoned bool
+	}{
+		"abandoned":    {wait: 30 * time.Millisecond, abandoned: true},
+		"not expired":  {wait: time.Second, abandoned: false},
+		"no wait":      {wait: 0, abandoned: false},
+		"not positive": {wait: -time.Second, abandoned: false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			workers := []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: stubbornWorkFn},
+			}
+			input := map[string]testingTasks{
+				"w1": {{"t1", 0, true}},
+			}
+			wait := func(Task) time.Duration { return tt.wait }
+
+			eng, err := NewEngine(workers, testingWorkerTasks(input), WithHardWait(wait))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			start := time.Now()
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			var results []*Event
+			for e := range out {
+				if IsResult(e) {
+					results = append(results, e)
+				}
+			}
+			elapsed := time.Since(start)
+
+			if len(results) != 1 {
+				t.Fatalf("want 1 result, got %v", results)
+			}
+			want := EventSuccess
+			if tt.abandoned {
+				want = EventError
+			}
+			if got := results[0].Type(); got != want {
+				t.Errorf("want %v event, got %v", want, got)
+			}
+			if got := errors.Is(results[0].Result.Error(), ErrHardWait); got != tt.abandoned {
+				t.Errorf("want abandoned %v, got %v", tt.abandoned, got)
+			}
+			if tt.abandoned && elapsed >= 200*time.Millisecond {
+				t.Errorf("want the run to end after the hard wait, got %v", elapsed)
+			}
+			if !tt.abandoned && elapsed < 300*time.Millisecond {
+				t.Errorf("want the run to wait for the job, got %v", elapsed)
+			}
+		})
+	}
+}
+
+func TestEngine_WithGroupLimits(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := map[string]int{}, map[string]int{}
+	groupWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		mu.Lock()
+		running[worker.Group]++
+		if running[worker.Group] > maxRunning[worker.Group] {
+			maxRunning[worker.Group] = running[worker.Group]
+		}
+		mu.Unlock()
+		res := testingWorkFn(ctx, worker, workerInst, task)
+		mu.Lock()
+		running[worker.Group]--
+		mu.Unlock()
+		return res
+	}
+
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: groupWorkFn, Group: "g1"},
+		{WorkerID: "w2", Instances: 2, Work: groupWorkFn, Group: "g1"},
+		{WorkerID: "w3", Instances: 2, Work: groupWorkFn, Group: "g2"},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 20, true}, {"t2", 20, true}, {"t3", 20, true}},
+		"w2": {{"t4", 20, true}, {"t5", 20, true}, {"t6", 20, true}},
+		"w3": {{"t7", 20, true}, {"t8", 20, true}, {"t9", 20, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithGroupLimits(map[string]int{"g1": 3, "g2": 1}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.Execute(context.Background(), SuccessOrErrorResults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	success := 0
+	for res := range out {
+		if res.Error() == nil {
+			success++
+		}
+	}
+
+	if success != 9 {
+		t.Errorf("want a success for each of the 9 tasks, got %d", success)
+	}
+	want := map[string]int{"g1": 3, "g2": 1}
+	if diff := cmp.Diff(want, maxRunning); diff != "" {
+		t.Errorf("max running jobs of each group mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_WithMaxConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	countWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+		res := testingWorkFn(ctx, worker, workerInst, task)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return res
+	}
+
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 3, Work: countWorkFn},
+		{WorkerID: "w2", Instances: 3, Work: countWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 20, true}, {"t2", 20, true}, {"t3", 20, true}},
+		"w2": {{"t4", 20, true}, {"t5", 20, true}, {"t6", 20, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithMaxConcurrent(2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.Execute(context.Background(), SuccessOrErrorResults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	success := 0
+	for res := range out {
+		if res.Error() == nil {
+			success++
+		}
+	}
+
+	if success != 6 {
+		t.Errorf("want a success for each of the 6 tasks, got %d", success)
+	}
+	if maxRunning != 2 {
+		t.Errorf("want max 2 Work calls in execution, got %d", maxRunning)
+	}
+}
+
+func TestEngine_WithMaxConcurrent_NotStarted(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 50, true}, {"t2", 300, true}},
+		"w2": {{"t1", 50, true}, {"t2", 300, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithMaxConcurrent(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 150*time.Millisecond)
+	defer cancel()
+	out, err := eng.ExecuteEvents(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the jobs waiting for the slot when the task succeeds elsewhere
+	// or the run expires are not started
+	notStarted := 0
+	for e := range out {
+		if res, ok := e.Result.(*NotStartedResult); ok {
+			notStarted++
+			if e.Type() != EventCanceled {
+				t.Errorf("%v: want a canceled not started result, got %v", e, res.Error())
+			}
+		}
+	}
+	if notStarted == 0 {
+		t.Errorf("want a not started result, got none")
+	}
+}
+
+func TestNewEngine_InvalidGroupLimit(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn, Group: "g1"},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+
+	tests := map[string]struct {
+		limits  map[string]int
+		wantErr bool
+		group   string
+	}{
+		"valid":       {limits: map[string]int{"g1": 1}},
+		"no limits":   {},
+		"undefined":   {limits: map[string]int{"g2": 1}, wantErr: true, group: "g2"},
+		"empty group": {limits: map[string]int{"": 1}, wantErr: true, group: ""},
+		"zero limit":  {limits: map[string]int{"g1": 0}, wantErr: true, group: "g1"},
+		"negative":    {limits: map[string]int{"g1": -1}, wantErr: true, group: "g1"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewEngine(workers, nil, WithGroupLimits(tt.limits))
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var cerr *ConfigError
+			if !errors.As(err, &cerr) || cerr.Kind != InvalidGroupLimit {
+				t.Fatalf("want InvalidGroupLimit error, got %v", err)
+			}
+			if cerr.Group != tt.group {
+				t.Errorf("want Group %q, got %q", tt.group, cerr.Group)
+			}
+		})
+	}
+}
+
+func TestEngine_WithRetries(t *testing.T) {
+	tests := map[string]struct {
+		retries int
+		want    []EventType
+		stat    TaskStat
+	}{
+		"success after retries": {
+			retries: 3,
+			want:    []EventType{EventError, EventError, EventSuccess},
+			stat:    TaskStat{Done: 3, Success: 1},
+		},
+		"too few retries": {
+			retries: 1,
+			want:    []EventType{EventError, EventError},
+			stat:    TaskStat{Done: 2},
+		},
+		"no retries": {
+			want: []EventType{EventError},
+			stat: TaskStat{Done: 1},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			// flakyWorkFn fails the first two attempts of each task
+			var mu sync.Mutex
+			attempts := map[TaskID]int{}
+			flakyWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+				mu.Lock()
+				attempts[task.TaskID()]++
+				n := attempts[task.TaskID()]
+				mu.Unlock()
+				res := &testingResult{Tid: string(task.TaskID()), Wid: string(worker.WorkerID)}
+				if n <= 2 {
+					res.Err = testingError
+				}
+				return res
+			}
+
+			workers := []*Worker{
+				{WorkerID: "w1", Instances: 2, Work: flakyWorkFn},
+			}
+			input := map[string]testingTasks{
+				"w1": {{"t1", 0, true}},
+			}
+			eng, err := NewEngine(workers, testingWorkerTasks(input), WithRetries(tt.retries))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []EventType
+			var last *Event
+			for e := range out {
+				if IsResult(e) {
+					got = append(got, e.Type())
+					last = e
+				}
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("results mismatch (-want +got):\n%s", diff)
+			}
+			if last.TaskStat != tt.stat {
+				t.Errorf("want final stat %v, got %v", tt.stat, last.TaskStat)
+			}
+		})
+	}
+}
+
+func TestNewEngine_IncompatibleOptions(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	aggr := func(tid TaskID, results []Result) Result { return nil }
+	less := func(a, b Result) bool { return a.String() < b.String() }
+
+	tests := map[string]struct {
+		opts    []Option
+		wantErr bool
+	}{
+		"aggregator quorum over max attempts": {
+			opts:    []Option{WithAggregator(3, aggr), WithMaxAttemptsPerTask(2)},
+			wantErr: true,
+		},
+		"aggregator quorum within max attempts": {
+			opts: []Option{WithAggregator(2, aggr), WithMaxAttemptsPerTask(2)},
+		},
+		"emit on completion with reorder window": {
+			opts:    []Option{WithEmitOnCompletion(true), WithReorderWindow(time.Second, less)},
+			wantErr: true,
+		},
+		"picker with affinity": {
+			opts:    []Option{WithPicker(DefaultPicker), WithAffinity(NewAffinity(nil))},
+			wantErr: true,
+		},
+		"scheduler with affinity": {
+			opts:    []Option{WithScheduler(reverseScheduler{pick: true}), WithAffinity(NewAffinity(nil))},
+			wantErr: true,
+		},
+		"default scheduler with affinity": {
+			opts: []Option{WithScheduler(DefaultScheduler{}), WithAffinity(NewAffinity(nil))},
+		},
+		"compatible": {
+			opts: []Option{WithEmitOnCompletion(true), WithPicker(DefaultPicker)},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewEngine(workers, nil, tt.opts...)
+			if !tt.wantErr {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			var cerr *ConfigError
+			if !errors.As(err, &cerr) || cerr.Kind != IncompatibleOptions {
+				t.Errorf("want IncompatibleOptions error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestEngine_WithOrderedReadiness(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 50, true}, {"t2", 50, true}, {"t3", 50, true}, {"t4", 50, true}},
+		"w2": {{"t1", 50, true}, {"t2", 50, true}, {"t3", 50, true}, {"t4", 50, true}},
+	}
+
+	// the instances of w2 are ready before the ones of w1
+	acquire := func(ctx context.Context, wid WorkerID) error {
+		if wid == "w1" {
+			time.Sleep(30 * time.Millisecond)
+		}
+		return nil
+	}
+	ready := false
+	onReady := func() { ready = true }
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input),
+		WithOrderedReadiness(true),
+		WithResource(acquire, nil),
+		WithOnReady(onReady))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type instance struct {
+		wid  WorkerID
+		inst int
+	}
+	first := map[instance]TaskID{}
+	for e := range out {
+		key := instance{e.WorkerID, e.WorkerInst}
+		if _, ok := first[key]; !ok && e.Type() == EventStart {
+			first[key] = e.Task.TaskID()
+		}
+	}
+
+	// the tasks are offered by WorkerID and instance
+	want := map[instance]TaskID{
+		{"w1", 0}: "t1",
+		{"w1", 1}: "t2",
+		{"w2", 0}: "t3",
+		{"w2", 1}: "t4",
+	}
+	if diff := cmp.Diff(want, first); diff != "" {
+		t.Errorf("first tasks mismatch (-want +got):\n%s", diff)
+	}
+	if !ready {
+		t.Errorf("OnReady not called")
+	}
+}
+
+func TestEngine_WithOrderedPick(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t3", 10, true}, {"t1", 10, true}, {"t4", 10, true}, {"t2", 10, true}},
+	}
+
+	testCases := map[string]struct {
+		ordered bool
+		want    []TaskID
+	}{
+		"by TaskID":          {false, []TaskID{"t1", "t2", "t3", "t4"}},
+		"by insertion order": {true, []TaskID{"t3", "t1", "t4", "t2"}},
+	}
+
+	for title, tc := range testCases {
+		t.Run(title, func(t *testing.T) {
+			eng, err := NewEngine(workers, testingWorkerTasks(input), WithOrderedPick(tc.ordered))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []TaskID
+			for e := range out {
+				if e.Type() == EventStart {
+					got = append(got, e.Task.TaskID())
+				}
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("pick order mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// candidatesLogger is a Logger recording the candidates of each pick.
+type candidatesLogger struct {
+	NopLogger
+	mu    sync.Mutex
+	picks [][]TaskID
+}
+
+func (l *candidatesLogger) OnPick(wid WorkerID, chosen TaskID, candidates Tasks) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var tids []TaskID
+	for _, t := range candidates {
+		tids = append(tids, t.TaskID())
+	}
+	l.picks = append(l.picks, tids)
+}
+
+func TestEngine_WithOrderedPick_Candidates(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t3", 10, true}, {"t1", 10, true}, {"t4", 10, true}, {"t2", 10, true}},
+	}
+
+	logger := &candidatesLogger{}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithOrderedPick(true), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range out {
+	}
+
+	// the task list keeps the order of insertion as the tasks are picked
+	want := [][]TaskID{
+		{"t3", "t1", "t4", "t2"},
+		{"t1", "t4", "t2"},
+		{"t4", "t2"},
+		{"t2"},
+	}
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	if diff := cmp.Diff(want, logger.picks); diff != "" {
+		t.Errorf("candidates mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_WithResultIdleTimeout(t *testing.T) {
+	// the job of w2 stalls until the run is canceled
+	canceled := make(chan struct{})
+	stallWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		<-ctx.Done()
+		close(canceled)
+		return &testingResult{Tid: string(task.TaskID()), Wid: string(worker.WorkerID), Err: ctx.Err()}
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: stallWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+		"w2": {{"t2", 0, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithResultIdleTimeout(100*time.Millisecond))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start := time.Now()
+	out, err := eng.Execute(context.Background(), AllResults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := []string{}
+	for res := range out {
+		got = append(got, res.(*testingResult).Tid)
+	}
+	elapsed := time.Since(start)
+
+	if diff := cmp.Diff([]string{"t1"}, got); diff != "" {
+		t.Errorf("results mismatch (-want +got):\n%s", diff)
+	}
+	if elapsed < 100*time.Millisecond || elapsed > 500*time.Millisecond {
+		t.Errorf("want the chan closed after the idle timeout, got %v", elapsed)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Errorf("the stalled job was not canceled")
+	}
+}
+
+func TestEngine_WithCompletionPredicate(t *testing.T) {
+	// slowWorkFn ignores the cancellation until the end of the job
+	slowWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		time.Sleep(300 * time.Millisecond)
+		return &testingResult{Tid: string(task.TaskID()), Wid: string(worker.WorkerID), Err: ctx.Err()}
+	}
+	// decided returns true if each task has a success
+	decided := func(stats map[TaskID]TaskStat) bool {
+		for _, stat := range stats {
+			if stat.Success == 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	tests := map[string]struct {
+		opts    []Option
+		results int
+		early   bool
+	}{
+		"default":   {results: 3, early: false},
+		"predicate": {opts: []Option{WithCompletionPredicate(decided)}, results: 2, early: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			workers := []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 1, Work: slowWorkFn},
+			}
+			input := map[string]testingTasks{
+				"w1": {{"t1", 10, true}, {"t2", 10, true}},
+				"w2": {{"t1", 0, true}},
+			}
+			eng, err := NewEngine(workers, testingWorkerTasks(input), tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			start := time.Now()
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			results := 0
+			for e := range out {
+				if IsResult(e) {
+					results++
+				}
+			}
+			elapsed := time.Since(start)
+
+			if results != tt.results {
+				t.Errorf("want %d results, got %d", tt.results, results)
+			}
+			if early := elapsed < 200*time.Millisecond; early != tt.early {
+				t.Errorf("want early end %v, got run of %v", tt.early, elapsed)
+			}
+		})
+	}
+}
+
+func TestEngine_WithResultBuffer(t *testing.T) {
+	for _, buffer := range []int{0, 100} {
+		var mu sync.Mutex
+		executed := 0
+		workFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+			res := testingWorkFn(ctx, worker, workerInst, task)
+			mu.Lock()
+			executed++
+			mu.Unlock()
+			return res
+		}
+		workers := []*Worker{
+			{WorkerID: "w1", Instances: 1, Work: workFn},
+		}
+		input := map[string]testingTasks{
+			"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, true}},
+		}
+		eng, err := NewEngine(workers, testingWorkerTasks(input), WithResultBuffer(buffer))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		out, err := eng.ExecuteEvents(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cap(out) != buffer {
+			t.Errorf("buffer=%d: want chan capacity %d, got %d", buffer, buffer, cap(out))
+		}
+
+		// without a consumer, the execution goes on only with a buffer
+		time.Sleep(100 * time.Millisecond)
+		mu.Lock()
+		got := executed
+		mu.Unlock()
+		events := 0
+		for range out {
+			events++
+		}
+
+		if want := map[bool]int{false: 0, true: 3}[buffer > 0]; got != want {
+			t.Errorf("buffer=%d: want %d tasks executed before consuming the events, got %d", buffer, want, got)
+		}
+		if events != 6 {
+			t.Errorf("buffer=%d: want 6 events, got %d", buffer, events)
+		}
+	}
+}
+
+func TestEngine_WithOnFirstSuccess(t *testing.T) {
+	var mu sync.Mutex
+	var log []string
+	add := func(s string) {
+		mu.Lock()
+		log = append(log, s)
+		mu.Unlock()
+	}
+	onFirstSuccess := func(tid TaskID, res Result) {
+		if res.Error() != nil {
+			t.Errorf("%s: want a success result, got %v", tid, res)
+		}
+		add("first " + string(tid))
+	}
+
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, false}},
+		"w2": {{"t1", 10, true}, {"t2", 20, true}, {"t3", 20, false}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithOnFirstSuccess(onFirstSuccess))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for e := range out {
+		if e.Type() == EventSuccess {
+			add("success " + string(e.Task.TaskID()))
+		}
+	}
+
+	// the function is called once for each task with a success, before its first success event
+	called := map[string]int{}
+	for _, s := range log {
+		if strings.HasPrefix(s, "first ") {
+			called[s]++
+			continue
+		}
+		first := "first " + strings.TrimPrefix(s, "success ")
+		if called[first] == 0 {
+			t.Errorf("%s before the call of the function: %v", s, log)
+		}
+	}
+	want := map[string]int{"first t1": 1, "first t2": 1}
+	if diff := cmp.Diff(want, called); diff != "" {
+		t.Errorf("calls mismatch (-want +got):\n%s", diff)
+	}
+}
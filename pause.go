@@ -0,0 +1,79 @@
+package taskengine
+
+import "sync"
+
+// pausedTasks contains the tasks paused by the PauseTask method.
+// It is shared by the executions of the engine.
+type pausedTasks struct {
+	mu      sync.Mutex
+	tasks   map[TaskID]bool
+	resumed chan struct{} // closed when a task is resumed
+}
+
+func newPausedTasks() *pausedTasks {
+	return &pausedTasks{
+		tasks:   map[TaskID]bool{},
+		resumed: make(chan struct{}),
+	}
+}
+
+// pause adds the task to the paused tasks.
+func (p *pausedTasks) pause(tid TaskID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.tasks[tid] = true
+}
+
+// resume removes the task from the paused tasks
+// and signals it on the resumed chan.
+func (p *pausedTasks) resume(tid TaskID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.tasks[tid] {
+		return
+	}
+	delete(p.tasks, tid)
+	close(p.resumed)
+	p.resumed = make(chan struct{})
+}
+
+// snapshot returns a copy of the paused tasks, or nil if none,
+// and a chan closed when a task is resumed.
+func (p *pausedTasks) snapshot() (map[TaskID]bool, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.tasks) == 0 {
+		return nil, p.resumed
+	}
+	tasks := make(map[TaskID]bool, len(p.tasks))
+	for tid := range p.tasks {
+		tasks[tid] = true
+	}
+	return tasks, p.resumed
+}
+
+// hasPaused returns true if some of the tasks is paused.
+func hasPaused(ts Tasks, paused map[TaskID]bool) bool {
+	for _, t := range ts {
+		if paused[t.TaskID()] {
+			return true
+		}
+	}
+	return false
+}
+
+// PauseTask pauses the task: no new attempt of the task is started
+// until it is resumed by the ResumeTask method, while the other tasks proceed.
+// The attempts of the task in execution continue until their result.
+// A run doesn't end while a paused task has attempts to do.
+// The task is paused for every execution of the engine, even the ones not yet started.
+func (eng *Engine) PauseTask(tid TaskID) {
+	eng.paused.pause(tid)
+}
+
+// ResumeTask resumes the task paused by the PauseTask method:
+// the ready worker instances are offered the task again.
+// Resuming a task not paused has no effect.
+func (eng *Engine) ResumeTask(tid TaskID) {
+	eng.paused.resume(tid)
+}
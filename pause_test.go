@@ -0,0 +1,101 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEngine_PauseTask(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	eng.PauseTask("t1")
+	eng.ResumeTask("t9") // no effect
+
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var starts []TaskID
+	for results := 0; results < 2; {
+		e := <-out
+		switch e.Type() {
+		case EventStart:
+			starts = append(starts, e.Task.TaskID())
+		case EventSuccess, EventError:
+			results++
+		}
+	}
+
+	// the paused task is never picked while the others proceed
+	select {
+	case e := <-out:
+		t.Fatalf("want no event while t1 is paused, got %v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	eng.ResumeTask("t1")
+	for e := range out {
+		if e.Type() == EventStart {
+			starts = append(starts, e.Task.TaskID())
+		}
+	}
+
+	want := []TaskID{"t2", "t3", "t1"}
+	if diff := cmp.Diff(want, starts); diff != "" {
+		t.Errorf("starts mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_PauseTask_OtherWorker(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+		"w2": {{"t2", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	eng.PauseTask("t1")
+
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the idle instance of w1 waits for t1 to be resumed
+	for e := range out {
+		if e.Task.TaskID() == "t1" {
+			t.Fatalf("want t1 not picked while paused, got %v", e)
+		}
+		if e.Type() == EventSuccess {
+			break
+		}
+	}
+	eng.ResumeTask("t1")
+
+	var got []TaskID
+	for e := range out {
+		if e.Type() == EventSuccess {
+			got = append(got, e.Task.TaskID())
+		}
+	}
+	if diff := cmp.Diff([]TaskID{"t1"}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
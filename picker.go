@@ -0,0 +1,85 @@
+package taskengine
+
+// Candidate is a task that a worker can execute next, with its current stat.
+type Candidate struct {
+	Task Task
+	Stat TaskStat
+}
+
+// Picker selects, among the candidate tasks of a worker, the ones to execute next.
+// It returns the selected candidates in order of preference:
+// the engine executes the first one, if any.
+// A Picker is a Scheduler (see the Pick method).
+type Picker func(wid WorkerID, candidates []Candidate) []Candidate
+
+// Pick calls the picker with the candidates and their stats,
+// and returns the index of the first selected candidate, or -1 if none.
+// If the selected task is not a candidate, it returns an index out of range.
+func (p Picker) Pick(wid WorkerID, stats map[TaskID]TaskStat, candidates Tasks) int {
+	cs := make([]Candidate, 0, len(candidates))
+	for _, t := range candidates {
+		cs = append(cs, Candidate{Task: t, Stat: stats[t.TaskID()]})
+	}
+	picked := p(wid, cs)
+	if len(picked) == 0 {
+		return -1
+	}
+	for j, t := range candidates {
+		if t.TaskID() == picked[0].Task.TaskID() {
+			return j
+		}
+	}
+	return len(candidates)
+}
+
+// WithPicker sets the function used to choose the next task of a ready worker instance,
+// instead of the default criteria (see DefaultPicker).
+// It is the same as WithScheduler with the picker (a nil picker means the default criteria).
+// If the picker selects no candidate, the worker instance is idle in this round,
+// as with a nil task returned by the NextTaskOverride function.
+// If the picker panics or selects a task that is not a candidate, the default criteria are used.
+// The affinity hint can't be used with a custom picker.
+func WithPicker(p Picker) Option {
+	return func(o *options) {
+		o.scheduler = nil
+		if p != nil {
+			o.scheduler = p
+		}
+	}
+}
+
+// ChainPickers returns a Picker that applies the pickers in order,
+// each one narrowing the candidates selected by the previous one.
+// It allows to compose the scheduling from reusable pieces,
+// i.e. a filter, followed by a scoring, followed by a tiebreak.
+// The chain stops as soon as no candidate remains.
+func ChainPickers(pickers ...Picker) Picker {
+	return func(wid WorkerID, candidates []Candidate) []Candidate {
+		for _, p := range pickers {
+			if len(candidates) == 0 {
+				break
+			}
+			candidates = p(wid, candidates)
+		}
+		return candidates
+	}
+}
+
+// DefaultPicker selects the best candidate based on the default criteria of the engine,
+// that maximize the throughput of the tasks successfully executed:
+// the task with fewer success, then fewer doing, then fewer todo, then lower TaskID.
+// It returns no candidate if the candidates list is empty.
+func DefaultPicker(wid WorkerID, candidates []Candidate) []Candidate {
+	statmap := taskStatMap{}
+	ts := make(Tasks, 0, len(candidates))
+	for j := range candidates {
+		c := &candidates[j]
+		statmap[c.Task.TaskID()] = &c.Stat
+		ts = append(ts, c.Task)
+	}
+	n := statmap.pick(ts)
+	if n < 0 {
+		return nil
+	}
+	return candidates[n : n+1]
+}
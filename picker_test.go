@@ -0,0 +1,155 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// candidatesTaskIDs returns the TaskIDs of the candidates.
+func candidatesTaskIDs(cs []Candidate) []TaskID {
+	tids := []TaskID{}
+	for _, c := range cs {
+		tids = append(tids, c.Task.TaskID())
+	}
+	return tids
+}
+
+// excludePicker returns a picker that filters out the given task.
+func excludePicker(tid TaskID) Picker {
+	return func(wid WorkerID, cs []Candidate) []Candidate {
+		out := []Candidate{}
+		for _, c := range cs {
+			if c.Task.TaskID() != tid {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+}
+
+// fewerDoingPicker keeps the candidates with the min number of doing.
+func fewerDoingPicker(wid WorkerID, cs []Candidate) []Candidate {
+	out := []Candidate{}
+	for _, c := range cs {
+		if len(out) > 0 && c.Stat.Doing > out[0].Stat.Doing {
+			continue
+		}
+		if len(out) > 0 && c.Stat.Doing < out[0].Stat.Doing {
+			out = out[:0]
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+// higherTaskIDPicker keeps the candidate with the higher TaskID.
+func higherTaskIDPicker(wid WorkerID, cs []Candidate) []Candidate {
+	best := cs[0]
+	for _, c := range cs[1:] {
+		if c.Task.TaskID() > best.Task.TaskID() {
+			best = c
+		}
+	}
+	return []Candidate{best}
+}
+
+func TestChainPickers(t *testing.T) {
+	cs := []Candidate{
+		{Task: statTask("t1"), Stat: TaskStat{Doing: 0}},
+		{Task: statTask("t2"), Stat: TaskStat{Doing: 0}},
+		{Task: statTask("t3"), Stat: TaskStat{Doing: 0}},
+		{Task: statTask("t4"), Stat: TaskStat{Doing: 1}},
+	}
+
+	tests := map[string]struct {
+		picker Picker
+		want   []TaskID
+	}{
+		"empty chain": {
+			picker: ChainPickers(),
+			want:   []TaskID{"t1", "t2", "t3", "t4"},
+		},
+		"filter": {
+			picker: ChainPickers(excludePicker("t3")),
+			want:   []TaskID{"t1", "t2", "t4"},
+		},
+		"filter and score": {
+			picker: ChainPickers(excludePicker("t3"), fewerDoingPicker),
+			want:   []TaskID{"t1", "t2"},
+		},
+		"filter, score and tiebreak": {
+			picker: ChainPickers(excludePicker("t3"), fewerDoingPicker, higherTaskIDPicker),
+			want:   []TaskID{"t2"},
+		},
+		"nothing left": {
+			picker: ChainPickers(excludePicker("t1"), excludePicker("t2"), excludePicker("t3"), excludePicker("t4"), higherTaskIDPicker),
+			want:   []TaskID{},
+		},
+		"default": {
+			picker: ChainPickers(excludePicker("t1"), DefaultPicker),
+			want:   []TaskID{"t2"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := candidatesTaskIDs(tt.picker("w1", cs))
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestDefaultPicker(t *testing.T) {
+	if got := DefaultPicker("w1", nil); len(got) != 0 {
+		t.Errorf("want no candidate, got %v", got)
+	}
+
+	cs := []Candidate{
+		{Task: statTask("t1"), Stat: TaskStat{Todo: 1, Success: 1}},
+		{Task: statTask("t2"), Stat: TaskStat{Todo: 1, Doing: 1}},
+		{Task: statTask("t3"), Stat: TaskStat{Todo: 2}},
+		{Task: statTask("t4"), Stat: TaskStat{Todo: 2}},
+	}
+	got := candidatesTaskIDs(DefaultPicker("w1", cs))
+	if diff := cmp.Diff([]TaskID{"t3"}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_WithPicker(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, true}},
+	}
+	picker := ChainPickers(excludePicker("t2"), fewerDoingPicker, higherTaskIDPicker)
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithPicker(picker))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	events := []Event{}
+	for e := range out {
+		events = append(events, *e)
+	}
+
+	// t2 is never picked and it is discarded at the end
+	want := []testingEventsGroup{
+		{{"w1", "t3", EventStart}},
+		{{"w1", "t3", EventSuccess}},
+		{{"w1", "t1", EventStart}},
+		{{"w1", "t1", EventSuccess}},
+	}
+	if diff := testingEventsDiff(want, events); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
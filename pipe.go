@@ -0,0 +1,87 @@
+package taskengine
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// Pipe executes a two-stage pipeline: each result of the first engine, filtered based on mode1,
+// is transformed into the tasks of the second engine, that are executed as soon as they are added.
+// It returns a chan that receives the results of the second engine filtered based on mode2.
+//
+// The second stage is a run of eng2 with parked idle instances (see WithParkIdleInstances and AddTasks),
+// executing only the tasks returned by the transform function:
+// a nil or empty WorkerTasks means no tasks for the result.
+// The returned chan is closed when both the stages are completed,
+// or as soon as the context is canceled: the results not yet received are discarded.
+//
+// The errors (i.e. invalid engines or modes, tasks of an undefined worker
+// or a panic of the transform function) are reported to the OnCallbackError function of eng2, if any:
+// an invalid stage-2 task set is skipped.
+func Pipe(ctx context.Context, eng1 *Engine, mode1 Mode, transform func(Result) WorkerTasks, eng2 *Engine, mode2 Mode) chan Result {
+	out := make(chan Result)
+	if eng2 == nil {
+		close(out)
+		return out
+	}
+	pipeError := func(err error) {
+		eng2.opts.callbackError(fmt.Errorf("Pipe: %w", err))
+	}
+
+	// start the second stage, waiting for the tasks
+	stage2, err := eng2.newRun(nil)
+	if err != nil {
+		pipeError(err)
+		close(out)
+		return out
+	}
+	stage2.opts.parkIdleInstances = true
+	atomic.AddInt32(&eng2.running, 1)
+	stage2.done = func() { atomic.AddInt32(&eng2.running, -1) }
+	results2, err := stage2.Execute(ctx, mode2)
+	if err != nil {
+		atomic.AddInt32(&eng2.running, -1)
+		pipeError(err)
+		close(out)
+		return out
+	}
+
+	// feed the second stage with the results of the first one
+	go func() {
+		defer stage2.endTasks()
+
+		results1, err := eng1.Execute(ctx, mode1)
+		if err != nil {
+			pipeError(err)
+			return
+		}
+		for res := range results1 {
+			var wts WorkerTasks
+			if !eng2.opts.safeCall("Transform", func() { wts = transform(res) }) || len(wts) == 0 {
+				continue
+			}
+			if err := stage2.AddTasks(wts); err != nil {
+				pipeError(err)
+			}
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for res := range results2 {
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				// the consumer may have stopped reading: the remaining results are discarded
+				go func() {
+					for range results2 {
+					}
+				}()
+				return
+			}
+		}
+	}()
+
+	return out
+}
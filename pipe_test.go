@@ -0,0 +1,162 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPipe(t *testing.T) {
+	workers1 := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+	}
+	workers2 := []*Worker{
+		{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}, {"t3", 20, true}},
+	}
+
+	// each success of the first stage becomes a task of the second stage
+	transform := func(res Result) WorkerTasks {
+		r := res.(*testingResult)
+		if r.Err != nil {
+			return nil
+		}
+		return testingWorkerTasks(map[string]testingTasks{
+			"w2": {{r.Tid + "-2", 10, true}},
+		})
+	}
+
+	eng1, err := NewEngine(workers1, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	eng2, err := NewEngine(workers2, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got := []string{}
+	for res := range Pipe(context.Background(), eng1, FirstSuccessOrLastResult, transform, eng2, FirstSuccessOrLastResult) {
+		r := res.(*testingResult)
+		if r.Wid != "w2" {
+			t.Errorf("want result of w2, got %v", r)
+		}
+		got = append(got, r.Tid)
+	}
+	sort.Strings(got)
+	if diff := cmp.Diff([]string{"t1-2", "t3-2"}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestPipe_Errors(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	onError := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}
+
+	// the result of t1 has tasks of an undefined worker, the one of t2 panics
+	transform := func(res Result) WorkerTasks {
+		if res.(*testingResult).Tid == "t2" {
+			panic("transform")
+		}
+		return testingWorkerTasks(map[string]testingTasks{"w9": {{"t9", 10, true}}})
+	}
+
+	eng1, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	eng2, err := NewEngine(workers, nil, WithOnCallbackError(onError))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for res := range Pipe(context.Background(), eng1, AllResults, transform, eng2, AllResults) {
+		t.Errorf("unexpected result %v", res)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(errs) != 2 {
+		t.Fatalf("want 2 errors, got %v", errs)
+	}
+	var cerr *ConfigError
+	found := false
+	for _, err := range errs {
+		if errors.As(err, &cerr) && cerr.Kind == UndefinedWorker {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("want an UndefinedWorker error, got %v", errs)
+	}
+}
+
+func TestPipe_CancelNotConsumed(t *testing.T) {
+	workers1 := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+	}
+	workers2 := []*Worker{
+		{WorkerID: "w2", Instances: 2, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+	transform := func(res Result) WorkerTasks {
+		return testingWorkerTasks(map[string]testingTasks{
+			"w2": {{res.(*testingResult).Tid + "-2", 10, true}},
+		})
+	}
+
+	eng1, err := NewEngine(workers1, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	eng2, err := NewEngine(workers2, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the results are never received
+	ctx, cancel := context.WithCancel(context.Background())
+	out := Pipe(ctx, eng1, FirstSuccessOrLastResult, transform, eng2, FirstSuccessOrLastResult)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+
+	// the pending results are discarded
+	select {
+	case res, ok := <-out:
+		if ok {
+			t.Errorf("want closed chan, got %v", res)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("chan not closed after cancel")
+	}
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&eng2.running) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&eng2.running); n != 0 {
+		t.Errorf("want the second stage ended after cancel, got %d runs", n)
+	}
+}
@@ -0,0 +1,56 @@
+package taskengine
+
+// preview returns the task that each idle worker would pick next,
+// considering the live state of every execution in progress.
+// The paused tasks and the ones with dependencies not satisfied are never picked
+// and the tasks preferred by the affinity, if any, are picked first,
+// as in the dispatch of the tasks.
+func (rt *runTracker) preview(paused map[TaskID]bool, aff *Affinity) map[WorkerID]TaskID {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	res := map[WorkerID]TaskID{}
+	for id, idle := range rt.idle {
+		statMap := taskStatMap{}
+		for tid, stat := range rt.stats[id] {
+			stat := stat
+			statMap[tid] = &stat
+		}
+		for wid, ts := range idle {
+			var cands Tasks
+			for _, t := range ts {
+				if !paused[t.TaskID()] && !statMap.blocked(t) {
+					cands = append(cands, t)
+				}
+			}
+			var prefer func(TaskID) bool
+			if aff != nil {
+				prefer = func(tid TaskID) bool {
+					w, ok := aff.Get(tid)
+					return ok && w == wid
+				}
+			}
+			if n := statMap.pickPrefer(cands, prefer); n >= 0 {
+				res[wid] = cands[n].TaskID()
+			}
+		}
+	}
+	return res
+}
+
+// Preview returns, for each worker with an idle instance, the task it would pick next
+// if it asked now, considering the live state of the executions in progress of the engine:
+// the workers without a task to pick are not included.
+// The state of each execution is a consistent snapshot taken between its scheduling decisions.
+// An instance is idle when no task can be assigned to it for the moment
+// (i.e. with the max active tasks or the limit of its group reached, or every task paused),
+// or it waits for the round of its worker to end (see Worker.InstanceWeights).
+// The preview is computed with the default pick; the custom Scheduler (or Picker)
+// and the next task override, if any, are not called.
+// It is safe to call it concurrently with the executions,
+// but not from the functions called by the engine during an execution (i.e. the Logger).
+func (eng *Engine) Preview() map[WorkerID]TaskID {
+	eng.tracker.refreshState()
+	paused, _ := eng.paused.snapshot()
+	return eng.tracker.preview(paused, eng.opts.affinity)
+}
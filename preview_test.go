@@ -0,0 +1,61 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEngine_Preview(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 200, true}},
+		"w2": {{"t2", 10, true}, {"t3", 10, true}},
+	}
+
+	// with a single active task, w2 is idle while w1 executes t1
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithMaxActiveTasks(1))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := eng.Preview(); len(got) != 0 {
+		t.Errorf("want empty preview before the run, got %v", got)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for e := range out {
+		if e.Type() == EventStart {
+			break
+		}
+	}
+
+	// the state is published by the run after each scheduling decision
+	want := map[WorkerID]TaskID{"w2": "t2"}
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for !cmp.Equal(want, eng.Preview()) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if diff := cmp.Diff(want, eng.Preview()); diff != "" {
+		t.Errorf("preview mismatch (-want +got):\n%s", diff)
+	}
+
+	// the paused tasks are not picked
+	eng.PauseTask("t2")
+	if diff := cmp.Diff(map[WorkerID]TaskID{"w2": "t3"}, eng.Preview()); diff != "" {
+		t.Errorf("preview with t2 paused mismatch (-want +got):\n%s", diff)
+	}
+	eng.ResumeTask("t2")
+
+	for range out {
+	}
+	if got := eng.Preview(); len(got) != 0 {
+		t.Errorf("want empty preview after the run, got %v", got)
+	}
+}
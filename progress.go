@@ -0,0 +1,49 @@
+package taskengine
+
+import "time"
+
+// ProgressSnapshot contains the progress of an execution of the engine at a given time.
+// It can be serialized to JSON, i.e. for a status endpoint.
+type ProgressSnapshot struct {
+	Time      time.Time           `json:"time"`      // time of the snapshot
+	Elapsed   time.Duration       `json:"elapsed"`   // time elapsed since the start of the execution
+	Tasks     map[TaskID]TaskStat `json:"tasks"`     // stat of each task
+	Completed int                 `json:"completed"` // number of tasks completed
+	Total     int                 `json:"total"`     // number of tasks
+	Progress  float64             `json:"progress"`  // completed tasks ratio, in the 0..1 range
+}
+
+// newProgressSnapshot returns the snapshot of the stat of the tasks at the given time.
+func newProgressSnapshot(statMap taskStatMap, start, now time.Time) ProgressSnapshot {
+	snap := ProgressSnapshot{
+		Time:    now,
+		Elapsed: now.Sub(start),
+		Tasks:   make(map[TaskID]TaskStat, len(statMap)),
+		Total:   len(statMap),
+		// an execution without tasks is completed
+		Progress: 1,
+	}
+	for tid, stat := range statMap {
+		snap.Tasks[tid] = *stat
+		if stat.Completed() {
+			snap.Completed++
+		}
+	}
+	if snap.Total > 0 {
+		snap.Progress = float64(snap.Completed) / float64(snap.Total)
+	}
+	return snap
+}
+
+// WithProgressSnapshots sets a function that receives a snapshot of the progress
+// of each execution every interval, and a final snapshot at the end of the execution.
+// It is a sampled, lower-frequency alternative to the events, i.e. for HTTP polling.
+// The function is called by the engine goroutine, so it must not block:
+// i.e. it can save the last snapshot or send it on a buffered chan without waiting.
+// If interval is not positive or fn is nil, no snapshot is taken (the default).
+func WithProgressSnapshots(interval time.Duration, fn func(ProgressSnapshot)) Option {
+	return func(o *options) {
+		o.progressInterval = interval
+		o.progress = fn
+	}
+}
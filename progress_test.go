@@ -0,0 +1,99 @@
+package taskengine
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewProgressSnapshot(t *testing.T) {
+	statMap := taskStatMap{
+		"t1": {Todo: 0, Doing: 0, Done: 2, Success: 1},
+		"t2": {Todo: 1, Doing: 1, Done: 0, Success: 0},
+		"t3": {Todo: 0, Doing: 0, Done: 1, Success: 0},
+		"t4": {Todo: 2, Doing: 0, Done: 0, Success: 0},
+	}
+	now := time.Now()
+	snap := newProgressSnapshot(statMap, now.Add(-time.Second), now)
+
+	if snap.Total != 4 || snap.Completed != 2 || snap.Progress != 0.5 {
+		t.Errorf("want 2 of 4 tasks completed, got %d of %d (%v)", snap.Completed, snap.Total, snap.Progress)
+	}
+	if snap.Elapsed != time.Second || !snap.Time.Equal(now) {
+		t.Errorf("want elapsed 1s at %v, got %v at %v", now, snap.Elapsed, snap.Time)
+	}
+	if got := snap.Tasks["t2"]; got != *statMap["t2"] {
+		t.Errorf("t2: want %v, got %v", *statMap["t2"], got)
+	}
+
+	// the snapshot is a copy of the stats
+	statMap["t2"].Doing = 0
+	if snap.Tasks["t2"].Doing != 1 {
+		t.Errorf("t2: the snapshot changed with the stats")
+	}
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, key := range []string{`"progress":0.5`, `"completed":2`, `"total":4`, `"t1":{`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("want %s in %s", key, data)
+		}
+	}
+
+	if empty := newProgressSnapshot(taskStatMap{}, now, now); empty.Progress != 1 {
+		t.Errorf("no tasks: want progress 1, got %v", empty.Progress)
+	}
+}
+
+func TestEngine_WithProgressSnapshots(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 100, true}, {"t2", 100, true}},
+	}
+	const interval = 30 * time.Millisecond
+
+	var mu sync.Mutex
+	var snaps []ProgressSnapshot
+	fn := func(snap ProgressSnapshot) {
+		mu.Lock()
+		defer mu.Unlock()
+		snaps = append(snaps, snap)
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithProgressSnapshots(interval, fn))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range out {
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// a run of about 200ms: a snapshot every 30ms and the final one
+	if n := len(snaps); n < 4 || n > 9 {
+		t.Fatalf("want about 7 snapshots, got %d", n)
+	}
+	for j := 1; j < len(snaps)-1; j++ {
+		if d := snaps[j].Time.Sub(snaps[j-1].Time); d < interval/2 {
+			t.Errorf("snapshot %d after %v", j, d)
+		}
+	}
+	if last := snaps[len(snaps)-1]; last.Progress != 1 || last.Completed != 2 {
+		t.Errorf("want final snapshot with every task completed, got %+v", last)
+	}
+	if first := snaps[0]; first.Progress == 1 {
+		t.Errorf("want first snapshot during the run, got %+v", first)
+	}
+}
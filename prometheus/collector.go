@@ -0,0 +1,72 @@
+// Package prometheus exports the metrics of the workers of a taskengine.Metrics
+// to Prometheus.
+//
+// It is a separate module, so that the taskengine module doesn't depend
+// on the Prometheus client. The exported metrics are:
+//
+//	taskengine_tasks_total{worker, status}           counter of the results
+//	taskengine_task_duration_seconds{worker, status} summary of the durations of the results
+//	taskengine_worker_busy{worker}                   gauge of the jobs in execution
+//
+// The status is the type of the result event (i.e. "success", "error" or "canceled").
+package prometheus
+
+import (
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mmbros/taskengine"
+)
+
+// Collector is a prometheus.Collector of the metrics of a taskengine.Metrics.
+// The metrics are read from a snapshot of the taskengine.Metrics at each collection.
+type Collector struct {
+	metrics  *taskengine.Metrics
+	tasks    *prom.Desc
+	duration *prom.Desc
+	busy     *prom.Desc
+}
+
+// NewCollector returns a new Collector of the metrics.
+func NewCollector(metrics *taskengine.Metrics) *Collector {
+	return &Collector{
+		metrics: metrics,
+		tasks: prom.NewDesc("taskengine_tasks_total",
+			"Number of the results of the jobs, by worker and status.",
+			[]string{"worker", "status"}, nil),
+		duration: prom.NewDesc("taskengine_task_duration_seconds",
+			"Duration of the jobs, by worker and status.",
+			[]string{"worker", "status"}, nil),
+		busy: prom.NewDesc("taskengine_worker_busy",
+			"Number of the jobs in execution, by worker.",
+			[]string{"worker"}, nil),
+	}
+}
+
+// Describe sends the descriptors of the metrics.
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	ch <- c.tasks
+	ch <- c.duration
+	ch <- c.busy
+}
+
+// Collect sends the metrics of the workers seen so far.
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	for _, wm := range c.metrics.Snapshot() {
+		wid := string(wm.WorkerID)
+		for etype, n := range wm.Results {
+			status := etype.String()
+			ch <- prom.MustNewConstMetric(c.tasks, prom.CounterValue, float64(n), wid, status)
+			ch <- prom.MustNewConstSummary(c.duration, uint64(n), wm.Duration[etype].Seconds(), nil, wid, status)
+		}
+		ch <- prom.MustNewConstMetric(c.busy, prom.GaugeValue, float64(wm.Busy), wid)
+	}
+}
+
+// Register registers a new Collector of the metrics to the registry.
+func Register(reg prom.Registerer, metrics *taskengine.Metrics) (*Collector, error) {
+	c := NewCollector(metrics)
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
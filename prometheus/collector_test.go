@@ -0,0 +1,109 @@
+package prometheus
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	prom "github.com/prometheus/client_golang/prometheus"
+
+	"github.com/mmbros/taskengine"
+)
+
+type testingTask string
+
+func (t testingTask) TaskID() taskengine.TaskID { return taskengine.TaskID(t) }
+
+type testingResult struct{ err error }
+
+func (r testingResult) Error() error { return r.err }
+
+func (r testingResult) String() string {
+	if r.err != nil {
+		return "ERROR"
+	}
+	return "SUCCESS"
+}
+
+// testingWorkFn fails the tasks with a TaskID starting with "e".
+func testingWorkFn(ctx context.Context, w *taskengine.Worker, inst int, task taskengine.Task) taskengine.Result {
+	time.Sleep(10 * time.Millisecond)
+	if task.TaskID()[0] == 'e' {
+		return testingResult{errors.New("testing error")}
+	}
+	return testingResult{}
+}
+
+func TestRegister(t *testing.T) {
+	workers := []*taskengine.Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	wts := taskengine.WorkerTasks{
+		"w1": {testingTask("t1"), testingTask("e1")},
+		"w2": {testingTask("t2")},
+	}
+	eng, err := taskengine.NewEngine(workers, wts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	metrics := taskengine.NewMetrics()
+	reg := prom.NewRegistry()
+	if _, err := Register(reg, metrics); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := Register(reg, metrics); err == nil {
+		t.Errorf("want error registering the collector twice")
+	}
+
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for e := range out {
+		metrics.Update(e)
+	}
+
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// value of each metric, by name and labels
+	got := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			key := mf.GetName()
+			for _, lp := range m.GetLabel() {
+				key += " " + lp.GetName() + "=" + lp.GetValue()
+			}
+			switch {
+			case m.GetCounter() != nil:
+				got[key] = m.GetCounter().GetValue()
+			case m.GetGauge() != nil:
+				got[key] = m.GetGauge().GetValue()
+			case m.GetSummary() != nil:
+				got[key] = float64(m.GetSummary().GetSampleCount())
+				if m.GetSummary().GetSampleSum() < 0.01*got[key] {
+					t.Errorf("%s: want at least 10ms each, got %vs", key, m.GetSummary().GetSampleSum())
+				}
+			}
+		}
+	}
+
+	want := map[string]float64{
+		"taskengine_tasks_total status=success worker=w1":           1,
+		"taskengine_tasks_total status=error worker=w1":             1,
+		"taskengine_tasks_total status=success worker=w2":           1,
+		"taskengine_task_duration_seconds status=success worker=w1": 1,
+		"taskengine_task_duration_seconds status=error worker=w1":   1,
+		"taskengine_task_duration_seconds status=success worker=w2": 1,
+		"taskengine_worker_busy worker=w1":                          0,
+		"taskengine_worker_busy worker=w2":                          0,
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("metrics mismatch (-want +got):\n%s", diff)
+	}
+}
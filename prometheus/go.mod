@@ -0,0 +1,24 @@
+module github.com/mmbros/taskengine/prometheus
+
+go 1.18
+
+require (
+	github.com/google/go-cmp v0.5.7
+	github.com/mmbros/taskengine v0.0.0
+	github.com/prometheus/client_golang v1.12.2
+)
+
+require (
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.2 // indirect
+	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_model v0.2.0 // indirect
+	github.com/prometheus/common v0.32.1 // indirect
+	github.com/prometheus/procfs v0.7.3 // indirect
+	golang.org/x/sys v0.0.0-20220114195835-da31bd327af9 // indirect
+	google.golang.org/protobuf v1.26.0 // indirect
+)
+
+// NOTE: the collector is developed together with the taskengine package.
+replace github.com/mmbros/taskengine => ../
@@ -0,0 +1,102 @@
+package taskengine
+
+import (
+	"sort"
+	"sync"
+)
+
+// Reliability contains the results of a worker observed by the engine,
+// across all its executions.
+// The canceled (or timed out, see EventCanceled) and cached results are not considered.
+type Reliability struct {
+	Successes int // number of success results
+	Failures  int // number of error results
+}
+
+// Rate returns the success rate of the worker, in the 0..1 range.
+// A worker without results is considered reliable (rate 1).
+func (r Reliability) Rate() float64 {
+	n := r.Successes + r.Failures
+	if n == 0 {
+		return 1
+	}
+	return float64(r.Successes) / float64(n)
+}
+
+// reliabilityMap tracks the reliability of each worker.
+// It is shared by the executions of the engine.
+type reliabilityMap struct {
+	mu      sync.Mutex
+	workers map[WorkerID]*Reliability
+}
+
+func newReliabilityMap() *reliabilityMap {
+	return &reliabilityMap{workers: map[WorkerID]*Reliability{}}
+}
+
+// add records a result of the worker.
+func (m *reliabilityMap) add(wid WorkerID, success bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r := m.workers[wid]
+	if r == nil {
+		r = &Reliability{}
+		m.workers[wid] = r
+	}
+	if success {
+		r.Successes++
+	} else {
+		r.Failures++
+	}
+}
+
+// snapshot returns a copy of the reliability of each worker.
+func (m *reliabilityMap) snapshot() map[WorkerID]Reliability {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	snap := make(map[WorkerID]Reliability, len(m.workers))
+	for wid, r := range m.workers {
+		snap[wid] = *r
+	}
+	return snap
+}
+
+// sortWorkers sorts the workers by decreasing success rate.
+// The workers with the same rate keep their order.
+func (m *reliabilityMap) sortWorkers(ws []*Worker) {
+	snap := m.snapshot()
+	sort.SliceStable(ws, func(i, j int) bool {
+		return snap[ws[i].WorkerID].Rate() > snap[ws[j].WorkerID].Rate()
+	})
+}
+
+// sortInstances sorts the ready worker instances by decreasing success rate of their workers.
+// The instances with the same rate keep their order.
+func (m *reliabilityMap) sortInstances(os []*jobOutput) {
+	snap := m.snapshot()
+	sort.SliceStable(os, func(i, j int) bool {
+		return snap[os[i].wid].Rate() > snap[os[j].wid].Rate()
+	})
+}
+
+// WithReliabilityOrdering sets whether the engine offers the tasks
+// to the ready worker instances in order of reliability of their workers,
+// i.e. by decreasing success rate observed in the previous results (see Engine.Reliability):
+// the historically reliable workers get the first pick of the tasks,
+// while the workers failing a lot are deprioritized over time.
+//
+// The order applies when more instances are ready at the same time,
+// i.e. in the initial readiness round (unless a resource must be acquired, see WithResource)
+// and when the idle instances are offered the tasks again.
+// The default is false, so that the tasks are offered in the order of the workers list.
+func WithReliabilityOrdering(enabled bool) Option {
+	return func(o *options) {
+		o.reliabilityOrdering = enabled
+	}
+}
+
+// Reliability returns the reliability of each worker with at least a result,
+// observed across all the executions of the engine.
+func (eng *Engine) Reliability() map[WorkerID]Reliability {
+	return eng.reliab.snapshot()
+}
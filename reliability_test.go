@@ -0,0 +1,87 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReliability_Rate(t *testing.T) {
+	tests := map[string]struct {
+		rel  Reliability
+		want float64
+	}{
+		"no results":   {Reliability{}, 1},
+		"all success":  {Reliability{Successes: 3}, 1},
+		"all failures": {Reliability{Failures: 3}, 0},
+		"mixed":        {Reliability{Successes: 1, Failures: 3}, 0.25},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.rel.Rate(); got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEngine_WithReliabilityOrdering(t *testing.T) {
+	// w1 is the first worker, but it always fails
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, false}, {"t2", 10, false}},
+		"w2": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+
+	// firstTasks executes the tasks and returns the first task started by each worker
+	firstTasks := func(eng *Engine) map[WorkerID]TaskID {
+		out, err := eng.ExecuteEvents(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		first := map[WorkerID]TaskID{}
+		for e := range out {
+			if _, ok := first[e.WorkerID]; !ok && e.Type() == EventStart {
+				first[e.WorkerID] = e.Task.TaskID()
+			}
+		}
+		return first
+	}
+
+	tests := map[string]struct {
+		enabled bool
+		want    TaskID // first task of w2 in the second run
+	}{
+		"disabled": {enabled: false, want: "t2"},
+		"enabled":  {enabled: true, want: "t1"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			eng, err := NewEngine(workers, testingWorkerTasks(input), WithReliabilityOrdering(tt.enabled))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// in the first run, the workers are offered the tasks in list order
+			if got := firstTasks(eng); got["w1"] != "t1" || got["w2"] != "t2" {
+				t.Fatalf("first run: want w1 on t1 and w2 on t2, got %v", got)
+			}
+
+			rel := eng.Reliability()
+			if r := rel["w1"]; r.Successes != 0 || r.Failures == 0 {
+				t.Errorf("w1: want only failures, got %+v", r)
+			}
+			if r := rel["w2"]; r.Successes == 0 || r.Failures != 0 {
+				t.Errorf("w2: want only successes, got %+v", r)
+			}
+
+			// in the second run, the reliable worker gets the first pick, if enabled
+			if got := firstTasks(eng); got["w2"] != tt.want {
+				t.Errorf("second run: want w2 on %s, got %v", tt.want, got)
+			}
+		})
+	}
+}
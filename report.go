@@ -0,0 +1,136 @@
+package taskengine
+
+import (
+	"math"
+	"time"
+)
+
+// TaskReport contains the summary of the execution of a task.
+type TaskReport struct {
+	TaskStat TaskStat   // stat of the last result event of the task
+	LastErr  error      // error of the last not successfull result, if any
+	Workers  []WorkerID // distinct workers with a result for the task, in order of result
+}
+
+// WorkerReport contains the summary of the jobs executed by a worker.
+type WorkerReport struct {
+	Jobs int           // number of jobs executed (results)
+	Busy time.Duration // total execution time of the jobs, across all instances
+}
+
+// RunReport contains the summary of an execution of the engine.
+// It is built by adding each event emitted by the ExecuteEvents method.
+type RunReport struct {
+	Tasks   map[TaskID]*TaskReport
+	Workers map[WorkerID]*WorkerReport
+
+	TimeStart time.Time // time of the first event
+	TimeEnd   time.Time // time of the last event
+}
+
+// NewRunReport returns a new empty RunReport.
+func NewRunReport() *RunReport {
+	return &RunReport{
+		Tasks:   map[TaskID]*TaskReport{},
+		Workers: map[WorkerID]*WorkerReport{},
+	}
+}
+
+// Add updates the report with the information of the event.
+// The time of every event is considered for the duration of the run,
+// while only the result events are considered for the tasks and workers summary.
+func (rep *RunReport) Add(e *Event) {
+	if e == nil {
+		return
+	}
+	if rep.TimeStart.IsZero() || e.TimeStart.Before(rep.TimeStart) {
+		rep.TimeStart = e.TimeStart
+	}
+	if e.TimeEnd.After(rep.TimeEnd) {
+		rep.TimeEnd = e.TimeEnd
+	}
+	if !IsResult(e) {
+		return
+	}
+
+	wr := rep.Workers[e.WorkerID]
+	if wr == nil {
+		wr = &WorkerReport{}
+		rep.Workers[e.WorkerID] = wr
+	}
+	wr.Jobs++
+	wr.Busy += e.TimeEnd.Sub(e.TimeStart)
+
+	tid := e.Task.TaskID()
+	tr := rep.Tasks[tid]
+	if tr == nil {
+		tr = &TaskReport{}
+		rep.Tasks[tid] = tr
+	}
+	tr.TaskStat = e.TaskStat
+	if !containsWorker(tr.Workers, e.WorkerID) {
+		tr.Workers = append(tr.Workers, e.WorkerID)
+	}
+	if err := e.Result.Error(); err != nil {
+		tr.LastErr = err
+	}
+}
+
+// Failed returns the list of the tasks without a success result.
+func (rep *RunReport) Failed() []TaskID {
+	tids := []TaskID{}
+	for tid, tr := range rep.Tasks {
+		if tr.TaskStat.Success == 0 {
+			tids = append(tids, tid)
+		}
+	}
+	return tids
+}
+
+// WorkersAttempted returns the distinct workers that produced a result
+// (success, error or canceled) for the task, in order of result.
+// Unlike the workers doing the task during the execution,
+// they include the workers whose job is already terminated.
+// It returns nil if the task has no result.
+func (rep *RunReport) WorkersAttempted(tid TaskID) []WorkerID {
+	tr := rep.Tasks[tid]
+	if tr == nil {
+		return nil
+	}
+	return append([]WorkerID(nil), tr.Workers...)
+}
+
+// SuggestInstances returns the number of instances of each worker of the report
+// needed to reach the target utilization (in the 0..1 range) in a run similar to the reported one.
+//
+// The model is simple: a worker that was busy for B time in a run of duration T
+// needs B / (T * targetUtilization) instances, rounded up and at least 1,
+// to keep each instance busy for the targetUtilization fraction of the run.
+// It returns nil if the target is out of range or the duration of the run is unknown.
+func SuggestInstances(report *RunReport, targetUtilization float64) map[WorkerID]int {
+	if report == nil || targetUtilization <= 0 || targetUtilization > 1 {
+		return nil
+	}
+	runtime := report.TimeEnd.Sub(report.TimeStart)
+	if runtime <= 0 {
+		return nil
+	}
+	suggested := map[WorkerID]int{}
+	for wid, wr := range report.Workers {
+		n := int(math.Ceil(float64(wr.Busy) / (float64(runtime) * targetUtilization)))
+		if n < 1 {
+			n = 1
+		}
+		suggested[wid] = n
+	}
+	return suggested
+}
+
+func containsWorker(wids []WorkerID, wid WorkerID) bool {
+	for _, w := range wids {
+		if w == wid {
+			return true
+		}
+	}
+	return false
+}
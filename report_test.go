@@ -0,0 +1,168 @@
+package taskengine
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunReport(t *testing.T) {
+	task := func(tid string) Task { return &testingTask{tid, 0, true} }
+
+	events := []*Event{
+		{Task: task("t1")},
+		{Task: task("t1"), Result: testingResult{Err: testingError}, TaskStat: TaskStat{1, 0, 1, 0}},
+		{Task: task("t1"), Result: testingResult{}, TaskStat: TaskStat{0, 0, 2, 1}},
+		{Task: task("t2"), Result: testingResult{Err: testingError}, TaskStat: TaskStat{0, 0, 1, 0}},
+		{Task: task("t3")},
+		nil,
+	}
+
+	rep := NewRunReport()
+	for _, e := range events {
+		rep.Add(e)
+	}
+
+	if len(rep.Tasks) != 2 {
+		t.Errorf("want 2 tasks, got %d", len(rep.Tasks))
+	}
+	if got := rep.Tasks["t1"].TaskStat; got != (TaskStat{0, 0, 2, 1}) {
+		t.Errorf("t1: unexpected stat %v", got)
+	}
+	if got := rep.Tasks["t1"].LastErr; got != testingError {
+		t.Errorf("t1: want error %v, got %v", testingError, got)
+	}
+
+	got := rep.Failed()
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if diff := cmp.Diff([]TaskID{"t2"}, got); diff != "" {
+		t.Errorf("Failed() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestRunReport_WorkersAttempted(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w3", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, false}},
+		"w2": {{"t1", 50, true}},
+		"w3": {{"t1", 300, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	rep := NewRunReport()
+	for e := range out {
+		rep.Add(e)
+	}
+
+	// w1 fails, w2 succeeds and w3 is canceled
+	want := []WorkerID{"w1", "w2", "w3"}
+	if diff := cmp.Diff(want, rep.WorkersAttempted("t1")); diff != "" {
+		t.Errorf("t1: WorkersAttempted mismatch (-want +got):\n%s", diff)
+	}
+	if got := rep.WorkersAttempted("t9"); got != nil {
+		t.Errorf("t9: want nil, got %v", got)
+	}
+}
+
+func TestRunReport_Workers(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return t0.Add(time.Duration(sec) * time.Second) }
+	task := &testingTask{"t1", 0, true}
+
+	events := []*Event{
+		{WorkerID: "w1", Task: task, TimeStart: at(0), TimeEnd: at(0)},
+		{WorkerID: "w2", Task: task, TimeStart: at(1), TimeEnd: at(1)},
+		{WorkerID: "w2", Task: task, Result: testingResult{Err: testingError}, TimeStart: at(1), TimeEnd: at(3)},
+		{WorkerID: "w1", Task: task, Result: testingResult{}, TimeStart: at(0), TimeEnd: at(4)},
+	}
+	rep := NewRunReport()
+	for _, e := range events {
+		rep.Add(e)
+	}
+
+	want := map[WorkerID]*WorkerReport{
+		"w1": {Jobs: 1, Busy: 4 * time.Second},
+		"w2": {Jobs: 1, Busy: 2 * time.Second},
+	}
+	if diff := cmp.Diff(want, rep.Workers); diff != "" {
+		t.Errorf("Workers mismatch (-want +got):\n%s", diff)
+	}
+	if !rep.TimeStart.Equal(at(0)) || !rep.TimeEnd.Equal(at(4)) {
+		t.Errorf("want run from %v to %v, got from %v to %v", at(0), at(4), rep.TimeStart, rep.TimeEnd)
+	}
+}
+
+func TestSuggestInstances(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// run of 10 seconds
+	report := &RunReport{
+		Workers: map[WorkerID]*WorkerReport{
+			"w1": {Jobs: 10, Busy: 30 * time.Second},
+			"w2": {Jobs: 5, Busy: 5 * time.Second},
+			"w3": {Jobs: 1, Busy: 0},
+		},
+		TimeStart: t0,
+		TimeEnd:   t0.Add(10 * time.Second),
+	}
+
+	tests := map[string]struct {
+		report *RunReport
+		target float64
+		want   map[WorkerID]int
+	}{
+		"full utilization": {
+			report: report,
+			target: 1,
+			want:   map[WorkerID]int{"w1": 3, "w2": 1, "w3": 1},
+		},
+		"half utilization": {
+			report: report,
+			target: 0.5,
+			want:   map[WorkerID]int{"w1": 6, "w2": 1, "w3": 1},
+		},
+		"quarter utilization": {
+			report: report,
+			target: 0.25,
+			want:   map[WorkerID]int{"w1": 12, "w2": 2, "w3": 1},
+		},
+		"invalid target": {
+			report: report,
+			target: 0,
+		},
+		"target over 1": {
+			report: report,
+			target: 1.5,
+		},
+		"empty report": {
+			report: NewRunReport(),
+			target: 0.5,
+		},
+		"nil report": {
+			target: 0.5,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := SuggestInstances(tt.report, tt.target)
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package taskengine
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// RunStats contains the aggregate stats of an execution of the engine.
+type RunStats struct {
+	Results   int // number of results
+	Successes int // number of success results
+	Errors    int // number of error results
+	Canceled  int // number of canceled results
+
+	TasksCompleted int // number of tasks completed, i.e. no worker has to do or is doing the task
+	TasksSucceeded int // number of tasks with at least a success result
+
+	// ConsumerBackpressure is the total time spent waiting for the consumer
+	// to receive the previous output: a high value means the consumer is the bottleneck.
+	// It is set by the ExecuteWithRunningStats method and in the stats of every execution
+	// reported at the end (see WithRunStats).
+	ConsumerBackpressure time.Duration
+}
+
+// add updates the stats with the result event.
+func (rs *RunStats) add(e *Event) {
+	if !IsResult(e) {
+		return
+	}
+	rs.Results++
+	switch e.Type() {
+	case EventSuccess:
+		rs.Successes++
+		if e.TaskStat.Success == 1 {
+			rs.TasksSucceeded++
+		}
+	case EventCanceled:
+		rs.Canceled++
+	default:
+		rs.Errors++
+	}
+	if e.TaskStat.Completed() {
+		rs.TasksCompleted++
+	}
+}
+
+// WithRunStats sets a function that is called at the end of each execution
+// with the final stats of the execution, for all the Execute methods
+// (i.e. Execute, ExecuteEvents and ExecuteWithRunningStats).
+// The ConsumerBackpressure stat is the time spent blocked sending the output of the method,
+// i.e. the results or the events.
+// The function is called after the output chan is closed.
+func WithRunStats(fn func(RunStats)) Option {
+	return func(o *options) {
+		o.runStats = fn
+	}
+}
+
+// statsReport collects the stats of an execution, reported at its end (see WithRunStats).
+// NOTE: the events are sent by more goroutines, so the backpressure is updated atomically.
+type statsReport struct {
+	backpressure int64    // nanoseconds blocked sending the output to the consumer
+	stats        RunStats // stats of the run, set before the event chan is closed
+}
+
+// add records the time blocked sending an output since start.
+func (r *statsReport) add(start time.Time) {
+	atomic.AddInt64(&r.backpressure, int64(time.Since(start)))
+}
+
+// consumerBackpressure returns the total time blocked sending the output.
+func (r *statsReport) consumerBackpressure() time.Duration {
+	return time.Duration(atomic.LoadInt64(&r.backpressure))
+}
+
+// report calls the RunStats function, if any, with the stats of the execution.
+// It must be called once the event chan is closed.
+func (r *statsReport) report(opts *options) {
+	fn := opts.runStats
+	if fn == nil {
+		return
+	}
+	stats := r.stats
+	stats.ConsumerBackpressure = r.consumerBackpressure()
+	opts.safeCall("RunStats", func() { fn(stats) })
+}
+
+// RunSummary contains the aggregate counts of a run, sent by the Summary event
+// at the end of the run (see WithSummaryEvent).
+type RunSummary struct {
+	Tasks     int           // number of tasks
+	Succeeded int           // number of tasks with at least a success result
+	Successes int           // number of success results
+	Errors    int           // number of error results
+	Canceled  int           // number of canceled results
+	Elapsed   time.Duration // wall-clock time of the run
+}
+
+// String returns a representation of the summary.
+func (s *RunSummary) String() string {
+	if s == nil {
+		return "<nil>"
+	}
+	return fmt.Sprintf("tasks=%d succeeded=%d successes=%d errors=%d canceled=%d elapsed=%v",
+		s.Tasks, s.Succeeded, s.Successes, s.Errors, s.Canceled, s.Elapsed)
+}
+
+// newRunSummary returns the summary of the run from its stats.
+func newRunSummary(tasks int, stats RunStats, elapsed time.Duration) *RunSummary {
+	return &RunSummary{
+		Tasks:     tasks,
+		Succeeded: stats.TasksSucceeded,
+		Successes: stats.Successes,
+		Errors:    stats.Errors,
+		Canceled:  stats.Canceled,
+		Elapsed:   elapsed,
+	}
+}
+
+// StatResult is a result with the stats of the execution at the time it was emitted.
+type StatResult struct {
+	Result Result
+	Stats  RunStats
+}
+
+// ExecuteWithRunningStats returns a chan that receives the results generated by tasks execution,
+// filtered based on the Mode parameter as the Execute method,
+// each with a snapshot of the stats of the execution at the time the result is emitted.
+// The stats consider all the results, even the ones not emitted.
+// The ConsumerBackpressure stat is the time spent blocked sending the previous results on the chan.
+// The options of the engine related to the Execute output (i.e. WithEmitOnCompletion) are ignored.
+func (eng *Engine) ExecuteWithRunningStats(ctx context.Context, mode Mode) (chan StatResult, error) {
+	if err := checkMode(mode); err != nil {
+		return nil, err
+	}
+	report := &statsReport{}
+	eventc, _, err := eng.executeEvents(ctx, report)
+	if err != nil {
+		return nil, err
+	}
+	export := eng.filterEventFunc(mode)
+
+	resultc := make(chan StatResult, eng.opts.resultBufferSize())
+	go func() {
+		stats := RunStats{}
+		for e := range eventc {
+			stats.add(e)
+			if export(e) {
+				start := time.Now()
+				resultc <- StatResult{Result: e.Result, Stats: stats}
+				report.add(start)
+				stats.ConsumerBackpressure = report.consumerBackpressure()
+			}
+		}
+		close(resultc)
+		report.report(&eng.opts)
+	}()
+
+	return resultc, nil
+}
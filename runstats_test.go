@@ -0,0 +1,257 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRunStats_add(t *testing.T) {
+	task := &testingTask{"t1", 0, true}
+	events := []*Event{
+		{Task: task, TaskStat: TaskStat{2, 1, 0, 0}},
+		{Task: task, Result: testingResult{Err: testingError}, TaskStat: TaskStat{2, 0, 1, 0}},
+		{Task: task, Result: testingResult{}, TaskStat: TaskStat{0, 1, 2, 1}},
+		{Task: task, Result: testingResult{Err: context.Canceled}, TaskStat: TaskStat{0, 0, 3, 1}},
+		{Task: task, kind: EventTaskComplete, TaskStat: TaskStat{0, 0, 3, 1}},
+		nil,
+	}
+	want := RunStats{
+		Results:        3,
+		Successes:      1,
+		Errors:         1,
+		Canceled:       1,
+		TasksCompleted: 1,
+		TasksSucceeded: 1,
+	}
+
+	got := RunStats{}
+	for _, e := range events {
+		got.add(e)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_ExecuteWithRunningStats(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}, {"t3", 10, true}},
+		"w2": {{"t1", 50, true}, {"t4", 10, false}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteWithRunningStats(context.Background(), FirstSuccessOrLastResult)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var prev RunStats
+	n := 0
+	for sr := range out {
+		n++
+		s := sr.Stats
+		if s.Results < prev.Results || s.Successes < prev.Successes || s.Errors < prev.Errors ||
+			s.Canceled < prev.Canceled || s.TasksCompleted < prev.TasksCompleted || s.TasksSucceeded < prev.TasksSucceeded {
+			t.Errorf("stats not monotonic: %+v after %+v", s, prev)
+		}
+		if s.Results < n {
+			t.Errorf("want at least %d results in stats, got %d", n, s.Results)
+		}
+		prev = s
+	}
+
+	if n != 4 {
+		t.Errorf("want 4 results, got %d", n)
+	}
+	if prev.TasksCompleted > 4 || prev.TasksSucceeded != 2 {
+		t.Errorf("unexpected final stats: %+v", prev)
+	}
+}
+
+func TestEngine_ExecuteWithRunningStats_Backpressure(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 3, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, true}},
+	}
+
+	tests := map[string]struct {
+		delay time.Duration // time spent by the consumer for each result
+		slow  bool
+	}{
+		"fast consumer": {delay: 0, slow: false},
+		"slow consumer": {delay: 50 * time.Millisecond, slow: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			eng, err := NewEngine(workers, testingWorkerTasks(input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteWithRunningStats(context.Background(), FirstSuccessOrLastResult)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var last RunStats
+			for sr := range out {
+				time.Sleep(tt.delay)
+				last = sr.Stats
+			}
+			// the results are ready at the same time:
+			// the last one waited for the consumer of the previous ones
+			bp := last.ConsumerBackpressure
+			if tt.slow && bp < tt.delay {
+				t.Errorf("want backpressure >= %v, got %v", tt.delay, bp)
+			}
+			if !tt.slow && bp > 20*time.Millisecond {
+				t.Errorf("want low backpressure, got %v", bp)
+			}
+		})
+	}
+}
+
+func TestEngine_WithSummaryEvent(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t1", 60, true}, {"t3", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithSummaryEvent(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var last *Event
+	summaries := 0
+	for e := range out {
+		if e.Type() == EventSummary {
+			summaries++
+		}
+		last = e
+	}
+
+	if summaries != 1 || last.Type() != EventSummary {
+		t.Fatalf("want a Summary event as the last event, got %d summaries and last %v", summaries, last)
+	}
+	got := *last.Summary
+	if got.Elapsed <= 0 || got.Elapsed != last.TimeEnd.Sub(last.TimeStart) {
+		t.Errorf("unexpected elapsed %v", got.Elapsed)
+	}
+	got.Elapsed = 0
+	want := RunSummary{Tasks: 3, Succeeded: 2, Successes: 2, Errors: 1, Canceled: 1}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if want := "summary " + last.Summary.String(); last.String() != want {
+		t.Errorf("want %q, got %q", want, last.String())
+	}
+
+	// the Execute method ignores the Summary event
+	eng, err = NewEngine(workers, testingWorkerTasks(input), WithSummaryEvent(true), WithEmitOnCompletion(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results, err := eng.ExecuteAll(context.Background(), SuccessOrErrorResults)
+	if err != nil || len(results) != 3 {
+		t.Errorf("want 3 results, got %v (err %v)", results, err)
+	}
+}
+
+func TestEngine_WithRunStats(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 3, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, false}},
+	}
+	const delay = 50 * time.Millisecond // time spent by the slow consumer for each output
+
+	tests := map[string]struct {
+		method string // Execute method consumed
+		slow   bool
+	}{
+		"fast results":       {method: "Execute"},
+		"slow results":       {method: "Execute", slow: true},
+		"fast events":        {method: "ExecuteEvents"},
+		"slow events":        {method: "ExecuteEvents", slow: true},
+		"fast running stats": {method: "ExecuteWithRunningStats"},
+		"slow running stats": {method: "ExecuteWithRunningStats", slow: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			statsc := make(chan RunStats, 1)
+			eng, err := NewEngine(workers, testingWorkerTasks(input),
+				WithRunStats(func(rs RunStats) { statsc <- rs }))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			consume := func() {
+				if tt.slow {
+					time.Sleep(delay)
+				}
+			}
+			switch tt.method {
+			case "Execute":
+				out, err := eng.Execute(context.Background(), FirstSuccessOrLastResult)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				for range out {
+					consume()
+				}
+			case "ExecuteEvents":
+				out, err := eng.ExecuteEvents(context.Background())
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				for range out {
+					consume()
+				}
+			default:
+				out, err := eng.ExecuteWithRunningStats(context.Background(), FirstSuccessOrLastResult)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				for range out {
+					consume()
+				}
+			}
+
+			var rs RunStats
+			select {
+			case rs = <-statsc:
+			case <-time.After(time.Second):
+				t.Fatalf("run stats not reported")
+			}
+			if rs.Results != 3 || rs.Successes != 2 || rs.Errors != 1 || rs.TasksCompleted != 3 {
+				t.Errorf("want 3 results, 2 successes and 1 error of 3 completed tasks, got %+v", rs)
+			}
+			bp := rs.ConsumerBackpressure
+			if tt.slow && bp < delay {
+				t.Errorf("want backpressure >= %v, got %v", delay, bp)
+			}
+			if !tt.slow && bp > 20*time.Millisecond {
+				t.Errorf("want low backpressure, got %v", bp)
+			}
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package taskengine
+
+import "time"
+
+// SchedulingStats contains the scheduling overhead of an execution of the engine,
+// i.e. the time spent by the engine between receiving the readiness of a worker instance
+// and sending it the next task (picking the task and sending the job),
+// as distinct from the time spent by the workers.
+type SchedulingStats struct {
+	Dispatches int           // number of jobs sent to the workers
+	Total      time.Duration // total decision latency
+	Max        time.Duration // max decision latency of a job
+}
+
+// Average returns the average decision latency of a job, or 0 if no job was sent.
+func (s SchedulingStats) Average() time.Duration {
+	if s.Dispatches == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Dispatches)
+}
+
+// add records the decision latency of a job.
+func (s *SchedulingStats) add(d time.Duration) {
+	s.Dispatches++
+	s.Total += d
+	if d > s.Max {
+		s.Max = d
+	}
+}
+
+// WithSchedulingStats sets a function that is called at the end of each execution
+// with the scheduling stats of the execution (see SchedulingStats).
+// The function is called before the event chan is closed.
+func WithSchedulingStats(fn func(SchedulingStats)) Option {
+	return func(o *options) {
+		o.schedulingStats = fn
+	}
+}
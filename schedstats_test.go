@@ -0,0 +1,61 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSchedulingStats_Average(t *testing.T) {
+	var s SchedulingStats
+	if got := s.Average(); got != 0 {
+		t.Errorf("want 0 without dispatches, got %v", got)
+	}
+	s.add(10 * time.Millisecond)
+	s.add(30 * time.Millisecond)
+	if s.Dispatches != 2 || s.Total != 40*time.Millisecond || s.Max != 30*time.Millisecond {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if got := s.Average(); got != 20*time.Millisecond {
+		t.Errorf("want average 20ms, got %v", got)
+	}
+}
+
+func TestEngine_WithSchedulingStats(t *testing.T) {
+	workers, wts := testingBenchmarkInput(2, 20, testingInstantWorkFn)
+
+	var stats SchedulingStats
+	calls := 0
+	fn := func(s SchedulingStats) {
+		stats = s
+		calls++
+	}
+
+	eng, err := NewEngine(workers, wts, WithSchedulingStats(fn))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	starts := 0
+	for e := range out {
+		if e.Type() == EventStart {
+			starts++
+		}
+	}
+
+	if calls != 1 {
+		t.Fatalf("want 1 call, got %d", calls)
+	}
+	if stats.Dispatches != starts {
+		t.Errorf("want %d dispatches, got %d", starts, stats.Dispatches)
+	}
+	if stats.Total <= 0 || stats.Max <= 0 {
+		t.Errorf("want positive latency, got %+v", stats)
+	}
+	if avg := stats.Average(); avg <= 0 || avg > stats.Max {
+		t.Errorf("want average in (0, %v], got %v", stats.Max, avg)
+	}
+}
@@ -0,0 +1,67 @@
+package taskengine
+
+// Scheduler chooses the next task to execute among the candidate tasks of a ready worker instance.
+// It is the extension point of the choice of the engine: the default criteria (see DefaultScheduler)
+// and the Picker functions are Schedulers too.
+type Scheduler interface {
+	// Pick returns the index in the candidates list of the task the worker executes next,
+	// or -1 to execute none of them (the worker instance is idle in this round).
+	// The stats contain the stat of each candidate task.
+	Pick(wid WorkerID, stats map[TaskID]TaskStat, candidates Tasks) int
+}
+
+// DefaultScheduler is the Scheduler with the default criteria of the engine,
+// that maximize the throughput of the tasks successfully executed:
+// the task with fewer success, then fewer doing, then fewer todo, then lower TaskID.
+// Set by WithScheduler, it is the same as the default of the engine,
+// that also prefers the tasks assigned to the worker by the affinity hint (see WithAffinity)
+// and breaks the ties by the order of insertion with the ordered pick (see WithOrderedPick).
+type DefaultScheduler struct{}
+
+// Pick returns the index of the best candidate based on the default criteria,
+// or -1 if the candidates list is empty.
+func (DefaultScheduler) Pick(wid WorkerID, stats map[TaskID]TaskStat, candidates Tasks) int {
+	statmap := make(taskStatMap, len(candidates))
+	for _, t := range candidates {
+		stat := stats[t.TaskID()]
+		statmap[t.TaskID()] = &stat
+	}
+	return statmap.pick(candidates)
+}
+
+// defaultScheduler is the Scheduler of the default criteria used by a run,
+// considering the affinity hint and the position of the tasks (see WithOrderedPick).
+// NOTE: it reads the stats of the run, so the stats argument of Pick is ignored.
+type defaultScheduler struct {
+	statmap  taskStatMap
+	affinity *Affinity
+	position map[WorkerID]map[TaskID]int // nil without the ordered pick
+}
+
+func (s *defaultScheduler) Pick(wid WorkerID, _ map[TaskID]TaskStat, candidates Tasks) int {
+	var prefer func(TaskID) bool
+	if aff := s.affinity; aff != nil {
+		prefer = func(tid TaskID) bool {
+			w, ok := aff.Get(tid)
+			return ok && w == wid
+		}
+	}
+	return s.statmap.pickOrdered(candidates, prefer, s.position[wid])
+}
+
+// isDefaultScheduler returns true if the scheduler means the default criteria of the engine.
+func isDefaultScheduler(s Scheduler) bool {
+	_, ok := s.(DefaultScheduler)
+	return s == nil || ok
+}
+
+// WithScheduler sets the Scheduler used to choose the next task of a ready worker instance,
+// instead of the default criteria (see DefaultScheduler).
+// If the scheduler panics or returns an index out of range, the default criteria are used.
+// The affinity hint can't be used with a custom scheduler.
+// A nil scheduler means the default criteria (the default).
+func WithScheduler(s Scheduler) Option {
+	return func(o *options) {
+		o.scheduler = s
+	}
+}
@@ -0,0 +1,216 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// reverseScheduler picks the candidate with the highest TaskID,
+// or no candidate if pick is false.
+type reverseScheduler struct {
+	pick bool
+}
+
+func (s reverseScheduler) Pick(wid WorkerID, stats map[TaskID]TaskStat, candidates Tasks) int {
+	if !s.pick {
+		return -1
+	}
+	n := -1
+	for j, t := range candidates {
+		if n < 0 || t.TaskID() > candidates[n].TaskID() {
+			n = j
+		}
+	}
+	return n
+}
+
+// outOfRangeScheduler returns an index out of the candidates list.
+type outOfRangeScheduler struct{}
+
+func (outOfRangeScheduler) Pick(wid WorkerID, stats map[TaskID]TaskStat, candidates Tasks) int {
+	return len(candidates)
+}
+
+func TestDefaultScheduler(t *testing.T) {
+	stats := map[TaskID]TaskStat{
+		"t1": {Todo: 1, Doing: 1},
+		"t2": {Todo: 2},
+		"t3": {Todo: 1, Done: 1, Success: 1},
+		"t4": {Todo: 1},
+	}
+	tests := map[string]struct {
+		candidates Tasks
+		want       int
+	}{
+		"empty":         {candidates: Tasks{}, want: -1},
+		"single":        {candidates: Tasks{statTask("t3")}, want: 0},
+		"fewer doing":   {candidates: Tasks{statTask("t1"), statTask("t2")}, want: 1},
+		"fewer todo":    {candidates: Tasks{statTask("t2"), statTask("t4")}, want: 1},
+		"fewer success": {candidates: Tasks{statTask("t3"), statTask("t1"), statTask("t4")}, want: 2},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := (DefaultScheduler{}).Pick("w1", stats, tt.candidates); got != tt.want {
+				t.Errorf("want %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestEngine_WithScheduler(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}, {"t3", 10, true}},
+	}
+
+	tests := map[string]struct {
+		scheduler Scheduler
+		want      []TaskID
+		wantErr   bool
+	}{
+		"default":      {scheduler: nil, want: []TaskID{"t1", "t2", "t3"}},
+		"reverse":      {scheduler: reverseScheduler{pick: true}, want: []TaskID{"t3", "t2", "t1"}},
+		"none":         {scheduler: reverseScheduler{pick: false}},
+		"out of range": {scheduler: outOfRangeScheduler{}, want: []TaskID{"t1", "t2", "t3"}, wantErr: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var cbErr error
+			eng, err := NewEngine(workers, testingWorkerTasks(input),
+				WithScheduler(tt.scheduler),
+				WithOnCallbackError(func(err error) { cbErr = err }))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []TaskID
+			for e := range out {
+				if e.Type() == EventStart {
+					got = append(got, e.Task.TaskID())
+				}
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("starts mismatch (-want +got):\n%s", diff)
+			}
+			if (cbErr != nil) != tt.wantErr {
+				t.Errorf("want callback error %v, got %v", tt.wantErr, cbErr)
+			}
+		})
+	}
+}
+
+func TestEngine_WithScheduler_Panic(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+	}
+	var cbErr error
+	eng, err := NewEngine(workers, testingWorkerTasks(input),
+		WithScheduler(panicScheduler{}),
+		WithOnCallbackError(func(err error) { cbErr = err }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	res, err := eng.ExecuteAll(context.Background(), SuccessOrErrorResults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(res) != 1 || res[0].Error() != nil {
+		t.Errorf("want a success result with the default criteria, got %v", res)
+	}
+	if cbErr == nil {
+		t.Errorf("want the scheduler panic reported, got %v", cbErr)
+	}
+}
+
+// panicScheduler panics at each pick.
+type panicScheduler struct{}
+
+func (panicScheduler) Pick(wid WorkerID, stats map[TaskID]TaskStat, candidates Tasks) int {
+	panic("bad scheduler")
+}
+
+func TestEngine_WithScheduler_Default(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t3", 10, true}, {"t1", 10, true}, {"t4", 10, true}, {"t2", 10, true}},
+	}
+
+	// the DefaultScheduler is the same as the default, with the ordered pick too;
+	// a Picker is used as a Scheduler
+	tests := map[string]struct {
+		opts []Option
+		want []TaskID
+	}{
+		"default":                      {want: []TaskID{"t1", "t2", "t3", "t4"}},
+		"default scheduler":            {opts: []Option{WithScheduler(DefaultScheduler{})}, want: []TaskID{"t1", "t2", "t3", "t4"}},
+		"ordered pick":                 {opts: []Option{WithOrderedPick(true)}, want: []TaskID{"t3", "t1", "t4", "t2"}},
+		"default scheduler, ordered":   {opts: []Option{WithScheduler(DefaultScheduler{}), WithOrderedPick(true)}, want: []TaskID{"t3", "t1", "t4", "t2"}},
+		"picker, ordered pick ignored": {opts: []Option{WithPicker(DefaultPicker), WithOrderedPick(true)}, want: []TaskID{"t1", "t2", "t3", "t4"}},
+		"picker as scheduler":          {opts: []Option{WithScheduler(Picker(higherTaskIDPicker))}, want: []TaskID{"t4", "t3", "t2", "t1"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			eng, err := NewEngine(workers, testingWorkerTasks(input), tt.opts...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var got []TaskID
+			for e := range out {
+				if e.Type() == EventStart {
+					got = append(got, e.Task.TaskID())
+				}
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("starts mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestEngine_WithScheduler_DefaultAffinity(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+
+	// the affinity hint is considered by the DefaultScheduler
+	eng, err := NewEngine(workers, testingWorkerTasks(input),
+		WithScheduler(DefaultScheduler{}),
+		WithAffinity(NewAffinity(map[TaskID]WorkerID{"t2": "w1"})))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []TaskID
+	for e := range out {
+		if e.Type() == EventStart {
+			got = append(got, e.Task.TaskID())
+		}
+	}
+	if diff := cmp.Diff([]TaskID{"t2", "t1"}, got); diff != "" {
+		t.Errorf("starts mismatch (-want +got):\n%s", diff)
+	}
+}
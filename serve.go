@@ -0,0 +1,85 @@
+package taskengine
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+)
+
+// ServeTasks executes the batches of tasks received from the in chan,
+// with the workers and options of the engine, and returns a chan that receives
+// the results filtered based on the Mode parameter, as the Execute method.
+//
+// The batches are added to a single run with parked idle instances (see WithParkIdleInstances and AddTasks)
+// as soon as they are received, so that the tasks of a batch don't wait for the ones of the previous batches
+// and the number of instances of each worker is respected.
+// The TaskIDs must be unique across the batches.
+// An invalid batch (i.e. with tasks of an undefined worker, or already served) is skipped.
+// The errors (i.e. of an invalid batch, or of a run that can't be started)
+// are reported to the OnCallbackError function, if any.
+//
+// The returned chan is closed when the in chan is closed and every batch is completed,
+// or when the context is canceled.
+func (eng *Engine) ServeTasks(ctx context.Context, in <-chan WorkerTasks, mode Mode) <-chan Result {
+	out := make(chan Result)
+
+	// start the run, waiting for the tasks
+	run, err := eng.newRun(nil)
+	if err != nil {
+		eng.serveError(err)
+		close(out)
+		return out
+	}
+	run.opts.parkIdleInstances = true
+	atomic.AddInt32(&eng.running, 1)
+	run.done = func() { atomic.AddInt32(&eng.running, -1) }
+	results, err := run.Execute(ctx, mode)
+	if err != nil {
+		atomic.AddInt32(&eng.running, -1)
+		eng.serveError(err)
+		close(out)
+		return out
+	}
+
+	// feed the run with the batches
+	go func() {
+		defer run.endTasks()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case wts, ok := <-in:
+				if !ok {
+					return
+				}
+				if err := run.AddTasks(wts); err != nil {
+					eng.serveError(fmt.Errorf("invalid batch: %w", err))
+				}
+			}
+		}
+	}()
+
+	go func() {
+		defer close(out)
+		for res := range results {
+			select {
+			case out <- res:
+			case <-ctx.Done():
+				// the consumer may have stopped reading: the remaining results are discarded
+				go func() {
+					for range results {
+					}
+				}()
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// serveError reports an error of the ServeTasks method,
+// i.e. of the run or of an invalid batch.
+func (eng *Engine) serveError(err error) {
+	eng.opts.callbackError(fmt.Errorf("ServeTasks: %w", err))
+}
@@ -0,0 +1,161 @@
+package taskengine
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEngine_ServeTasks(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	var errs []error
+	eng, err := NewEngine(workers, nil, WithOnCallbackError(func(err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	in := make(chan WorkerTasks)
+	out := eng.ServeTasks(context.Background(), in, FirstSuccessOrLastResult)
+
+	go func() {
+		in <- testingWorkerTasks(map[string]testingTasks{
+			"w1": {{"t1", 10, true}, {"t2", 10, false}},
+			"w2": {{"t1", 20, true}},
+		})
+		in <- testingWorkerTasks(map[string]testingTasks{
+			"w9": {{"t9", 10, true}},
+		})
+		in <- testingWorkerTasks(map[string]testingTasks{
+			"w2": {{"t3", 10, true}},
+		})
+		close(in)
+	}()
+
+	got := []string{}
+	for res := range out {
+		got = append(got, res.(*testingResult).Tid)
+	}
+	sort.Strings(got)
+	if diff := cmp.Diff([]string{"t1", "t2", "t3"}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// the invalid batch is reported
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "undefined worker") {
+		t.Errorf("want 1 undefined worker error, got %v", errs)
+	}
+}
+
+func TestEngine_ServeTasks_InvalidMode(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	var errs []error
+	eng, err := NewEngine(workers, nil, WithOnCallbackError(func(err error) { errs = append(errs, err) }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	in := make(chan WorkerTasks)
+	for res := range eng.ServeTasks(context.Background(), in, Mode(-1)) {
+		t.Errorf("unexpected result %v", res)
+	}
+
+	// the error of the run is not reported as an invalid batch
+	if len(errs) != 1 || !strings.HasPrefix(errs[0].Error(), "ServeTasks: ") || strings.Contains(errs[0].Error(), "invalid batch") {
+		t.Errorf("want 1 ServeTasks error of the run, got %v", errs)
+	}
+}
+
+func TestEngine_ServeTasks_Cancel(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	eng, err := NewEngine(workers, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan WorkerTasks) // never closed
+	out := eng.ServeTasks(ctx, in, FirstSuccessOrLastResult)
+
+	in <- testingWorkerTasks(map[string]testingTasks{"w1": {{"t1", 10, true}}})
+	if res := <-out; res.Error() != nil {
+		t.Errorf("want success, got %v", res.Error())
+	}
+
+	cancel()
+	select {
+	case _, ok := <-out:
+		if ok {
+			t.Errorf("want closed chan, got a result")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("chan not closed after cancel")
+	}
+}
+
+func TestEngine_ServeTasks_Concurrent(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	eng, err := NewEngine(workers, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	in := make(chan WorkerTasks)
+	out := eng.ServeTasks(context.Background(), in, FirstSuccessOrLastResult)
+
+	// the slow task of the first batch doesn't delay the second batch
+	go func() {
+		in <- testingWorkerTasks(map[string]testingTasks{"w1": {{"t1", 200, true}}})
+		in <- testingWorkerTasks(map[string]testingTasks{"w2": {{"t2", 10, true}}})
+		close(in)
+	}()
+
+	got := []string{}
+	for res := range out {
+		got = append(got, res.(*testingResult).Tid)
+	}
+	if diff := cmp.Diff([]string{"t2", "t1"}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestEngine_ServeTasks_CancelNotConsumed(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+	}
+	eng, err := NewEngine(workers, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	in := make(chan WorkerTasks) // never closed
+	eng.ServeTasks(ctx, in, AllResults)
+
+	// the results are never received
+	in <- testingWorkerTasks(map[string]testingTasks{"w1": {{"t1", 10, true}, {"t2", 10, true}}})
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&eng.running) != 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := atomic.LoadInt32(&eng.running); n != 0 {
+		t.Errorf("want the run ended after cancel, got %d runs", n)
+	}
+}
@@ -0,0 +1,237 @@
+package taskengine
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// runTracker tracks the executions in progress of an engine
+// and the jobs being executed by the workers, so that they can be shut down or inspected.
+// It is shared by the executions of the engine.
+type runTracker struct {
+	mu      sync.Mutex
+	next    int
+	cancels map[int]context.CancelFunc  // cancel func of each execution in progress
+	jobs    map[*jobInput]time.Time     // start time of the jobs being executed by the workers
+	changed chan struct{}               // closed when a job returns
+	stats   map[int]map[TaskID]TaskStat // live stats of the tasks of each execution in progress
+	idle    map[int]map[WorkerID]Tasks  // remaining tasks of the idle workers of each execution in progress
+	inExec  map[int][]JobSnapshot       // jobs in execution of each execution in progress
+	starts  map[int]time.Time           // start time of each execution in progress
+	refresh map[int]runRefresh          // requests of the state of each execution in progress
+}
+
+// runRefresh receives the requests to publish the state of an execution in progress.
+// The execution publishes its state and closes the chan of the request.
+type runRefresh struct {
+	reqc chan chan struct{}
+	done chan struct{} // closed at the end of the execution
+}
+
+func newRunTracker() *runTracker {
+	return &runTracker{
+		cancels: map[int]context.CancelFunc{},
+		jobs:    map[*jobInput]time.Time{},
+		changed: make(chan struct{}),
+		stats:   map[int]map[TaskID]TaskStat{},
+		idle:    map[int]map[WorkerID]Tasks{},
+		inExec:  map[int][]JobSnapshot{},
+		starts:  map[int]time.Time{},
+		refresh: map[int]runRefresh{},
+	}
+}
+
+// addRun saves the cancel func of a new execution, started at the given time, and returns its ID.
+// The execution publishes its state when requested on refreshc (see setState).
+func (rt *runTracker) addRun(cancel context.CancelFunc, start time.Time, refreshc chan chan struct{}) int {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.next++
+	rt.cancels[rt.next] = cancel
+	rt.starts[rt.next] = start
+	rt.refresh[rt.next] = runRefresh{reqc: refreshc, done: make(chan struct{})}
+	return rt.next
+}
+
+// removeRun removes the execution, at its end.
+func (rt *runTracker) removeRun(id int) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	delete(rt.cancels, id)
+	delete(rt.stats, id)
+	delete(rt.idle, id)
+	delete(rt.inExec, id)
+	delete(rt.starts, id)
+	if r, ok := rt.refresh[id]; ok {
+		close(r.done)
+		delete(rt.refresh, id)
+	}
+}
+
+// refreshState asks every execution in progress to publish its current state
+// and waits until it is published, or the execution ends.
+// The state is published between the scheduling decisions of each execution,
+// so it is consistent.
+// NOTE: the state is published on request only, since copying it is expensive.
+func (rt *runTracker) refreshState() {
+	rt.mu.Lock()
+	runs := make([]runRefresh, 0, len(rt.refresh))
+	for _, r := range rt.refresh {
+		runs = append(runs, r)
+	}
+	rt.mu.Unlock()
+
+	for _, r := range runs {
+		published := make(chan struct{})
+		select {
+		case r.reqc <- published:
+			<-published
+		case <-r.done:
+		}
+	}
+}
+
+// setState saves a copy of the stats of the tasks of the execution,
+// of the remaining tasks of its idle workers and of its jobs in execution.
+func (rt *runTracker) setState(id int, statMap taskStatMap, idle map[WorkerID]Tasks, jobs []JobSnapshot) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.idle[id] = idle
+	rt.inExec[id] = jobs
+	stats := rt.stats[id]
+	if stats == nil {
+		stats = make(map[TaskID]TaskStat, len(statMap))
+		rt.stats[id] = stats
+	}
+	for tid, stat := range statMap {
+		stats[tid] = *stat
+	}
+}
+
+// taskStat returns the live stat of the task in the last execution started with the task.
+// The second value is false if no execution in progress has the task.
+func (rt *runTracker) taskStat(tid TaskID) (TaskStat, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	last := 0
+	var stat TaskStat
+	for id, stats := range rt.stats {
+		if s, ok := stats[tid]; ok && id > last {
+			last, stat = id, s
+		}
+	}
+	return stat, last > 0
+}
+
+// startJob saves the job, started at the given time, before the execution by the worker.
+func (rt *runTracker) startJob(req *jobInput, start time.Time) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	rt.jobs[req] = start
+}
+
+// endJob removes the job after the execution by the worker.
+func (rt *runTracker) endJob(req *jobInput) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	delete(rt.jobs, req)
+	close(rt.changed)
+	rt.changed = make(chan struct{})
+}
+
+// started returns the start time of the first job in execution of the task.
+// The second value is false if no job of the task is in execution.
+func (rt *runTracker) started(tid TaskID) (time.Time, bool) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	var first time.Time
+	for req, start := range rt.jobs {
+		if req.task.TaskID() == tid && (first.IsZero() || start.Before(first)) {
+			first = start
+		}
+	}
+	return first, !first.IsZero()
+}
+
+// cancelRuns cancels every execution in progress.
+func (rt *runTracker) cancelRuns() {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	for _, cancel := range rt.cancels {
+		cancel()
+	}
+}
+
+// pending returns the distinct tasks of the jobs being executed, ordered by TaskID,
+// and a chan closed when a job returns.
+func (rt *runTracker) pending() ([]TaskID, <-chan struct{}) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	seen := map[TaskID]bool{}
+	tids := []TaskID{}
+	for req := range rt.jobs {
+		if tid := req.task.TaskID(); !seen[tid] {
+			seen[tid] = true
+			tids = append(tids, tid)
+		}
+	}
+	sort.Slice(tids, func(i, j int) bool { return tids[i] < tids[j] })
+	return tids, rt.changed
+}
+
+// Shutdown cancels the executions in progress of the engine
+// and waits for the workers to acknowledge, i.e. to return from each job in execution,
+// giving them a chance to flush their work.
+// It returns the tasks of the jobs still in execution after the timeout,
+// or nil if every job returned in time.
+// A job is in execution from its Start event, so that a consumer calling Shutdown
+// after receiving the Start event always waits for the job.
+//
+// The executions go on until the end, as usual:
+// the jobs that didn't acknowledge in time still delay the end of their execution
+// (see WithCancelGrace to abandon them).
+func (eng *Engine) Shutdown(timeout time.Duration) []TaskID {
+	eng.tracker.cancelRuns()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		tids, changed := eng.tracker.pending()
+		if len(tids) == 0 {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return tids
+		}
+	}
+}
+
+// TaskElapsed returns how long the task has been running,
+// i.e. the time elapsed since the start of its first attempt still in execution,
+// considering every execution in progress of the engine.
+// It returns 0 if no attempt of the task is in execution.
+// It is safe to call it concurrently with the executions.
+func (eng *Engine) TaskElapsed(tid TaskID) time.Duration {
+	start, ok := eng.tracker.started(tid)
+	if !ok {
+		return 0
+	}
+	return eng.clock.Now().Sub(start)
+}
+
+// WouldBenefitFromMoreWorkers returns true if a new attempt of the task
+// could still yield its first success, i.e. the task has workers that have to do it
+// and no success yet. It helps a controller decide whether to add capacity.
+// The live stats of the task are considered, in the last execution in progress with the task:
+// it returns false if no execution in progress has the task.
+// It is safe to call it concurrently with the executions,
+// but not from the functions called by the engine during an execution (i.e. the Logger).
+func (eng *Engine) WouldBenefitFromMoreWorkers(tid TaskID) bool {
+	eng.tracker.refreshState()
+	stat, ok := eng.tracker.taskStat(tid)
+	return ok && stat.wouldBenefit()
+}
@@ -0,0 +1,202 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEngine_Shutdown(t *testing.T) {
+	// uncooperativeWorkFn ignores the cancellation until the end of the job
+	uncooperativeWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		time.Sleep(300 * time.Millisecond)
+		return &testingResult{Tid: string(task.TaskID()), Wid: string(worker.WorkerID), Err: ctx.Err()}
+	}
+
+	tests := map[string]struct {
+		work WorkFunc
+		want []TaskID
+	}{
+		"cooperative":   {work: testingWorkFn},
+		"uncooperative": {work: uncooperativeWorkFn, want: []TaskID{"t1", "t2"}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			workers := []*Worker{
+				{WorkerID: "w1", Instances: 2, Work: tt.work},
+			}
+			input := map[string]testingTasks{
+				"w1": {{"t1", 300, true}, {"t2", 300, true}, {"t3", 300, true}},
+			}
+			eng, err := NewEngine(workers, testingWorkerTasks(input))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// wait for the jobs of both instances to start
+			for starts := 0; starts < 2; {
+				if e := <-out; e.Type() == EventStart {
+					starts++
+				}
+			}
+			done := make(chan struct{})
+			go func() {
+				for range out {
+				}
+				close(done)
+			}()
+
+			start := time.Now()
+			got := eng.Shutdown(50 * time.Millisecond)
+			elapsed := time.Since(start)
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+			if elapsed > 200*time.Millisecond {
+				t.Errorf("want Shutdown to return within the timeout, got %v", elapsed)
+			}
+			<-done
+			if got := eng.Shutdown(0); got != nil {
+				t.Errorf("want nil after the end of the run, got %v", got)
+			}
+		})
+	}
+}
+
+// startBlockingLogger blocks the OnStart call until the release chan is closed.
+type startBlockingLogger struct {
+	NopLogger
+	release chan struct{}
+}
+
+func (l startBlockingLogger) OnStart(Event) { <-l.release }
+
+func TestEngine_Shutdown_TrackedFromStart(t *testing.T) {
+	// the job is held between the Start event and the work function:
+	// Shutdown must still wait for it, since the consumer has seen it started
+	logger := startBlockingLogger{release: make(chan struct{})}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithLogger(logger))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if e := <-out; e.Type() != EventStart {
+		t.Fatalf("want the Start event, got %v", e)
+	}
+
+	got := eng.Shutdown(50 * time.Millisecond)
+	if diff := cmp.Diff([]TaskID{"t1"}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	close(logger.release)
+	for range out {
+	}
+}
+
+func TestEngine_TaskElapsed(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 200, true}},
+		"w2": {{"t2", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := eng.TaskElapsed("t1"); got != 0 {
+		t.Errorf("before the run: want 0, got %v", got)
+	}
+
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// wait for the end of t2, while t1 is still running
+	for e := range out {
+		if e.Type() == EventSuccess && e.Task.TaskID() == "t2" {
+			break
+		}
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := eng.TaskElapsed("t1"); got < 50*time.Millisecond || got > 200*time.Millisecond {
+		t.Errorf("t1 running: want elapsed in 50..200ms, got %v", got)
+	}
+	if got := eng.TaskElapsed("t2"); got != 0 {
+		t.Errorf("t2 completed: want 0, got %v", got)
+	}
+	if got := eng.TaskElapsed("t9"); got != 0 {
+		t.Errorf("t9 unknown: want 0, got %v", got)
+	}
+
+	for range out {
+	}
+	if got := eng.TaskElapsed("t1"); got != 0 {
+		t.Errorf("after the run: want 0, got %v", got)
+	}
+}
+
+func TestEngine_WouldBenefitFromMoreWorkers(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 200, true}, {"t2", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if eng.WouldBenefitFromMoreWorkers("t1") {
+		t.Errorf("t1: want false before the run")
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// wait for t1 to start
+	for e := range out {
+		if e.Type() == EventStart {
+			break
+		}
+	}
+	// the stats are updated by the run after the job is sent
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for eng.WouldBenefitFromMoreWorkers("t1") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	want := map[TaskID]bool{"t1": false, "t2": true, "t9": false}
+	for tid, w := range want {
+		if got := eng.WouldBenefitFromMoreWorkers(tid); got != w {
+			t.Errorf("%s: want %v, got %v", tid, w, got)
+		}
+	}
+
+	for range out {
+	}
+	if eng.WouldBenefitFromMoreWorkers("t2") {
+		t.Errorf("t2: want false after the run")
+	}
+}
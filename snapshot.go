@@ -0,0 +1,89 @@
+package taskengine
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+)
+
+// JobSnapshot describes a job in execution.
+type JobSnapshot struct {
+	JobID     JobID     `json:"job_id"`
+	WorkerID  WorkerID  `json:"worker_id"`
+	Instance  int       `json:"instance"`
+	TaskID    TaskID    `json:"task_id"`
+	TimeStart time.Time `json:"time_start"` // time the job was sent to the worker instance
+}
+
+// EngineSnapshot is a consistent view of the executions in progress of an engine,
+// i.e. to render a frame of a live visualization.
+// The progress fields consider the tasks of every execution in progress,
+// and the elapsed time is measured from the start of the first of them.
+// It is a deep copy, that can be serialized to JSON.
+type EngineSnapshot struct {
+	ProgressSnapshot
+	Runs int           `json:"runs"` // number of executions in progress
+	Jobs []JobSnapshot `json:"jobs"` // jobs in execution, in order of start
+	Idle []WorkerID    `json:"idle"` // workers with an idle instance, in order of WorkerID
+}
+
+// MarshalJSON returns the json representation of the snapshot.
+// The empty lists are represented as empty arrays, not null.
+func (s EngineSnapshot) MarshalJSON() ([]byte, error) {
+	type snapshot EngineSnapshot
+	if s.Jobs == nil {
+		s.Jobs = []JobSnapshot{}
+	}
+	if s.Idle == nil {
+		s.Idle = []WorkerID{}
+	}
+	return json.Marshal(snapshot(s))
+}
+
+// snapshot returns the snapshot of the executions in progress at the given time.
+// NOTE: the state of each execution is published at once, between its scheduling decisions
+// (see refreshState), so the stats, the jobs and the idle workers of the execution are consistent.
+func (rt *runTracker) snapshot(now time.Time) *EngineSnapshot {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	statMap := taskStatMap{}
+	var start time.Time
+	snap := &EngineSnapshot{Runs: len(rt.starts)}
+	idle := map[WorkerID]bool{}
+	for id, t := range rt.starts {
+		if start.IsZero() || t.Before(start) {
+			start = t
+		}
+		for tid, stat := range rt.stats[id] {
+			stat := stat
+			statMap[tid] = &stat
+		}
+		snap.Jobs = append(snap.Jobs, rt.inExec[id]...)
+		for wid := range rt.idle[id] {
+			idle[wid] = true
+		}
+	}
+	if start.IsZero() {
+		start = now
+	}
+	snap.ProgressSnapshot = newProgressSnapshot(statMap, start, now)
+
+	sort.SliceStable(snap.Jobs, func(i, j int) bool { return snap.Jobs[i].TimeStart.Before(snap.Jobs[j].TimeStart) })
+	for wid := range idle {
+		snap.Idle = append(snap.Idle, wid)
+	}
+	sort.Slice(snap.Idle, func(i, j int) bool { return snap.Idle[i] < snap.Idle[j] })
+	return snap
+}
+
+// Snapshot returns a consistent view of the executions in progress of the engine:
+// the stat of each task, the jobs in execution, the idle workers and the overall progress.
+// Unlike separate calls of the query methods (i.e. Preview), the values are read at once.
+// Without executions in progress, the snapshot has no tasks.
+// It is safe to call it concurrently with the executions,
+// but not from the functions called by the engine during an execution (i.e. the Logger).
+func (eng *Engine) Snapshot() *EngineSnapshot {
+	eng.tracker.refreshState()
+	return eng.tracker.snapshot(eng.clock.Now())
+}
@@ -0,0 +1,97 @@
+package taskengine
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEngine_Snapshot(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w3", Instances: 3, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, false}, {"t2", 20, true}, {"t3", 10, true}, {"t4", 30, false}},
+		"w2": {{"t2", 10, true}, {"t4", 20, true}, {"t5", 10, false}},
+		"w3": {{"t1", 20, true}, {"t3", 30, false}, {"t5", 10, true}, {"t6", 10, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if snap := eng.Snapshot(); snap.Runs != 0 || len(snap.Tasks) != 0 || len(snap.Jobs) != 0 {
+		t.Errorf("want empty snapshot before the run, got %+v", snap)
+	}
+
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// take the snapshots while the run goes on
+	done := make(chan struct{})
+	snaps := make(chan *EngineSnapshot, 1000)
+	go func() {
+		defer close(snaps)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				snaps <- eng.Snapshot()
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}()
+	for range out {
+	}
+	close(done)
+
+	jobs := 0
+	for snap := range snaps {
+		if snap.Runs == 0 {
+			continue
+		}
+		// each job in execution is counted by the stat of its task
+		doing := map[TaskID]int{}
+		for _, job := range snap.Jobs {
+			doing[job.TaskID]++
+		}
+		for tid, stat := range snap.Tasks {
+			if stat.Doing != doing[tid] {
+				t.Fatalf("%s: want %d jobs in execution, got %d: %+v", tid, stat.Doing, doing[tid], snap)
+			}
+		}
+		jobs += len(snap.Jobs)
+	}
+	if jobs == 0 {
+		t.Errorf("want some snapshot with jobs in execution")
+	}
+
+	if snap := eng.Snapshot(); snap.Runs != 0 || len(snap.Tasks) != 0 {
+		t.Errorf("want empty snapshot after the run, got %+v", snap)
+	}
+}
+
+func TestEngineSnapshot_MarshalJSON(t *testing.T) {
+	t0 := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	snap := EngineSnapshot{
+		ProgressSnapshot: newProgressSnapshot(taskStatMap{"t1": {Doing: 1}}, t0, t0.Add(time.Second)),
+		Runs:             1,
+		Jobs:             []JobSnapshot{{JobID: "w1/t1/1/1", WorkerID: "w1", TaskID: "t1", TimeStart: t0}},
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, key := range []string{`"runs":1`, `"idle":[]`, `"job_id":"w1/t1/1/1"`, `"t1":{`, `"progress":0`} {
+		if !strings.Contains(string(data), key) {
+			t.Errorf("want %s in %s", key, data)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package taskengine
+
+import "sync"
+
+// defaultSubscriberBuffer is the default buffer size of a subscriber chan.
+const defaultSubscriberBuffer = 100
+
+// subscribers contains the chans of the active subscribers of the engine events.
+type subscribers struct {
+	mu    sync.Mutex
+	next  int
+	chans map[int]chan *Event
+}
+
+func newSubscribers() *subscribers {
+	return &subscribers{chans: map[int]chan *Event{}}
+}
+
+// publish sends the event to each subscriber, without blocking:
+// if the buffer of a subscriber is full, the event is dropped for it.
+func (s *subscribers) publish(e *Event) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ch := range s.chans {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// WithSubscriberBuffer sets the buffer size of the chans returned by the Subscribe method.
+// A subscriber that doesn't keep up with the events loses the events
+// that don't fit in its buffer, without blocking the engine and the other subscribers.
+// If n is not positive, the default buffer size (100) is used.
+func WithSubscriberBuffer(n int) Option {
+	return func(o *options) {
+		o.subscriberBuffer = n
+	}
+}
+
+// Subscribe returns a new chan that receives a copy of each event
+// of every run of the engine (the same events returned by the ExecuteEvents method),
+// and a function to unsubscribe.
+// The chan is closed only by the unsubscribe function, not at the end of a run.
+// Subscribers don't block the engine: see WithSubscriberBuffer.
+func (eng *Engine) Subscribe() (<-chan *Event, func()) {
+	n := eng.opts.subscriberBuffer
+	if n <= 0 {
+		n = defaultSubscriberBuffer
+	}
+	ch := make(chan *Event, n)
+
+	s := eng.subs
+	s.mu.Lock()
+	id := s.next
+	s.next++
+	s.chans[id] = ch
+	s.mu.Unlock()
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.chans, id)
+			close(ch)
+			s.mu.Unlock()
+		})
+	}
+	return ch, unsubscribe
+}
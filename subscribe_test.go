@@ -0,0 +1,86 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+)
+
+func TestEngine_Subscribe(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}},
+		"w2": {{"t1", 30, true}, {"t3", 10, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	sub1, unsub1 := eng.Subscribe()
+	sub2, unsub2 := eng.Subscribe()
+
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []*Event{}
+	for e := range out {
+		want = append(want, e)
+	}
+
+	// the subscribers receive the same events, in the same order
+	unsub1()
+	unsub2()
+	unsub2() // no panic
+	for j, sub := range []<-chan *Event{sub1, sub2} {
+		got := []*Event{}
+		for e := range sub {
+			got = append(got, e)
+		}
+		if len(got) != len(want) {
+			t.Errorf("subscriber %d: want %d events, got %d", j+1, len(want), len(got))
+			continue
+		}
+		for k := range want {
+			if got[k] != want[k] {
+				t.Errorf("subscriber %d: event #%d: want %v, got %v", j+1, k, want[k], got[k])
+			}
+		}
+	}
+}
+
+func TestEngine_Subscribe_SlowSubscriber(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 1, true}, {"t2", 1, true}, {"t3", 1, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithSubscriberBuffer(2))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// the subscriber doesn't read the events during the run
+	sub, unsub := eng.Subscribe()
+
+	results, err := eng.ExecuteAll(context.Background(), FirstSuccessOrLastResult)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 3 {
+		t.Errorf("want 3 results, got %d", len(results))
+	}
+
+	unsub()
+	n := 0
+	for range sub {
+		n++
+	}
+	if n != 2 {
+		t.Errorf("want 2 buffered events, got %d", n)
+	}
+}
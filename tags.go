@@ -0,0 +1,50 @@
+package taskengine
+
+// TaggedTask is a task with tags, i.e. to group the tasks of a mixed batch.
+// It is an optional interface: the tasks without tags don't need to implement it.
+type TaggedTask interface {
+	Task
+	Tags() []string
+}
+
+// HasTag returns true if the task has the given tag.
+// A task not implementing the TaggedTask interface has no tags.
+func HasTag(task Task, tag string) bool {
+	tt, ok := task.(TaggedTask)
+	if !ok {
+		return false
+	}
+	for _, t := range tt.Tags() {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// TagFilterFunc returns a function that, given an *Event,
+// returns true if the task of the event has the given tag.
+// It can be combined with the mode filter, i.e. to filter the results of ExecuteAll
+// (see WithResultFilter).
+func TagFilterFunc(tag string) func(*Event) bool {
+	return func(e *Event) bool {
+		return e != nil && e.Task != nil && HasTag(e.Task, tag)
+	}
+}
+
+// FilterByTag returns a chan that receives the events of the chan
+// whose task has the given tag.
+// The returned chan is closed when the events chan is closed.
+func FilterByTag(events <-chan *Event, tag string) <-chan *Event {
+	out := make(chan *Event)
+	keep := TagFilterFunc(tag)
+	go func() {
+		defer close(out)
+		for e := range events {
+			if keep(e) {
+				out <- e
+			}
+		}
+	}()
+	return out
+}
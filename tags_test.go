@@ -0,0 +1,125 @@
+package taskengine
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// testingTaggedTask is a testingTask with tags.
+type testingTaggedTask struct {
+	*testingTask
+	tags []string
+}
+
+func (t *testingTaggedTask) Tags() []string { return t.tags }
+
+// testingTaggedWorkFn is like testingWorkFn, but it accepts also the tagged tasks.
+func testingTaggedWorkFn(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+	if tt, ok := task.(*testingTaggedTask); ok {
+		task = tt.testingTask
+	}
+	return testingWorkFn(ctx, worker, workerInst, task)
+}
+
+func TestHasTag(t *testing.T) {
+	task := &testingTaggedTask{&testingTask{"t1", 0, true}, []string{"a", "b"}}
+
+	tests := map[string]struct {
+		task Task
+		tag  string
+		want bool
+	}{
+		"first tag":    {task: task, tag: "a", want: true},
+		"second tag":   {task: task, tag: "b", want: true},
+		"missing tag":  {task: task, tag: "c", want: false},
+		"untagged":     {task: &testingTask{"t2", 0, true}, tag: "a", want: false},
+		"no tags":      {task: &testingTaggedTask{&testingTask{"t3", 0, true}, nil}, tag: "a", want: false},
+		"empty string": {task: task, tag: "", want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := HasTag(tt.task, tt.tag); got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestFilterByTag(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: testingTaggedWorkFn},
+	}
+	tagged := func(tid string, tags ...string) Task {
+		return &testingTaggedTask{&testingTask{tid, 10, true}, tags}
+	}
+	wts := WorkerTasks{
+		"w1": {
+			tagged("t1", "red"),
+			tagged("t2", "red", "blue"),
+			tagged("t3", "blue"),
+			&testingTask{"t4", 10, true},
+		},
+	}
+
+	tests := map[string]struct {
+		tag  string
+		want []TaskID
+	}{
+		"red":     {tag: "red", want: []TaskID{"t1", "t2"}},
+		"blue":    {tag: "blue", want: []TaskID{"t2", "t3"}},
+		"missing": {tag: "green", want: []TaskID{}},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			eng, err := NewEngine(workers, wts)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			events, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := []TaskID{}
+			for e := range FilterByTag(events, tt.tag) {
+				if IsResult(e) {
+					got = append(got, e.Task.TaskID())
+				}
+			}
+			sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestTagFilterFunc_ExecuteAll(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingTaggedWorkFn},
+	}
+	wts := WorkerTasks{
+		"w1": {
+			&testingTaggedTask{&testingTask{"t1", 10, true}, []string{"red"}},
+			&testingTaggedTask{&testingTask{"t2", 10, true}, []string{"blue"}},
+		},
+	}
+	eng, err := NewEngine(workers, wts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	red := TagFilterFunc("red")
+	filter := func(e *Event) bool { return IsResult(e) && red(e) }
+	results, err := eng.ExecuteAll(context.Background(), AllResults, WithResultFilter(filter))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].(*testingResult).Tid != "t1" {
+		t.Errorf("want the result of t1 only, got %v", results)
+	}
+}
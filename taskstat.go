@@ -1,6 +1,9 @@
 package taskengine
 
-import "fmt"
+import (
+	"encoding/json"
+	"fmt"
+)
 
 // TaskStat type object tracks the number of workers dealing with the task.
 // It is used to dynamically choose the next task to execute.
@@ -21,12 +24,59 @@ func (stat *TaskStat) Completed() bool {
 	return (stat.Todo == 0) && (stat.Doing == 0)
 }
 
+// wouldBenefit returns if a new attempt could still yield the first success of the task:
+// some worker has to do the task and no worker has done it with success.
+func (stat TaskStat) wouldBenefit() bool {
+	return stat.Todo > 0 && stat.Success == 0
+}
+
 // String representation of a TaskStat object.
 func (stat TaskStat) String() string {
 	return fmt.Sprintf("[%d %d %d(%d)]",
 		stat.Todo, stat.Doing, stat.Done, stat.Success)
 }
 
+// taskStatJSON is the json representation of a TaskStat object,
+// including the derived error and total counters.
+type taskStatJSON struct {
+	Todo    int `json:"todo"`
+	Doing   int `json:"doing"`
+	Done    int `json:"done"`
+	Success int `json:"success"`
+	Error   int `json:"error"`
+	Total   int `json:"total"`
+}
+
+// MarshalJSON returns the json representation of the TaskStat.
+// Besides the fields, it contains the derived error (Done - Success)
+// and total (Todo + Doing + Done) counters.
+func (stat TaskStat) MarshalJSON() ([]byte, error) {
+	return json.Marshal(taskStatJSON{
+		Todo:    stat.Todo,
+		Doing:   stat.Doing,
+		Done:    stat.Done,
+		Success: stat.Success,
+		Error:   stat.Done - stat.Success,
+		Total:   stat.Todo + stat.Doing + stat.Done,
+	})
+}
+
+// UnmarshalJSON sets the TaskStat from its json representation.
+// The derived error and total counters are ignored.
+func (stat *TaskStat) UnmarshalJSON(data []byte) error {
+	var j taskStatJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*stat = TaskStat{
+		Todo:    j.Todo,
+		Doing:   j.Doing,
+		Done:    j.Done,
+		Success: j.Success,
+	}
+	return nil
+}
+
 // taskStatMap maps TaskID -> taskInfo.
 type taskStatMap map[TaskID]*TaskStat
 
@@ -92,12 +142,33 @@ func (statmap taskStatMap) done(tid TaskID, success bool) {
 	}
 }
 
+// discard decrements the todo number by n,
+// when n of the remaining tasks will never be picked.
+// WARN: it doesn't check that task exists and todo >= n.
+func (statmap taskStatMap) discard(tid TaskID, n int) {
+	statmap[tid].Todo -= n
+}
+
 // pick choose among the tasks list the best task to execute next.
 // The task is chosen so to maximize the thoughput of the tasks successfully executed.
 // It returns -1 if the tasks list is empty, or the index of the choosen task in the list.
 // It doesn't updates neither the Tasks nor the taskInfoMap.
 // WARN: it doesn't check every TaskID exists in taskStatMap.
 func (statmap taskStatMap) pick(ts Tasks) int {
+	return statmap.pickPrefer(ts, nil)
+}
+
+// pickPrefer is like pick, but in case of tasks with the same stat
+// the tasks satisfying the prefer function are chosen before considering the TaskID.
+// A nil prefer function is ignored.
+func (statmap taskStatMap) pickPrefer(ts Tasks, prefer func(TaskID) bool) int {
+	return statmap.pickOrdered(ts, prefer, nil)
+}
+
+// pickOrdered is like pickPrefer, but the tasks with the same stat and preference
+// are chosen by their position in the order map before considering the TaskID.
+// A nil order map is ignored.
+func (statmap taskStatMap) pickOrdered(ts Tasks, prefer func(TaskID) bool, order map[TaskID]int) int {
 	L := len(ts)
 	if L == 0 {
 		return -1
@@ -121,11 +192,21 @@ func (statmap taskStatMap) pick(ts Tasks) int {
 					// else prefer task with fewer todo
 					continue
 				} else if s.Todo == s0.Todo {
-					// else prefer task with lower TaskID
-					// NOTE: only needed to be deterministic
 					tid0 := ts[j0].TaskID()
 					tid := ts[j].TaskID()
-					if tid >= tid0 {
+					if p, p0 := prefer != nil && prefer(tid), prefer != nil && prefer(tid0); p != p0 {
+						// else prefer task satisfying the prefer func
+						if p0 {
+							continue
+						}
+					} else if pos, pos0 := order[tid], order[tid0]; order != nil && pos != pos0 {
+						// else prefer task submitted first
+						if pos > pos0 {
+							continue
+						}
+					} else if tid >= tid0 {
+						// else prefer task with lower TaskID
+						// NOTE: only needed to be deterministic
 						continue
 					}
 				}
@@ -1,6 +1,7 @@
 package taskengine
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"testing"
@@ -127,3 +128,132 @@ func TestPick(t *testing.T) {
 		}
 	}
 }
+
+func TestPickPrefer(t *testing.T) {
+	statmap := taskStatMap{
+		"t1": &TaskStat{1, 0, 0, 0},
+		"t2": &TaskStat{1, 0, 0, 0},
+		"t3": &TaskStat{2, 0, 0, 0},
+		"t4": &TaskStat{1, 1, 0, 0},
+	}
+	tasks := Tasks{statTask("t1"), statTask("t2"), statTask("t3"), statTask("t4")}
+	preferSet := func(tids ...TaskID) func(TaskID) bool {
+		return func(tid TaskID) bool {
+			for _, t := range tids {
+				if t == tid {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	testCases := map[string]struct {
+		prefer func(TaskID) bool
+		want   int
+	}{
+		"nil prefer":             {nil, 0},
+		"prefer none":            {preferSet(), 0},
+		"prefer tie":             {preferSet("t2"), 1},
+		"prefer both tie":        {preferSet("t1", "t2"), 0},
+		"prefer not tie (todo)":  {preferSet("t3"), 0},
+		"prefer not tie (doing)": {preferSet("t4"), 0},
+	}
+
+	for title, tc := range testCases {
+		got := statmap.pickPrefer(tasks, tc.prefer)
+		if got != tc.want {
+			t.Errorf("%s: want %d, got %d", title, tc.want, got)
+		}
+	}
+}
+
+func TestPickOrdered(t *testing.T) {
+	statmap := taskStatMap{
+		"t1": &TaskStat{1, 0, 0, 0},
+		"t2": &TaskStat{1, 0, 0, 0},
+		"t3": &TaskStat{1, 0, 0, 0},
+		"t4": &TaskStat{1, 1, 0, 0},
+	}
+	tasks := Tasks{statTask("t1"), statTask("t2"), statTask("t3"), statTask("t4")}
+
+	testCases := map[string]struct {
+		order  map[TaskID]int
+		prefer func(TaskID) bool
+		want   int
+	}{
+		"nil order":        {nil, nil, 0},
+		"order tie":        {map[TaskID]int{"t1": 2, "t2": 1, "t3": 0, "t4": 3}, nil, 2},
+		"order not tie":    {map[TaskID]int{"t1": 1, "t2": 2, "t3": 3, "t4": 0}, nil, 0},
+		"order same":       {map[TaskID]int{"t1": 0, "t2": 0, "t3": 0, "t4": 0}, nil, 0},
+		"prefer first":     {map[TaskID]int{"t1": 2, "t2": 1, "t3": 0, "t4": 3}, func(tid TaskID) bool { return tid == "t1" }, 0},
+		"missing in order": {map[TaskID]int{"t2": 1}, nil, 0},
+	}
+
+	for title, tc := range testCases {
+		got := statmap.pickOrdered(tasks, tc.prefer, tc.order)
+		if got != tc.want {
+			t.Errorf("%s: want %d, got %d", title, tc.want, got)
+		}
+	}
+}
+
+func TestTaskStat_JSON(t *testing.T) {
+	stat := TaskStat{Todo: 1, Doing: 2, Done: 3, Success: 1}
+	want := `{"todo":1,"doing":2,"done":3,"success":1,"error":2,"total":6}`
+
+	got, err := json.Marshal(stat)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	var stat2 TaskStat
+	if err := json.Unmarshal(got, &stat2); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stat2 != stat {
+		t.Errorf("round trip: want %v, got %v", stat, stat2)
+	}
+
+	if err := json.Unmarshal([]byte(`[1, 2]`), &stat2); err == nil {
+		t.Errorf("expected error, got nil")
+	}
+}
+
+func TestTaskStat_JSON_Event(t *testing.T) {
+	e := &Event{WorkerID: "w1", TaskStat: TaskStat{Todo: 0, Doing: 1, Done: 2, Success: 2}}
+	b, err := json.Marshal(e)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := `"TaskStat":{"todo":0,"doing":1,"done":2,"success":2,"error":0,"total":3}`
+	if !strings.Contains(string(b), want) {
+		t.Errorf("want %s in %s", want, b)
+	}
+}
+
+func TestTaskStat_WouldBenefit(t *testing.T) {
+	tests := map[string]struct {
+		stat TaskStat
+		want bool
+	}{
+		"nothing to do":          {stat: TaskStat{}, want: false},
+		"todo":                   {stat: TaskStat{Todo: 2}, want: true},
+		"todo and doing":         {stat: TaskStat{Todo: 1, Doing: 1}, want: true},
+		"todo after errors":      {stat: TaskStat{Todo: 1, Done: 2}, want: true},
+		"todo after success":     {stat: TaskStat{Todo: 1, Done: 1, Success: 1}, want: false},
+		"only doing":             {stat: TaskStat{Doing: 2}, want: false},
+		"completed with errors":  {stat: TaskStat{Done: 2}, want: false},
+		"completed with success": {stat: TaskStat{Done: 2, Success: 1}, want: false},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.stat.wouldBenefit(); got != tt.want {
+				t.Errorf("%v: want %v, got %v", tt.stat, tt.want, got)
+			}
+		})
+	}
+}
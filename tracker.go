@@ -0,0 +1,232 @@
+package taskengine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TaskState is the state of a task, as seen by a ProgressTracker.
+type TaskState int
+
+const (
+	StateWaiting  TaskState = iota // no worker is doing the task, but some worker has still to do it
+	StateRunning                   // some worker is doing the task
+	StateSuccess                   // the task has a success result
+	StateError                     // the task is completed without success, the last result is an error
+	StateCanceled                  // the task is completed without success, the last result is canceled
+)
+
+// String representation of a TaskState.
+func (s TaskState) String() string {
+	switch s {
+	case StateWaiting:
+		return "WAITING"
+	case StateRunning:
+		return "RUNNING"
+	case StateSuccess:
+		return "SUCCESS"
+	case StateError:
+		return "ERROR"
+	case StateCanceled:
+		return "CANCELED"
+	}
+	return "INVALID"
+}
+
+// TaskProgress contains the progress of a task, as seen by a ProgressTracker.
+type TaskProgress struct {
+	TaskID  TaskID
+	State   TaskState
+	Elapsed time.Duration // since the first start, until the success or the completion of the task
+	Workers []WorkerID    // distinct workers doing the task, in order of start
+	Stat    TaskStat      // stat of the last event of the task
+}
+
+// String returns a representation of the progress of the task,
+// i.e. "t1: RUNNING (3s, 2 workers)" or "t2: SUCCESS (5s)".
+func (p TaskProgress) String() string {
+	elapsed := p.Elapsed.Round(time.Millisecond)
+	if p.State == StateRunning {
+		return fmt.Sprintf("%s: %s (%v, %d workers)", p.TaskID, p.State, elapsed, len(p.Workers))
+	}
+	return fmt.Sprintf("%s: %s (%v)", p.TaskID, p.State, elapsed)
+}
+
+// TimelineJob is a job of a worker instance in the timeline of a ProgressTracker.
+type TimelineJob struct {
+	TaskID    TaskID
+	Type      EventType // type of the result event of the job
+	TimeStart time.Time
+	TimeEnd   time.Time
+}
+
+// WorkerTimeline contains the jobs executed by a worker instance, in order of result.
+type WorkerTimeline struct {
+	WorkerID WorkerID
+	Instance int
+	Jobs     []TimelineJob
+}
+
+// String returns a representation of the timeline of the worker instance,
+// i.e. "w1[0]: |SUCCESS t1|ERROR t3|".
+func (wt WorkerTimeline) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s[%d]: |", wt.WorkerID, wt.Instance)
+	for _, job := range wt.Jobs {
+		fmt.Fprintf(&sb, "%s %s|", strings.ToUpper(job.Type.String()), job.TaskID)
+	}
+	return sb.String()
+}
+
+// trackedTask is the state of a task in a ProgressTracker.
+type trackedTask struct {
+	start   time.Time // time of the first start
+	end     time.Time // time of the success or completion, if any
+	last    EventType // type of the last result
+	running map[JobID]WorkerID
+	order   []JobID // running jobs, in order of start
+	stat    TaskStat
+}
+
+// ProgressTracker tracks the progress of the tasks of an execution of the engine.
+// It is driven by updating it with every event emitted by the ExecuteEvents method,
+// while another goroutine can take the snapshots of the progress, i.e. for a live dashboard.
+// After the execution, it also returns the timeline of the jobs of each worker instance.
+type ProgressTracker struct {
+	mu       sync.Mutex
+	tasks    map[TaskID]*trackedTask
+	timeline map[instanceID]*WorkerTimeline
+}
+
+// instanceID identifies a worker instance.
+type instanceID struct {
+	wid      WorkerID
+	instance int
+}
+
+// NewProgressTracker returns a new empty ProgressTracker.
+func NewProgressTracker() *ProgressTracker {
+	return &ProgressTracker{
+		tasks:    map[TaskID]*trackedTask{},
+		timeline: map[instanceID]*WorkerTimeline{},
+	}
+}
+
+// Update updates the progress with the event.
+// Only the Start and result events are considered.
+func (pt *ProgressTracker) Update(e *Event) {
+	etype := e.Type()
+	if etype != EventStart && !IsResult(e) {
+		return
+	}
+
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	tid := e.Task.TaskID()
+	tt := pt.tasks[tid]
+	if tt == nil {
+		tt = &trackedTask{start: e.TimeStart, running: map[JobID]WorkerID{}}
+		pt.tasks[tid] = tt
+	}
+	tt.stat = e.TaskStat
+
+	if etype == EventStart {
+		tt.running[e.JobID] = e.WorkerID
+		tt.order = append(tt.order, e.JobID)
+		return
+	}
+
+	// result event
+	if e.TimeStart.Before(tt.start) {
+		// i.e. a cached result
+		tt.start = e.TimeStart
+	}
+	delete(tt.running, e.JobID)
+	if tt.last != EventSuccess {
+		tt.last = etype
+	}
+	if tt.end.IsZero() && (etype == EventSuccess || e.TaskStat.Completed()) {
+		tt.end = e.TimeEnd
+	}
+
+	key := instanceID{e.WorkerID, e.WorkerInst}
+	wt := pt.timeline[key]
+	if wt == nil {
+		wt = &WorkerTimeline{WorkerID: e.WorkerID, Instance: e.WorkerInst}
+		pt.timeline[key] = wt
+	}
+	wt.Jobs = append(wt.Jobs, TimelineJob{
+		TaskID:    tid,
+		Type:      etype,
+		TimeStart: e.TimeStart,
+		TimeEnd:   e.TimeEnd,
+	})
+}
+
+// Snapshot returns the progress of the tasks seen so far, sorted by TaskID.
+// The elapsed time of the tasks not yet succeeded or completed is computed up to now.
+func (pt *ProgressTracker) Snapshot() []TaskProgress {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	now := time.Now()
+	snap := make([]TaskProgress, 0, len(pt.tasks))
+	for tid, tt := range pt.tasks {
+		p := TaskProgress{TaskID: tid, Stat: tt.stat}
+		end := tt.end
+		if end.IsZero() {
+			end = now
+		}
+		p.Elapsed = end.Sub(tt.start)
+
+		for _, jid := range tt.order {
+			if wid, ok := tt.running[jid]; ok && !containsWorker(p.Workers, wid) {
+				p.Workers = append(p.Workers, wid)
+			}
+		}
+
+		switch {
+		case tt.last == EventSuccess:
+			p.State = StateSuccess
+		case len(tt.running) > 0:
+			p.State = StateRunning
+		case !tt.stat.Completed():
+			p.State = StateWaiting
+		case tt.last == EventCanceled:
+			p.State = StateCanceled
+		default:
+			p.State = StateError
+		}
+		snap = append(snap, p)
+	}
+	sort.Slice(snap, func(i, j int) bool { return snap[i].TaskID < snap[j].TaskID })
+	return snap
+}
+
+// Timeline returns the jobs executed by each worker instance, in order of result,
+// sorted by WorkerID and instance.
+// It is meant to be called after the execution, when all the results are known.
+func (pt *ProgressTracker) Timeline() []WorkerTimeline {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	tl := make([]WorkerTimeline, 0, len(pt.timeline))
+	for _, wt := range pt.timeline {
+		tl = append(tl, WorkerTimeline{
+			WorkerID: wt.WorkerID,
+			Instance: wt.Instance,
+			Jobs:     append([]TimelineJob(nil), wt.Jobs...),
+		})
+	}
+	sort.Slice(tl, func(i, j int) bool {
+		if tl[i].WorkerID != tl[j].WorkerID {
+			return tl[i].WorkerID < tl[j].WorkerID
+		}
+		return tl[i].Instance < tl[j].Instance
+	})
+	return tl
+}
@@ -0,0 +1,140 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProgressTracker(t *testing.T) {
+	t0 := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	at := func(sec int) time.Time { return t0.Add(time.Duration(sec) * time.Second) }
+	task := func(tid string) Task { return &testingTask{tid, 0, true} }
+	start := func(wid WorkerID, inst int, tid string, jid JobID, stat TaskStat, sec int) *Event {
+		return &Event{WorkerID: wid, WorkerInst: inst, Task: task(tid), JobID: jid, TaskStat: stat, TimeStart: at(sec), TimeEnd: at(sec)}
+	}
+	result := func(s *Event, res Result, stat TaskStat, sec int) *Event {
+		e := *s
+		e.Result, e.TaskStat, e.TimeEnd = res, stat, at(sec)
+		return &e
+	}
+
+	s1a := start("a", 1, "t1", "a/t1/1/1", TaskStat{1, 1, 0, 0}, 0)
+	s1b := start("b", 0, "t1", "b/t1/2/2", TaskStat{0, 2, 0, 0}, 1)
+	s2 := start("a", 0, "t2", "a/t2/1/3", TaskStat{0, 1, 0, 0}, 0)
+	s3 := start("a", 1, "t3", "a/t3/1/4", TaskStat{1, 1, 0, 0}, 0)
+	s4 := start("b", 0, "t4", "b/t4/1/5", TaskStat{0, 1, 0, 0}, 0)
+
+	events := []*Event{
+		s1a, s1b, s2, s3, s4,
+		result(s2, testingResult{}, TaskStat{0, 0, 1, 1}, 5),
+		result(s3, testingResult{Err: testingError}, TaskStat{1, 0, 1, 0}, 2),
+		result(s4, testingResult{Err: context.Canceled}, TaskStat{0, 0, 1, 0}, 3),
+		{Task: task("t2"), kind: EventTaskComplete, TimeStart: at(6), TimeEnd: at(6)},
+		nil,
+	}
+	pt := NewProgressTracker()
+	for _, e := range events {
+		pt.Update(e)
+	}
+
+	got := pt.Snapshot()
+	if len(got) != 4 {
+		t.Fatalf("want 4 tasks, got %v", got)
+	}
+	if got[0].Elapsed <= 0 || got[2].Elapsed <= 0 {
+		t.Errorf("want positive elapsed of the tasks in progress, got %v", got)
+	}
+	got[0].Elapsed, got[2].Elapsed = 0, 0
+
+	want := []TaskProgress{
+		{TaskID: "t1", State: StateRunning, Workers: []WorkerID{"a", "b"}, Stat: TaskStat{0, 2, 0, 0}},
+		{TaskID: "t2", State: StateSuccess, Elapsed: 5 * time.Second, Stat: TaskStat{0, 0, 1, 1}},
+		{TaskID: "t3", State: StateWaiting, Stat: TaskStat{1, 0, 1, 0}},
+		{TaskID: "t4", State: StateCanceled, Elapsed: 3 * time.Second, Stat: TaskStat{0, 0, 1, 0}},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Snapshot mismatch (-want +got):\n%s", diff)
+	}
+	if s := want[0].String(); s != "t1: RUNNING (0s, 2 workers)" {
+		t.Errorf("unexpected string %q", s)
+	}
+	if s := want[1].String(); s != "t2: SUCCESS (5s)" {
+		t.Errorf("unexpected string %q", s)
+	}
+
+	tl := pt.Timeline()
+	var lines []string
+	for _, wt := range tl {
+		lines = append(lines, wt.String())
+	}
+	wantLines := []string{
+		"a[0]: |SUCCESS t2|",
+		"a[1]: |ERROR t3|",
+		"b[0]: |CANCELED t4|",
+	}
+	if diff := cmp.Diff(wantLines, lines); diff != "" {
+		t.Errorf("Timeline mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestProgressTracker_Execute(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, false}, {"t2", 10, true}},
+		"w2": {{"t1", 30, true}, {"t3", 10, false}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pt := NewProgressTracker()
+	for e := range out {
+		pt.Update(e)
+	}
+
+	states := map[TaskID]TaskState{}
+	for _, p := range pt.Snapshot() {
+		states[p.TaskID] = p.State
+		if len(p.Workers) != 0 {
+			t.Errorf("%s: want no running workers, got %v", p.TaskID, p.Workers)
+		}
+	}
+	want := map[TaskID]TaskState{"t1": StateSuccess, "t2": StateSuccess, "t3": StateError}
+	if diff := cmp.Diff(want, states); diff != "" {
+		t.Errorf("states mismatch (-want +got):\n%s", diff)
+	}
+
+	jobs := 0
+	for _, wt := range pt.Timeline() {
+		jobs += len(wt.Jobs)
+	}
+	if jobs != 4 {
+		t.Errorf("want 4 jobs in the timeline, got %d", jobs)
+	}
+}
+
+func TestTaskState_String(t *testing.T) {
+	tests := map[TaskState]string{
+		StateWaiting:  "WAITING",
+		StateRunning:  "RUNNING",
+		StateSuccess:  "SUCCESS",
+		StateError:    "ERROR",
+		StateCanceled: "CANCELED",
+		-1:            "INVALID",
+	}
+	for s, want := range tests {
+		if got := s.String(); got != want {
+			t.Errorf("want %q, got %q", want, got)
+		}
+	}
+}
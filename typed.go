@@ -0,0 +1,92 @@
+package taskengine
+
+import (
+	"context"
+	"fmt"
+)
+
+// TypedWorkFunc is the worker function to execute a given task of type T,
+// returning a result of type R (see TypedEngine).
+// The int parameter represents the worker instance.
+type TypedWorkFunc[T Task, R Result] func(context.Context, *Worker, int, T) R
+
+// TypedWorker is a worker of a TypedEngine, with a typed work function.
+// The Work and WorkWithStat fields of the embedded Worker are ignored.
+type TypedWorker[T Task, R Result] struct {
+	Worker
+	Work TypedWorkFunc[T, R]
+}
+
+// TypedEngine is a facade of the Engine with typed tasks and results,
+// so that the results don't need to be type asserted by the caller.
+// The non typed API is available with the Engine method.
+type TypedEngine[T Task, R Result] struct {
+	eng *Engine
+}
+
+// NewTypedEngine initialize a new typed engine from the list of workers
+// and the tasks of each worker, as the NewEngine function.
+func NewTypedEngine[T Task, R Result](ws []*TypedWorker[T, R], wts map[WorkerID][]T, opts ...Option) (*TypedEngine[T, R], error) {
+	workers := make([]*Worker, len(ws))
+	for j, tw := range ws {
+		if tw == nil {
+			continue
+		}
+		w := tw.Worker
+		w.Work, w.WorkWithStat = nil, nil
+		if tw.Work != nil {
+			work := tw.Work
+			w.Work = func(ctx context.Context, w *Worker, inst int, task Task) Result {
+				return work(ctx, w, inst, task.(T))
+			}
+		}
+		workers[j] = &w
+	}
+	tasks := WorkerTasks{}
+	for wid, ts := range wts {
+		for _, t := range ts {
+			tasks[wid] = append(tasks[wid], t)
+		}
+	}
+	eng, err := NewEngine(workers, tasks, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TypedEngine[T, R]{eng: eng}, nil
+}
+
+// Engine returns the underlying engine.
+func (te *TypedEngine[T, R]) Engine() *Engine {
+	return te.eng
+}
+
+// Execute returns a chan that receives the typed results generated by tasks execution,
+// filtered based on the Mode parameter, as the Execute method of the Engine.
+// The results not of type R, i.e. the PanicResult of a work function that panicked,
+// are dropped and reported to the OnCallbackError function, if any.
+func (te *TypedEngine[T, R]) Execute(ctx context.Context, mode Mode) (<-chan R, error) {
+	if te == nil {
+		return nil, fmt.Errorf("nil engine")
+	}
+	resultc, err := te.eng.Execute(ctx, mode)
+	if err != nil {
+		return nil, err
+	}
+	typedc := make(chan R)
+	go func() {
+		defer close(typedc)
+		for res := range resultc {
+			r, ok := res.(R)
+			if !ok {
+				err := fmt.Errorf("TypedEngine: result %T is not of type %T", res, r)
+				if rerr := res.Error(); rerr != nil {
+					err = fmt.Errorf("%v: %w", err, rerr)
+				}
+				te.eng.opts.callbackError(err)
+				continue
+			}
+			typedc <- r
+		}
+	}()
+	return typedc, nil
+}
@@ -0,0 +1,91 @@
+package taskengine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type typedTask struct {
+	id string
+	n  int
+}
+
+func (t typedTask) TaskID() TaskID { return TaskID(t.id) }
+
+type typedResult struct {
+	square int
+	err    error
+}
+
+func (r *typedResult) String() string { return fmt.Sprint(r.square) }
+func (r *typedResult) Error() error   { return r.err }
+
+func TestTypedEngine(t *testing.T) {
+	square := func(ctx context.Context, w *Worker, inst int, task typedTask) *typedResult {
+		if task.n < 0 {
+			panic("negative")
+		}
+		return &typedResult{square: task.n * task.n}
+	}
+	workers := []*TypedWorker[typedTask, *typedResult]{
+		{Worker: Worker{WorkerID: "w1", Instances: 2}, Work: square},
+	}
+	tasks := map[WorkerID][]typedTask{
+		"w1": {{"t1", 2}, {"t2", 3}, {"t3", -1}},
+	}
+
+	var cbErr error
+	eng, err := NewTypedEngine(workers, tasks, WithOnCallbackError(func(err error) { cbErr = err }))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.Execute(context.Background(), AllResults)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got []int
+	for res := range out {
+		got = append(got, res.square)
+	}
+	sort.Ints(got)
+
+	if diff := cmp.Diff([]int{4, 9}, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	// the panic result is not a typed result
+	if !errors.Is(cbErr, ErrWorkerPanic) {
+		t.Errorf("want the panic result reported, got %v", cbErr)
+	}
+	if eng.Engine() == nil {
+		t.Errorf("want the underlying engine, got nil")
+	}
+}
+
+func TestNewTypedEngine_Errors(t *testing.T) {
+	tests := map[string]struct {
+		workers []*TypedWorker[typedTask, *typedResult]
+		kind    ConfigErrorKind
+	}{
+		"nil worker":    {workers: []*TypedWorker[typedTask, *typedResult]{nil}, kind: NilWorker},
+		"nil work func": {workers: []*TypedWorker[typedTask, *typedResult]{{Worker: Worker{WorkerID: "w1", Instances: 1}}}, kind: NilWorkFunc},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewTypedEngine(tt.workers, nil)
+			var cerr *ConfigError
+			if !errors.As(err, &cerr) || cerr.Kind != tt.kind {
+				t.Errorf("want ConfigError of kind %v, got %v", tt.kind, err)
+			}
+		})
+	}
+
+	var eng *TypedEngine[typedTask, *typedResult]
+	if _, err := eng.Execute(context.Background(), AllResults); err == nil {
+		t.Errorf("nil engine: expected error, got nil")
+	}
+}
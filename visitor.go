@@ -0,0 +1,57 @@
+package taskengine
+
+// Visitor is the interface used by WalkEvents to handle each type of event.
+// Embed BaseVisitor to implement only the needed methods.
+type Visitor interface {
+	OnStart(*Event)
+	OnSuccess(*Event)
+	OnError(*Event)
+	OnCanceled(*Event)
+	OnAggregated(*Event)
+	OnTaskComplete(*Event)
+	OnSlow(*Event)
+	OnExpired(*Event)
+	OnSummary(*RunSummary) // see WithSummaryEvent
+}
+
+// BaseVisitor is a Visitor that does nothing.
+// It can be embedded in a struct to implement only some methods of the Visitor interface.
+type BaseVisitor struct{}
+
+func (BaseVisitor) OnStart(*Event)        {}
+func (BaseVisitor) OnSuccess(*Event)      {}
+func (BaseVisitor) OnError(*Event)        {}
+func (BaseVisitor) OnCanceled(*Event)     {}
+func (BaseVisitor) OnAggregated(*Event)   {}
+func (BaseVisitor) OnTaskComplete(*Event) {}
+func (BaseVisitor) OnSlow(*Event)         {}
+func (BaseVisitor) OnExpired(*Event)      {}
+func (BaseVisitor) OnSummary(*RunSummary) {}
+
+// WalkEvents reads the events from the chan, until it is closed,
+// and calls the Visitor method corresponding to the type of each event.
+// Nil events are ignored.
+func WalkEvents(events <-chan *Event, v Visitor) {
+	for e := range events {
+		switch e.Type() {
+		case EventStart:
+			v.OnStart(e)
+		case EventSuccess:
+			v.OnSuccess(e)
+		case EventError:
+			v.OnError(e)
+		case EventCanceled:
+			v.OnCanceled(e)
+		case EventAggregated:
+			v.OnAggregated(e)
+		case EventTaskComplete:
+			v.OnTaskComplete(e)
+		case EventSlow:
+			v.OnSlow(e)
+		case EventExpired:
+			v.OnExpired(e)
+		case EventSummary:
+			v.OnSummary(e.Summary)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package taskengine
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// countingVisitor counts the success and error events, and saves the summary.
+type countingVisitor struct {
+	BaseVisitor
+	count   map[EventType]int
+	summary *RunSummary
+}
+
+func (v *countingVisitor) OnSuccess(e *Event)      { v.count[EventSuccess]++ }
+func (v *countingVisitor) OnError(e *Event)        { v.count[EventError]++ }
+func (v *countingVisitor) OnSummary(s *RunSummary) { v.summary = s }
+
+// recordingVisitor records the type of every event.
+type recordingVisitor struct {
+	types []EventType
+}
+
+func (v *recordingVisitor) OnStart(e *Event)        { v.types = append(v.types, EventStart) }
+func (v *recordingVisitor) OnSuccess(e *Event)      { v.types = append(v.types, EventSuccess) }
+func (v *recordingVisitor) OnError(e *Event)        { v.types = append(v.types, EventError) }
+func (v *recordingVisitor) OnCanceled(e *Event)     { v.types = append(v.types, EventCanceled) }
+func (v *recordingVisitor) OnAggregated(e *Event)   { v.types = append(v.types, EventAggregated) }
+func (v *recordingVisitor) OnTaskComplete(e *Event) { v.types = append(v.types, EventTaskComplete) }
+func (v *recordingVisitor) OnSlow(e *Event)         { v.types = append(v.types, EventSlow) }
+func (v *recordingVisitor) OnExpired(e *Event)      { v.types = append(v.types, EventExpired) }
+func (v *recordingVisitor) OnSummary(s *RunSummary) { v.types = append(v.types, EventSummary) }
+
+func TestWalkEvents(t *testing.T) {
+	events := []*Event{
+		{},
+		{Result: testingResult{}},
+		{Result: testingResult{Err: testingError}},
+		{Result: testingResult{Err: context.Canceled}},
+		{Result: testingResult{}, kind: EventAggregated},
+		{kind: EventTaskComplete},
+		{kind: EventSlow},
+		{kind: EventExpired},
+		{kind: EventSummary, Summary: &RunSummary{}},
+		nil,
+	}
+	want := []EventType{EventStart, EventSuccess, EventError, EventCanceled, EventAggregated, EventTaskComplete, EventSlow, EventExpired, EventSummary}
+
+	eventc := make(chan *Event, len(events))
+	for _, e := range events {
+		eventc <- e
+	}
+	close(eventc)
+
+	v := &recordingVisitor{}
+	WalkEvents(eventc, v)
+
+	if diff := cmp.Diff(want, v.types); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWalkEvents_BaseVisitor(t *testing.T) {
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, false}, {"t3", 10, true}},
+	}
+
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithSummaryEvent(true))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	v := &countingVisitor{count: map[EventType]int{}}
+	WalkEvents(out, v)
+
+	want := map[EventType]int{EventSuccess: 2, EventError: 1}
+	if diff := cmp.Diff(want, v.count); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+	if v.summary == nil || v.summary.Tasks != 3 || v.summary.Succeeded != 2 {
+		t.Errorf("want the summary of 3 tasks with 2 succeeded, got %v", v.summary)
+	}
+}
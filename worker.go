@@ -2,6 +2,10 @@ package taskengine
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
 )
 
 // Max number of instances for each worker
@@ -29,6 +33,27 @@ type Task interface {
 	TaskID() TaskID
 }
 
+// TaskWithTimeout is a task with a max duration of each attempt.
+// The context passed to the Work function expires after the timeout,
+// so that the attempt of a slow worker instance returns a context.DeadlineExceeded error,
+// reported as a canceled result.
+// A not positive timeout means no timeout.
+type TaskWithTimeout interface {
+	Task
+	Timeout() time.Duration
+}
+
+// TaskWithDeps is a task that depends on other tasks:
+// it is not started until each of its dependencies has a success result,
+// so that the engine executes the tasks as a DAG.
+// The dependencies that are not tasks of the run are considered satisfied;
+// a task whose dependency ends without success is never started, and it is discarded.
+// NewEngine returns a *ConfigError of DependencyCycle kind if the dependencies contain a cycle.
+type TaskWithDeps interface {
+	Task
+	DependsOn() []TaskID
+}
+
 // Result is the interface that must be matched by the output of the Work function.
 type Result interface {
 
@@ -38,15 +63,128 @@ type Result interface {
 	// The error returned by the Work function.
 	// It is used to determine the status of the task execution as follow
 	//    Success:  error is nil
-	//    Canceled: error is context.Canceled
+	//    Canceled: error is context.Canceled or context.DeadlineExceeded
 	//    Error:    otherwise
 	Error() error
 }
 
+// InvalidResult is the result of a job whose success result
+// has been rejected by the validate function (see WithValidateResult).
+type InvalidResult struct {
+	Result Result // the original result
+	Err    error  // the validation error
+}
+
+// String returns the string representation of the original result.
+func (r *InvalidResult) String() string { return r.Result.String() }
+
+// Error returns the validation error.
+func (r *InvalidResult) Error() error { return r.Err }
+
+// ErrAbandoned is the error of the result of a canceled job
+// abandoned after the cancel grace period (see WithCancelGrace).
+// It wraps context.Canceled, so that the job is reported as canceled.
+var ErrAbandoned = fmt.Errorf("job abandoned after cancel grace: %w", context.Canceled)
+
+// AbandonedResult is the result of a canceled job
+// that did not return within the cancel grace period (see WithCancelGrace).
+type AbandonedResult struct{}
+
+// String returns the string representation of the abandoned result.
+func (AbandonedResult) String() string { return "abandoned" }
+
+// Error returns the ErrAbandoned error.
+func (AbandonedResult) Error() error { return ErrAbandoned }
+
+// NotStartedResult is the result of a job not started
+// because the task context was done while waiting for a free slot (see WithMaxConcurrent).
+type NotStartedResult struct {
+	Err error // the error of the context
+}
+
+// String returns the string representation of the not started result.
+func (r *NotStartedResult) String() string { return "not started" }
+
+// Error returns the error of the context.
+func (r *NotStartedResult) Error() error { return r.Err }
+
+// ErrHardWait is the error of the result of a job
+// abandoned after the hard wait (see WithHardWait).
+var ErrHardWait = errors.New("job abandoned after hard wait")
+
+// HardWaitResult is the result of a job
+// that did not return within the hard wait (see WithHardWait).
+type HardWaitResult struct{}
+
+// String returns the string representation of the hard wait result.
+func (HardWaitResult) String() string { return "hard wait" }
+
+// Error returns the ErrHardWait error.
+func (HardWaitResult) Error() error { return ErrHardWait }
+
+// ErrWorkerPanic is wrapped by the error of the result of a job
+// whose Work function panicked (see PanicResult).
+var ErrWorkerPanic = errors.New("worker panic")
+
+// PanicResult is the result of a job whose Work function panicked:
+// the panic is recovered, so that the execution goes on (see WithRecoverWorkPanics).
+type PanicResult struct {
+	Value interface{} // the recovered value
+	Stack []byte      // the stack trace of the panic
+}
+
+// String returns the string representation of the panic result.
+func (r *PanicResult) String() string { return fmt.Sprintf("panic: %v", r.Value) }
+
+// Error returns an error wrapping ErrWorkerPanic,
+// with the recovered value and the stack trace.
+func (r *PanicResult) Error() error {
+	return fmt.Errorf("%w: %v\n%s", ErrWorkerPanic, r.Value, r.Stack)
+}
+
+// ErrNilResult is the error of the result of a job
+// whose Work function returned a nil Result (see NilResult).
+var ErrNilResult = errors.New("nil result of the work function")
+
+// NilResult is the result of a job whose Work function returned a nil Result,
+// violating the contract of the function: the job is handled as an error.
+type NilResult struct{}
+
+// String returns the string representation of the nil result.
+func (NilResult) String() string { return "nil result" }
+
+// Error returns the ErrNilResult error.
+func (NilResult) Error() error { return ErrNilResult }
+
+// ResultEqualFunc is a function that returns true if two results are the same.
+type ResultEqualFunc func(a, b Result) bool
+
+// ResultEqual is the default function to decide if two results are the same:
+// they are equal if both are nil, or if they have the same error message
+// (or both a nil error) and the same String representation.
+func ResultEqual(a, b Result) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	ea, eb := a.Error(), b.Error()
+	if (ea == nil) != (eb == nil) {
+		return false
+	}
+	if ea != nil && ea.Error() != eb.Error() {
+		return false
+	}
+	return a.String() == b.String()
+}
+
 // WorkFunc is the worker function to execute a given task.
 // The int parameter represents the worker instance.
 type WorkFunc func(context.Context, *Worker, int, Task) Result
 
+// StatWorkFunc is like WorkFunc, but it also receives the stat of the task
+// when the job was sent to the worker instance (i.e. how many workers are doing the task
+// or have done it, and with what results), to adapt the execution to the previous attempts.
+type StatWorkFunc func(context.Context, *Worker, int, Task, TaskStat) Result
+
 // Worker is the unit (identified by WorkerID)
 // that receives the Requests and
 // executes a specific WorkFunc function to return the Responses.
@@ -61,6 +199,94 @@ type Worker struct {
 
 	// The work function
 	Work WorkFunc
+
+	// The work function receiving the stat of the task.
+	// If not nil, it is called instead of the Work function, that can be nil.
+	WorkWithStat StatWorkFunc
+
+	// Virtual workers don't execute the tasks and no instance is started for them.
+	// They only contribute the results returned by the Lookup function
+	// (i.e. a cache or precomputed results).
+	Virtual bool
+
+	// The lookup function of a virtual worker.
+	// It returns the result of the task, if found.
+	// If it panics, the task is not found (see WithOnCallbackError).
+	Lookup func(Task) (Result, bool)
+
+	// InstanceWeights are the positive weights of the instances (length == Instances).
+	// The engine offers the tasks to the instances in weighted round-robin:
+	// in each round, the i-th instance executes at most InstanceWeights[i] tasks,
+	// then it stays idle until the round ends, i.e. no instance of the worker is busy.
+	// If nil, the instances are equivalent and always get a task when ready.
+	InstanceWeights []int
+
+	// Retry policy of the failed tasks of the worker, if not nil.
+	// It overrides the retries of the engine (see WithRetries).
+	Retry *RetryPolicy
+
+	// Group of the worker, if not empty (i.e. the data center of the worker).
+	// The instances of the workers of a group share the concurrency limit
+	// of the group, if any (see WithGroupLimits).
+	Group string
+
+	// Priority of the worker (the default is 0).
+	// When more instances are ready at the same time (i.e. in the initial readiness round),
+	// the instances of the workers with higher priority are offered the tasks first,
+	// so that they start the tasks contended with the other workers.
+	// The priority is applied before the reliability ordering (see WithReliabilityOrdering),
+	// and it doesn't change the task picked by an instance, still chosen by the stat of the tasks
+	// (fewer successes, then fewer doing, then fewer todo, then lower TaskID).
+	// An instance ready when the instances of higher priority are busy is offered a task at once.
+	Priority int
+}
+
+// RetryPolicy defines how a worker retries a task after an error result (not canceled),
+// as long as the task has no success.
+// The task is retried by the same worker instance, after the backoff:
+// meanwhile the instance executes no other task.
+// The retry is given up as soon as the task succeeds elsewhere or it is canceled:
+// the instance is then offered the other tasks, as usual.
+type RetryPolicy struct {
+	// Max number of attempts of each task by the worker, including the first one.
+	MaxAttempts int
+
+	// Backoff returns the time to wait before the given retry (1 for the first retry).
+	// If nil, the task is retried immediately.
+	Backoff func(attempt int) time.Duration
+}
+
+// maxRetries returns the max number of retries of a failed task by the worker:
+// the ones of its retry policy, if any, or the ones of the engine otherwise.
+func (w *Worker) maxRetries(engineRetries int) int {
+	if w.Retry != nil {
+		return w.Retry.MaxAttempts - 1
+	}
+	return engineRetries
+}
+
+// instances returns the number of instances to start for the worker.
+func (w *Worker) instances() int {
+	if w.Virtual {
+		return 0
+	}
+	return w.Instances
+}
+
+// sortWorkersByPriority sorts the workers by decreasing priority.
+// The workers with the same priority keep their order.
+func sortWorkersByPriority(ws []*Worker) {
+	sort.SliceStable(ws, func(i, j int) bool { return ws[i].Priority > ws[j].Priority })
+}
+
+// hasPriorities returns if some worker has a not default priority.
+func hasPriorities(ws []*Worker) bool {
+	for _, w := range ws {
+		if w.Priority != 0 {
+			return true
+		}
+	}
+	return false
 }
 
 // Tasks is an array of tasks.
@@ -80,6 +306,108 @@ func (wts WorkerTasks) Clone() WorkerTasks {
 	return wts2
 }
 
+// Broadcast appends the task to the list of each of the given workers,
+// so that the task can be executed by any of them.
+// The WorkerTasks object must not be nil.
+func (wts WorkerTasks) Broadcast(task Task, workers ...WorkerID) {
+	for _, wid := range workers {
+		wts[wid] = append(wts[wid], task)
+	}
+}
+
+// BroadcastAll appends the task to the list of each worker of the WorkerTasks object.
+func (wts WorkerTasks) BroadcastAll(task Task) {
+	for wid := range wts {
+		wts[wid] = append(wts[wid], task)
+	}
+}
+
+// filter returns a new WorkerTasks object containing only the tasks
+// whose TaskID satisfies the keep function.
+// Workers without tasks are not included.
+func (wts WorkerTasks) filter(keep func(TaskID) bool) WorkerTasks {
+	wts2 := WorkerTasks{}
+	for w, ts := range wts {
+		ts2 := Tasks{}
+		for _, t := range ts {
+			if keep(t.TaskID()) {
+				ts2 = append(ts2, t)
+			}
+		}
+		if len(ts2) > 0 {
+			wts2[w] = ts2
+		}
+	}
+	return wts2
+}
+
+// removeTask removes, from the list of each worker, the tasks with the given TaskID.
+// It returns the number of removed tasks.
+func (wts WorkerTasks) removeTask(tid TaskID) int {
+	n := 0
+	for w, ts := range wts {
+		ts2 := ts[:0]
+		for _, t := range ts {
+			if t.TaskID() == tid {
+				n++
+			} else {
+				ts2 = append(ts2, t)
+			}
+		}
+		wts[w] = ts2
+	}
+	return n
+}
+
+// check returns a *ConfigError if the task list of the worker contains a nil task.
+func (ts Tasks) check(wid WorkerID) error {
+	for j, t := range ts {
+		if t == nil {
+			return &ConfigError{Kind: NilTask, WorkerID: wid, Index: j}
+		}
+	}
+	return nil
+}
+
+// WorkerTasksBuilder builds a WorkerTasks object, adding the tasks of each worker.
+// For example:
+//
+//	wts, err := NewWorkerTasksBuilder().
+//	    Add("w1", task1, task2).
+//	    AddAll("w2", tasks).
+//	    Build()
+type WorkerTasksBuilder struct {
+	wts WorkerTasks
+}
+
+// NewWorkerTasksBuilder returns a new empty WorkerTasksBuilder.
+func NewWorkerTasksBuilder() *WorkerTasksBuilder {
+	return &WorkerTasksBuilder{wts: WorkerTasks{}}
+}
+
+// Add appends the tasks to the list of the worker.
+func (b *WorkerTasksBuilder) Add(wid WorkerID, tasks ...Task) *WorkerTasksBuilder {
+	return b.AddAll(wid, tasks)
+}
+
+// AddAll appends the tasks to the list of the worker.
+func (b *WorkerTasksBuilder) AddAll(wid WorkerID, tasks Tasks) *WorkerTasksBuilder {
+	b.wts[wid] = append(b.wts[wid], tasks...)
+	return b
+}
+
+// Build returns the WorkerTasks object with the tasks added so far,
+// or a *ConfigError if some worker has a nil task.
+// The builder can still be used: the returned object is not affected by the next Add calls.
+func (b *WorkerTasksBuilder) Build() (WorkerTasks, error) {
+	for wid, ts := range b.wts {
+		if err := ts.check(wid); err != nil {
+			return nil, err
+		}
+	}
+	return b.wts.Clone(), nil
+}
+
 // remove removes the i-th task of the list.
 // It returns the removed task.
 // NOTE: DO NOT preserve the order of the items in the list.
@@ -91,3 +419,12 @@ func (ts *Tasks) remove(i int) Task {
 	(*ts) = (*ts)[:L1]
 	return t
 }
+
+// removeStable removes the i-th task of the list, like remove,
+// but it preserves the order of the remaining tasks in the list.
+// WARN: doen not check the i-th task exists!
+func (ts *Tasks) removeStable(i int) Task {
+	t := (*ts)[i]
+	(*ts) = append((*ts)[:i], (*ts)[i+1:]...)
+	return t
+}
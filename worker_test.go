@@ -1,7 +1,11 @@
 package taskengine
 
 import (
+	"context"
+	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -39,6 +43,55 @@ func TestWorkerTasks_Clone(t *testing.T) {
 	}
 }
 
+func TestWorkerTasksBuilder(t *testing.T) {
+	t1 := &testingTask{"t1", 10, true}
+	t2 := &testingTask{"t2", 10, true}
+	t3 := &testingTask{"t3", 10, true}
+
+	b := NewWorkerTasksBuilder().
+		Add("w1", t1, t2).
+		AddAll("w2", Tasks{t3}).
+		Add("w1", t3)
+	wts, err := b.Build()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := WorkerTasks{"w1": {t1, t2, t3}, "w2": {t3}}
+	if diff := cmp.Diff(want, wts, cmp.Comparer(comparerTestingTask)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+
+	// the built object is not affected by the next Add calls
+	b.Add("w2", t1)
+	if len(wts["w2"]) != 1 {
+		t.Errorf("want the built object unchanged, got %v", wts)
+	}
+
+	_, err = b.Add("w3", t1, nil).Build()
+	var cerr *ConfigError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("want *ConfigError, got %T: %v", err, err)
+	}
+	if want := (ConfigError{Kind: NilTask, WorkerID: "w3", Index: 1}); *cerr != want {
+		t.Errorf("want %v, got %v", want, *cerr)
+	}
+}
+
+func TestWorkerTasks_Broadcast(t *testing.T) {
+	t1 := &testingTask{"t1", 10, true}
+	t2 := &testingTask{"t2", 10, true}
+	t3 := &testingTask{"t3", 10, true}
+
+	wts := WorkerTasks{"w1": {t1}, "w2": {}}
+	wts.Broadcast(t2, "w2", "w3")
+	wts.BroadcastAll(t3)
+
+	want := WorkerTasks{"w1": {t1, t3}, "w2": {t2, t3}, "w3": {t2, t3}}
+	if diff := cmp.Diff(want, wts, cmp.Comparer(comparerTestingTask)); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestTasks_remove(t *testing.T) {
 
 	t1 := &testingTask{"t1", 11, true}
@@ -101,6 +154,99 @@ func TestTasks_remove(t *testing.T) {
 	}
 }
 
+func TestTasks_removeStable(t *testing.T) {
+
+	t1 := &testingTask{"t1", 11, true}
+	t2 := &testingTask{"t2", 12, true}
+	t3 := &testingTask{"t3", 13, false}
+	t4 := &testingTask{"t4", 14, false}
+
+	tests := []struct {
+		name      string
+		tasks     Tasks
+		idx       int
+		wantTask  Task
+		wantTasks Tasks
+	}{
+		{
+			name:      "remove first",
+			tasks:     Tasks{t1, t2, t3, t4},
+			idx:       0,
+			wantTask:  t1,
+			wantTasks: Tasks{t2, t3, t4},
+		},
+		{
+			name:      "remove second",
+			tasks:     Tasks{t1, t2, t3, t4},
+			idx:       1,
+			wantTask:  t2,
+			wantTasks: Tasks{t1, t3, t4},
+		},
+		{
+			name:      "remove third",
+			tasks:     Tasks{t1, t2, t3, t4},
+			idx:       2,
+			wantTask:  t3,
+			wantTasks: Tasks{t1, t2, t4},
+		},
+		{
+			name:      "remove last",
+			tasks:     Tasks{t1, t2, t3, t4},
+			idx:       3,
+			wantTask:  t4,
+			wantTasks: Tasks{t1, t2, t3},
+		},
+		{
+			name:      "remove only",
+			tasks:     Tasks{t1},
+			idx:       0,
+			wantTask:  t1,
+			wantTasks: Tasks{},
+		},
+	}
+
+	copts := cmp.Options{cmp.Comparer(comparerTestingTask)}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			gotTask := tt.tasks.removeStable(tt.idx)
+			gotTasks := tt.tasks
+
+			if diff := cmp.Diff(tt.wantTask, gotTask, copts); diff != "" {
+				t.Errorf("Tasks.removeStable() mismatch task (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.wantTasks, gotTasks, copts); diff != "" {
+				t.Errorf("Tasks.removeStable() mismatch tasks (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestWorkerTasks_removeTask(t *testing.T) {
+	input := map[string]testingTasks{
+		"w1": {{"t1", 11, true}, {"t2", 12, true}, {"t3", 13, false}},
+		"w2": {{"t1", 21, false}, {"t2", 22, true}},
+		"w3": {{"t1", 31, true}},
+	}
+	want := testingWorkerTasks(map[string]testingTasks{
+		"w1": {{"t2", 12, true}, {"t3", 13, false}},
+		"w2": {{"t2", 22, true}},
+		"w3": {},
+	})
+
+	wts := testingWorkerTasks(input)
+	n := wts.removeTask("t1")
+
+	if n != 3 {
+		t.Errorf("removed tasks: want 3, got %d", n)
+	}
+	copts := cmp.Options{cmp.Comparer(comparerTestingTask)}
+	if diff := cmp.Diff(want, wts, copts); diff != "" {
+		t.Errorf("WorkerTasks.removeTask() mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func TestGolang_ListOfPointer(t *testing.T) {
 
 	t1 := &testingTask{"t1", 11, true}
@@ -193,3 +339,225 @@ func TestGolang_ListOfInterfacePointer(t *testing.T) {
 		t.Errorf("tasks[0].(testingTask).taskid: want %q, got %s", want, got)
 	}
 }
+
+func TestResultEqual(t *testing.T) {
+	errOther := errors.New("testing error")
+
+	tests := map[string]struct {
+		a, b Result
+		want bool
+	}{
+		"both nil":           {nil, nil, true},
+		"one nil":            {testingResult{}, nil, false},
+		"both success":       {testingResult{Wid: "w1"}, testingResult{Wid: "w2"}, true},
+		"success and error":  {testingResult{}, testingResult{Err: testingError}, false},
+		"same error":         {testingResult{Err: testingError}, testingResult{Err: testingError}, true},
+		"same error message": {testingResult{Err: testingError}, testingResult{Err: errOther}, true},
+		"different error":    {testingResult{Err: testingError}, testingResult{Err: context.Canceled}, false},
+		"different string":   {testingResult{}, &voteResult{Value: "a"}, false},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := ResultEqual(tt.a, tt.b); got != tt.want {
+				t.Errorf("want %v, got %v", tt.want, got)
+			}
+			if got := ResultEqual(tt.b, tt.a); got != tt.want {
+				t.Errorf("symmetric: want %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestWorker_RetryPolicy(t *testing.T) {
+	// flakyWorkFn fails the first two attempts of each task
+	var mu sync.Mutex
+	attempts := map[TaskID]int{}
+	flakyWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		mu.Lock()
+		attempts[task.TaskID()]++
+		n := attempts[task.TaskID()]
+		mu.Unlock()
+		res := &testingResult{Tid: string(task.TaskID()), Wid: string(worker.WorkerID)}
+		if n <= 2 {
+			res.Err = testingError
+		}
+		return res
+	}
+
+	const backoff = 20 * time.Millisecond
+	var backoffs []int
+	policy := &RetryPolicy{
+		MaxAttempts: 3,
+		Backoff: func(attempt int) time.Duration {
+			backoffs = append(backoffs, attempt)
+			return backoff
+		},
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 2, Work: flakyWorkFn, Retry: policy},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 0, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	type attempt struct {
+		Type  EventType
+		Inst  int
+		Retry int
+	}
+	var got []attempt
+	var lastEnd time.Time
+	for e := range out {
+		got = append(got, attempt{e.Type(), e.WorkerInst, e.Retry})
+		if e.Type() == EventStart && !lastEnd.IsZero() && e.TimeStart.Sub(lastEnd) < backoff {
+			t.Errorf("want a retry after the backoff, got %v", e.TimeStart.Sub(lastEnd))
+		}
+		lastEnd = e.TimeEnd
+	}
+
+	inst := got[0].Inst
+	want := []attempt{
+		{EventStart, inst, 0}, {EventError, inst, 0},
+		{EventStart, inst, 1}, {EventError, inst, 1},
+		{EventStart, inst, 2}, {EventSuccess, inst, 2},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("events mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff([]int{1, 2}, backoffs); diff != "" {
+		t.Errorf("backoffs mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWorker_RetryPolicy_SuccessElsewhere(t *testing.T) {
+	failWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task) Result {
+		return &testingResult{Tid: string(task.TaskID()), Wid: string(worker.WorkerID), Err: testingError}
+	}
+	policy := &RetryPolicy{
+		MaxAttempts: 5,
+		Backoff:     func(int) time.Duration { return time.Second },
+	}
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: failWorkFn, Retry: policy},
+		{WorkerID: "w2", Instances: 1, Work: testingWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 0, true}},
+		"w2": {{"t1", 50, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input), WithRetries(3))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start := time.Now()
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	starts := map[WorkerID]int{}
+	for e := range out {
+		if e.Type() == EventStart {
+			starts[e.WorkerID]++
+		}
+	}
+	elapsed := time.Since(start)
+
+	// the retry is given up as soon as w2 succeeds
+	if diff := cmp.Diff(map[WorkerID]int{"w1": 1, "w2": 1}, starts); diff != "" {
+		t.Errorf("starts mismatch (-want +got):\n%s", diff)
+	}
+	if elapsed >= 500*time.Millisecond {
+		t.Errorf("want the run to end without waiting the backoff, got %v", elapsed)
+	}
+}
+
+func TestWorker_WorkWithStat(t *testing.T) {
+	var mu sync.Mutex
+	stats := map[TaskID]TaskStat{}
+	statWorkFn := func(ctx context.Context, worker *Worker, workerInst int, task Task, stat TaskStat) Result {
+		mu.Lock()
+		stats[task.TaskID()] = stat
+		mu.Unlock()
+		return testingWorkFn(ctx, worker, workerInst, task)
+	}
+
+	workers := []*Worker{
+		{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+		{WorkerID: "w2", Instances: 1, WorkWithStat: statWorkFn},
+	}
+	input := map[string]testingTasks{
+		"w1": {{"t1", 0, false}},
+		"w2": {{"t0", 30, true}, {"t1", 0, true}},
+	}
+	eng, err := NewEngine(workers, testingWorkerTasks(input))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	out, err := eng.ExecuteEvents(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for range out {
+	}
+
+	// w2 is the second worker attempting t1, after the error of w1
+	want := map[TaskID]TaskStat{
+		"t0": {Doing: 1},
+		"t1": {Doing: 1, Done: 1},
+	}
+	if diff := cmp.Diff(want, stats); diff != "" {
+		t.Errorf("stats mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestWorker_Priority(t *testing.T) {
+	input := map[string]testingTasks{
+		"w1": {{"t1", 10, true}, {"t2", 10, true}},
+		"w2": {{"t1", 10, true}, {"t2", 10, true}},
+	}
+
+	tests := []struct {
+		name     string
+		priority int // priority of w2
+		want     map[WorkerID]TaskID
+	}{
+		{"default", 0, map[WorkerID]TaskID{"w1": "t1", "w2": "t2"}},
+		{"w2 first", 1, map[WorkerID]TaskID{"w1": "t2", "w2": "t1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workers := []*Worker{
+				{WorkerID: "w1", Instances: 1, Work: testingWorkFn},
+				{WorkerID: "w2", Instances: 1, Work: testingWorkFn, Priority: tt.priority},
+			}
+			eng, err := NewEngine(workers, testingWorkerTasks(input), WithOrderedReadiness(true))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			out, err := eng.ExecuteEvents(context.Background())
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// the first task started by each worker
+			got := map[WorkerID]TaskID{}
+			for e := range out {
+				if _, ok := got[e.WorkerID]; !ok && e.Type() == EventStart {
+					got[e.WorkerID] = e.Task.TaskID()
+				}
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("first tasks mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}